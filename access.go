@@ -0,0 +1,90 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 接入类型
+const (
+	AccessDirect   = "0" // 商户直连接入
+	AccessAcquirer = "1" // 收单机构接入
+	AccessPlatform = "2" // 平台类商户接入
+)
+
+var ErrUnknownAccessType = errors.New("unknown access type")
+
+// Access 接入方式,零值为商户直连接入
+type Access struct {
+	AccessType string // 接入类型 默认为0
+	AcqInsCode string // 收单机构代码 收单机构接入时必送
+	SubMerID   string // 二级商户代码 平台类商户接入时必送
+	SubMerName string // 二级商户全称 平台类商户接入时必送
+	SubMerAbbr string // 二级商户简称 平台类商户接入时必送
+}
+
+// Validate 校验接入类型对应的必送字段
+func (a Access) Validate() error {
+	var must KVpairs
+	switch a.AccessType {
+	case "", AccessDirect:
+		return nil
+	case AccessAcquirer:
+		must = KVpairs{{K: "acqInsCode", V: a.AcqInsCode}}
+	case AccessPlatform:
+		must = KVpairs{
+			{K: "subMerId", V: a.SubMerID},
+			{K: "subMerName", V: a.SubMerName},
+			{K: "subMerAbbr", V: a.SubMerAbbr},
+		}
+	default:
+		return ErrUnknownAccessType
+	}
+
+	for _, kv := range must {
+		if kv.V == "" {
+			return fmt.Errorf("must param is empty:%s (accessType %s)", kv.K, a.AccessType)
+		}
+	}
+	return nil
+}
+
+func (a Access) kvpairs() KVpairs {
+	accessType := a.AccessType
+	if accessType == "" {
+		accessType = AccessDirect
+	}
+
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "accessType", V: accessType})
+	kvs = append(kvs, KVpair{K: "acqInsCode", V: a.AcqInsCode})
+	kvs = append(kvs, KVpair{K: "subMerId", V: a.SubMerID})
+	kvs = append(kvs, KVpair{K: "subMerName", V: a.SubMerName})
+	kvs = append(kvs, KVpair{K: "subMerAbbr", V: a.SubMerAbbr})
+	return kvs.RemoveEmpty()
+}
+
+// accessKeys 由Access决定的域
+var accessKeys = []string{"accessType", "acqInsCode", "subMerId", "subMerName", "subMerAbbr"}
+
+// setParams 设置接入方式相关的域,params中已有的同名域被替换或删除,应在合并extraParams之后调用
+func (a Access) setParams(params map[string]string) {
+	for _, k := range accessKeys {
+		delete(params, k)
+	}
+	for _, kv := range a.kvpairs() {
+		params[kv.K] = kv.V
+	}
+}
+
+// WithAccess 返回使用指定接入方式的UnionPay,证书及http客户端与原对象共享
+// 平台类商户可按二级商户分别调用,退货,撤销,查询等交易同样使用该接入方式
+func (up *UnionPay) WithAccess(a Access) (*UnionPay, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := *up
+	c.access = a
+	return &c, nil
+}
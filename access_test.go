@@ -0,0 +1,49 @@
+package unionpay
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAccessOverridesExtraParams(t *testing.T) {
+	platform := Access{AccessType: AccessPlatform, SubMerID: "SUB0001", SubMerName: "二级商户", SubMerAbbr: "二级"}
+	extra := map[string]string{
+		"accessType": AccessDirect,
+		"subMerId":   "OTHER",
+		"acqInsCode": "00000000",
+	}
+
+	for _, c := range []struct {
+		access Access
+		want   map[string]string
+	}{
+		{
+			access: Access{},
+			want:   map[string]string{"accessType": "0", "subMerId": "", "acqInsCode": ""},
+		},
+		{
+			access: platform,
+			want:   map[string]string{"accessType": "2", "subMerId": "SUB0001", "subMerName": "二级商户", "acqInsCode": ""},
+		},
+	} {
+		base := newTestPayment(t)
+		var form url.Values
+		fakeGateway(base, func(f url.Values) map[string]string {
+			form = f
+			return respFields(f, "00")
+		})
+
+		up, err := base.WithAccess(c.access)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = up.Payout("PAY20240102001", Fen(100), "6216261000000000018", "https://example.com/notify", extra); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range c.want {
+			if got := form.Get(k); got != v {
+				t.Errorf("accessType %q: %s = %q, want %q", c.access.AccessType, k, got, v)
+			}
+		}
+	}
+}
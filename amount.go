@@ -0,0 +1,187 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBadAmount        = errors.New("bad amount")
+	ErrAmountOutOfRange = errors.New("amount out of range, txnAmt must be 1 to 12 digits")
+)
+
+// maxTxnAmt txnAmt为N1..12,最大12位数字
+const maxTxnAmt = 999999999999
+
+// Amount 金额,以币种的最小货币单位表示,如人民币为分,日元为元
+// Currency为零值时使用商户设置的交易币种(默认人民币)
+type Amount struct {
+	Value    int64
+	Currency Currency
+}
+
+// Fen 以分为单位的人民币金额
+func Fen(fen int64) Amount {
+	return Amount{Value: fen, Currency: CNY}
+}
+
+// NewAmount 以最小货币单位表示的金额
+func NewAmount(minor int64, c Currency) Amount {
+	return Amount{Value: minor, Currency: c}
+}
+
+// ParseYuan 解析以元为单位的人民币金额,如 "12.34"
+func ParseYuan(s string) (Amount, error) {
+	return ParseAmount(s, CNY)
+}
+
+// ParseAmount 解析以主货币单位表示的金额,如美元 "12.34",小数位数不能超过币种的小数位数
+func ParseAmount(s string, c Currency) (a Amount, err error) {
+	s = strings.TrimSpace(s)
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	if intPart == "" || strings.Trim(intPart, "0123456789") != "" || strings.Trim(fracPart, "0123456789") != "" {
+		err = fmt.Errorf("%w: %q", ErrBadAmount, s)
+		return
+	}
+	if len(fracPart) > c.MinorUnits {
+		err = fmt.Errorf("%w: %q has more than %d decimal places", ErrBadAmount, s, c.MinorUnits)
+		return
+	}
+
+	digits := intPart + fracPart + strings.Repeat("0", c.MinorUnits-len(fracPart))
+	a.Currency = c
+	a.Value, err = strconv.ParseInt(digits, 10, 64)
+	if err != nil || a.Value > maxTxnAmt {
+		err = fmt.Errorf("%w: %q", ErrAmountOutOfRange, s)
+	}
+	return
+}
+
+// ParseTxnAmt 解析报文中的txnAmt,settleAmt等金额域,表中没有的数字币种代码按2位小数处理
+func ParseTxnAmt(txnAmt, currencyCode string) (a Amount, err error) {
+	if currencyCode != "" {
+		if a.Currency, err = currencyOf(currencyCode); err != nil {
+			return
+		}
+	}
+	if txnAmt == "" {
+		return
+	}
+
+	if len(txnAmt) > 12 || strings.Trim(txnAmt, "0123456789") != "" {
+		err = fmt.Errorf("%w: %q", ErrBadAmount, txnAmt)
+		return
+	}
+	a.Value, err = strconv.ParseInt(txnAmt, 10, 64)
+	return
+}
+
+// Validate 校验金额是否可以作为txnAmt上送
+func (a Amount) Validate() error {
+	if a.Value <= 0 || a.Value > maxTxnAmt {
+		return ErrAmountOutOfRange
+	}
+	return nil
+}
+
+func (a Amount) IsZero() bool {
+	return a.Value == 0
+}
+
+// Cmp 比较两个金额,币种不一致时返回错误
+func (a Amount) Cmp(b Amount) (int, error) {
+	if a.Currency.Code != "" && b.Currency.Code != "" && a.Currency.Code != b.Currency.Code {
+		return 0, fmt.Errorf("currency mismatch: %s and %s", a.Currency.Alpha, b.Currency.Alpha)
+	}
+
+	switch {
+	case a.Value < b.Value:
+		return -1, nil
+	case a.Value > b.Value:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// txnAmt 报文中的金额,以最小货币单位表示
+func (a Amount) txnAmt() string {
+	return strconv.FormatInt(a.Value, 10)
+}
+
+func (a Amount) currency() Currency {
+	if a.Currency.Code == "" {
+		return CNY
+	}
+	return a.Currency
+}
+
+// Decimal 以主货币单位表示的金额,如 1234 分为 12.34
+func (a Amount) Decimal() Decimal {
+	return a.currency().Minor(a.Value)
+}
+
+func (a Amount) String() string {
+	return a.Decimal().String() + " " + a.currency().Alpha
+}
+
+// currencyCodeOf 金额未指定币种时使用商户设置的交易币种
+func (up *UnionPay) currencyCodeOf(a Amount) string {
+	if a.Currency.Code != "" {
+		return a.Currency.Code
+	}
+	return up.currencyCode()
+}
+
+// amountKeys 金额域及其币种域
+var amountKeys = map[string]string{
+	"txnAmt":     "currencyCode",
+	"origTxnAmt": "currencyCode",
+	"settleAmt":  "settleCurrencyCode",
+}
+
+// decodeData 将应答中的金额域转换为Amount,供mapstructure解析到应答结构体
+func decodeData(data map[string]string) (m map[string]interface{}, err error) {
+	m = make(map[string]interface{}, len(data))
+	for k, v := range data {
+		m[k] = v
+	}
+
+	for amtKey, curKey := range amountKeys {
+		v, ok := data[amtKey]
+		if !ok {
+			continue
+		}
+		if m[amtKey], err = ParseTxnAmt(v, data[curKey]); err != nil {
+			err = fmt.Errorf("bad %s: %w", amtKey, err)
+			return
+		}
+	}
+
+	// 余额带借贷标识
+	if v, ok := data["balance"]; ok {
+		if m["balance"], err = parseBalance(v, data["currencyCode"]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// notifyAmounts 解析通知中的交易金额及清算金额
+func notifyAmounts(vals url.Values) (txnAmt, settleAmt Amount, err error) {
+	if txnAmt, err = ParseTxnAmt(vals.Get("txnAmt"), vals.Get("currencyCode")); err != nil {
+		err = fmt.Errorf("bad txnAmt: %w", err)
+		return
+	}
+	if settleAmt, err = ParseTxnAmt(vals.Get("settleAmt"), vals.Get("settleCurrencyCode")); err != nil {
+		err = fmt.Errorf("bad settleAmt: %w", err)
+		return
+	}
+	return
+}
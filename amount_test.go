@@ -0,0 +1,164 @@
+package unionpay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	usd, _ := LookupCurrency("USD")
+	jpy, _ := LookupCurrency("JPY")
+	bhd, _ := LookupCurrency("BHD")
+
+	tests := []struct {
+		in   string
+		c    Currency
+		want int64
+		err  error
+	}{
+		{"12.34", CNY, 1234, nil},
+		{"12", CNY, 1200, nil},
+		{"12.3", CNY, 1230, nil},
+		{" 0.01 ", CNY, 1, nil},
+		{"12.", CNY, 1200, nil},
+		{"1.5", usd, 150, nil},
+		{"1500", jpy, 1500, nil},
+		{"1.234", bhd, 1234, nil},
+		{"12.345", CNY, 0, ErrBadAmount},
+		{"1.5", jpy, 0, ErrBadAmount},
+		{"", CNY, 0, ErrBadAmount},
+		{".5", CNY, 0, ErrBadAmount},
+		{"-1", CNY, 0, ErrBadAmount},
+		{"1e3", CNY, 0, ErrBadAmount},
+		{"1,000.00", CNY, 0, ErrBadAmount},
+		{"9999999999.99", CNY, 999999999999, nil},
+		{"10000000000", CNY, 0, ErrAmountOutOfRange},
+		{"99999999999999999999", CNY, 0, ErrAmountOutOfRange},
+	}
+	for _, tt := range tests {
+		a, err := ParseAmount(tt.in, tt.c)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ParseAmount(%q, %s) err = %v, want %v", tt.in, tt.c.Alpha, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %s): %v", tt.in, tt.c.Alpha, err)
+			continue
+		}
+		if a.Value != tt.want || a.Currency != tt.c {
+			t.Errorf("ParseAmount(%q, %s) = %+v, want %d", tt.in, tt.c.Alpha, a, tt.want)
+		}
+	}
+}
+
+func TestParseTxnAmt(t *testing.T) {
+	a, err := ParseTxnAmt("000000001234", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Value != 1234 || a.Currency.Code != "" || a.String() != "12.34 CNY" {
+		t.Errorf("got %+v %s", a, a)
+	}
+
+	a, err = ParseTxnAmt("", "840")
+	if err != nil || !a.IsZero() || a.Currency.Alpha != "USD" {
+		t.Errorf("empty txnAmt = %+v, %v", a, err)
+	}
+
+	for _, in := range []string{"-1", "12.34", "1234567890123", " 1"} {
+		if _, err = ParseTxnAmt(in, "156"); err == nil {
+			t.Errorf("ParseTxnAmt(%q) accepted", in)
+		}
+	}
+}
+
+func TestAmountValidate(t *testing.T) {
+	for _, v := range []int64{1, maxTxnAmt} {
+		if err := Fen(v).Validate(); err != nil {
+			t.Errorf("Validate(%d): %v", v, err)
+		}
+	}
+	for _, v := range []int64{0, -1, maxTxnAmt + 1} {
+		if err := Fen(v).Validate(); err != ErrAmountOutOfRange {
+			t.Errorf("Validate(%d) = %v, want %v", v, err, ErrAmountOutOfRange)
+		}
+	}
+}
+
+func TestAmountCmp(t *testing.T) {
+	usd, _ := LookupCurrency("USD")
+
+	if c, err := Fen(1).Cmp(Fen(2)); err != nil || c != -1 {
+		t.Errorf("1 cmp 2 = %d, %v", c, err)
+	}
+	if c, err := (Amount{Value: 2}).Cmp(Fen(2)); err != nil || c != 0 {
+		t.Errorf("unset currency cmp CNY = %d, %v", c, err)
+	}
+	if _, err := Fen(1).Cmp(NewAmount(1, usd)); err == nil {
+		t.Error("CNY cmp USD did not fail")
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	jpy, _ := LookupCurrency("JPY")
+	kwd, _ := LookupCurrency("KWD")
+
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{Fen(1), "0.01 CNY"},
+		{Fen(123456), "1234.56 CNY"},
+		{Amount{Value: 100}, "1.00 CNY"},
+		{NewAmount(1500, jpy), "1500 JPY"},
+		{NewAmount(1005, kwd), "1.005 KWD"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.want {
+			t.Errorf("%+v.String() = %s, want %s", tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencyCodeOf(t *testing.T) {
+	up := newTestPayment(t)
+	if got := up.currencyCodeOf(Fen(1)); got != "156" {
+		t.Errorf("default currency = %s, want 156", got)
+	}
+
+	up.SetCurrency("USD")
+	if got := up.currencyCodeOf(Amount{Value: 1}); got != "840" {
+		t.Errorf("merchant currency = %s, want 840", got)
+	}
+	if got := up.currencyCodeOf(Fen(1)); got != "156" {
+		t.Errorf("explicit currency = %s, want 156", got)
+	}
+}
+
+func TestDecodeDataAmounts(t *testing.T) {
+	m, err := decodeData(map[string]string{
+		"txnAmt":             "1000",
+		"currencyCode":       "392",
+		"settleAmt":          "6523",
+		"settleCurrencyCode": "156",
+		"orderId":            "ORDER0001",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := m["txnAmt"].(Amount); a.String() != "1000 JPY" {
+		t.Errorf("txnAmt = %s", a)
+	}
+	if a := m["settleAmt"].(Amount); a.String() != "65.23 CNY" {
+		t.Errorf("settleAmt = %s", a)
+	}
+	if m["orderId"] != "ORDER0001" {
+		t.Errorf("orderId = %v", m["orderId"])
+	}
+
+	if _, err = decodeData(map[string]string{"txnAmt": "abc"}); err == nil {
+		t.Error("bad txnAmt accepted")
+	}
+}
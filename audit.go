@@ -0,0 +1,372 @@
+package unionpay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 审计记录类型
+const (
+	AuditRequest  = "request"  // 发往网关的请求,每次实际发送记录一次,重试时记录多次
+	AuditResponse = "response" // 网关应答
+	AuditNotify   = "notify"   // 后台通知
+	AuditForm     = "form"     // 交给浏览器提交的前台表单,生成时记录,不代表已提交
+)
+
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// AuditRecord 审计记录
+// 保存待签名串,参与签名的域及应答原文,不依赖商户系统即可重新验签
+// 记录中含卡号,手机号等原文(上送时已加密的域为密文),审计文件应限制访问
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	MerID       string    `json:"merId,omitempty"`
+	OrderID     string    `json:"orderId,omitempty"`
+	TxnType     string    `json:"txnType,omitempty"`
+	TxnTime     string    `json:"txnTime,omitempty"`
+	Endpoint    string    `json:"endpoint,omitempty"`
+	Canonical   string    `json:"canonical,omitempty"`   // 待签名串或待验签串原文
+	Signed      KVpairs   `json:"signed,omitempty"`      // 参与签名的域,按域名排序,末尾为signature
+	Body        string    `json:"body,omitempty"`        // 应答原文
+	Verified    bool      `json:"verified"`              // 应答或通知验签是否通过,请求恒为true
+	VerifyError string    `json:"verifyError,omitempty"` // 验签失败原因
+	Error       string    `json:"error,omitempty"`       // 网络或应答码错误
+}
+
+// AuditSink 审计记录接收方
+// 请求记录写入失败时不发送请求,应答记录写入失败不影响交易结果,通知记录写入失败时返回错误
+type AuditSink interface {
+	Audit(rec *AuditRecord) error
+}
+
+// SetAuditSink 设置审计记录接收方,WithAccess复制出的UnionPay共享,应在初始化时调用
+func (up *UnionPay) SetAuditSink(s AuditSink) *UnionPay {
+	up.client.audit = s
+	return up
+}
+
+// setSigned 保存待签名串及参与签名的域
+func (rec *AuditRecord) setSigned(vals url.Values, fields []string) {
+	kvs, signature := signedKVpairs(vals, fields)
+	rec.Canonical = kvs.Join("&")
+	if signature != "" {
+		kvs = append(kvs, KVpair{K: "signature", V: signature})
+	}
+	rec.Signed = kvs
+}
+
+func newAuditRecord(now time.Time, kind string, vals url.Values, fields []string) *AuditRecord {
+	rec := &AuditRecord{
+		Time:    now,
+		Kind:    kind,
+		MerID:   vals.Get("merId"),
+		OrderID: vals.Get("orderId"),
+		TxnType: vals.Get("txnType"),
+		TxnTime: vals.Get("txnTime"),
+	}
+	rec.setSigned(vals, fields)
+	return rec
+}
+
+// auditForm 记录交给浏览器提交的前台表单
+func (up *UnionPay) auditForm(kvs KVpairs) error {
+	if up.client.audit == nil {
+		return nil
+	}
+
+	vals := url.Values{}
+	for _, kv := range kvs {
+		vals.Set(kv.K, kv.V)
+	}
+	rec := newAuditRecord(up.now(), AuditForm, vals, nil)
+	rec.Endpoint = frontTransReq
+	rec.Verified = true
+	if err := up.client.audit.Audit(rec); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+// auditRoundTrip 发送前记录请求,收到应答后记录应答及验签结果
+// 位于全部中间件内层,重试及查询请求每次实际发送均有记录
+func (c *unionPayClient) auditRoundTrip(req *Request) (*Response, error) {
+	if c.audit == nil {
+		return c.roundTrip(req)
+	}
+
+	rec := newAuditRecord(c.now(), AuditRequest, req.Form, nil)
+	rec.Endpoint = req.URL.Path
+	rec.Verified = true
+	if err := c.audit.Audit(rec); err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	resp, err := c.roundTrip(req)
+
+	rec = &AuditRecord{
+		Time:     c.now(),
+		Kind:     AuditResponse,
+		MerID:    req.Form.Get("merId"),
+		OrderID:  req.Form.Get("orderId"),
+		TxnType:  req.Form.Get("txnType"),
+		TxnTime:  req.Form.Get("txnTime"),
+		Endpoint: req.URL.Path,
+		Verified: resp != nil,
+	}
+	if resp != nil {
+		vals := url.Values{}
+		for k, v := range resp.Fields {
+			vals.Set(k, v)
+		}
+		rec.setSigned(vals, nil)
+		rec.Body = string(resp.Body)
+	}
+	if err != nil {
+		if _, ok := err.(*SignatureError); ok {
+			rec.Verified = false
+			rec.VerifyError = err.Error()
+		} else {
+			rec.Error = err.Error()
+		}
+	}
+	c.audit.Audit(rec)
+	return resp, err
+}
+
+// auditNotify 记录通知及验签结果
+func (up *UnionPay) auditNotify(vals url.Values, fields []string, verr error) error {
+	if up.client.audit == nil {
+		return nil
+	}
+
+	rec := newAuditRecord(up.now(), AuditNotify, vals, fields)
+	rec.Verified = verr == nil
+	if verr != nil {
+		rec.VerifyError = verr.Error()
+	}
+	if err := up.client.audit.Audit(rec); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+// auditLine 审计文件中的一行,hash = HMAC-SHA256(key, prev + "\n" + seq + "\n" + record)
+// 未设置密钥时为SHA256
+type auditLine struct {
+	Seq    int64           `json:"seq"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash"`
+	Record json.RawMessage `json:"record"`
+}
+
+func auditHash(key []byte, prev string, seq int64, record []byte) string {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(strconv.FormatInt(seq, 10)))
+	h.Write([]byte{'\n'})
+	h.Write(record)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditHead 审计文件最后一条记录的序号及哈希
+type AuditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// FileAuditSink 哈希链JSONL审计文件,每行包含上一行的哈希
+//
+// 使用密钥时,不持有密钥者修改或删除中间任一行均可被VerifyAuditLog发现
+// 哈希链本身无法发现末尾记录被截断,也无法阻止不使用密钥时整条链被重算
+// 应定期将Head()保存到审计文件以外(如另一台主机或工单),校验时作为anchor传入
+//
+// 轮转后新文件的第一行接续上一文件的最后一行,多个文件按顺序构成一条链
+type FileAuditSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	key  []byte
+	head AuditHead
+}
+
+// NewFileAuditSink 打开审计文件,key为HMAC密钥,为空时仅能发现意外损坏
+// 已存在时校验后在末尾继续追加,进程崩溃留下的不完整末行被截去
+func NewFileAuditSink(path string, key []byte) (*FileAuditSink, error) {
+	return NewFileAuditSinkAfter(path, key, AuditHead{})
+}
+
+// NewFileAuditSinkAfter 打开轮转后的审计文件,prev为上一文件的Head,第一行接续prev
+func NewFileAuditSinkAfter(path string, key []byte, prev AuditHead) (*FileAuditSink, error) {
+	s := &FileAuditSink{key: append([]byte(nil), key...)}
+	if err := s.open(path, prev); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileAuditSink) open(path string, prev AuditHead) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	st, err := verifyAuditLog(f, s.key, prev, AuditHead{})
+	if err == nil && st.torn {
+		err = f.Truncate(st.size)
+	} else if err == nil && st.noNewline {
+		_, err = f.Write([]byte{'\n'})
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	s.f, s.head = f, st.head
+	return nil
+}
+
+// Rotate 关闭当前文件,后续记录写入path,path的第一行接续当前文件的最后一行
+func (s *FileAuditSink) Rotate(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.f
+	if err := s.open(path, s.head); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+func (s *FileAuditSink) Audit(rec *AuditRecord) error {
+	record, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := auditLine{Seq: s.head.Seq + 1, Prev: s.head.Hash, Record: record}
+	line.Hash = auditHash(s.key, line.Prev, line.Seq, record)
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if _, err = s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.head = AuditHead{Seq: line.Seq, Hash: line.Hash}
+	return nil
+}
+
+// Head 最后写入的记录,用于在审计文件以外留存锚点
+func (s *FileAuditSink) Head() AuditHead {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.head
+}
+
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// VerifyAuditLog 使用写入时的密钥校验哈希链,返回最后一条记录
+// anchor非零时要求文件包含该锚点记录,可发现锚点之前的末尾截断或整条链重算
+func VerifyAuditLog(r io.Reader, key []byte, anchor AuditHead) (head AuditHead, err error) {
+	return VerifyAuditLogAfter(r, key, AuditHead{}, anchor)
+}
+
+// VerifyAuditLogAfter 校验轮转后的审计文件,prev为上一文件校验返回的最后一条记录
+func VerifyAuditLogAfter(r io.Reader, key []byte, prev, anchor AuditHead) (head AuditHead, err error) {
+	st, err := verifyAuditLog(r, key, prev, anchor)
+	head = st.head
+	if err != nil {
+		return
+	}
+	if st.torn {
+		err = fmt.Errorf("%w: line %d: incomplete", ErrAuditChainBroken, head.Seq+1)
+		return
+	}
+	if anchor.Seq > 0 && !st.anchored {
+		err = fmt.Errorf("%w: anchor %d %s not found", ErrAuditChainBroken, anchor.Seq, anchor.Hash)
+	}
+	return
+}
+
+// auditLogState 审计文件的校验结果
+type auditLogState struct {
+	head      AuditHead
+	size      int64 // 最后一条完整记录结束的位置
+	torn      bool  // 末行不完整
+	noNewline bool  // 末行完整但缺少换行
+	anchored  bool  // 包含锚点记录
+}
+
+func verifyAuditLog(r io.Reader, key []byte, prev, anchor AuditHead) (st auditLogState, err error) {
+	st.head = prev
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		raw, rerr := br.ReadBytes('\n')
+		if rerr != nil && rerr != io.EOF {
+			err = rerr
+			return
+		}
+		last := rerr == io.EOF
+		if last && len(raw) == 0 {
+			return
+		}
+
+		b := bytes.TrimSpace(raw)
+		if len(b) > 0 {
+			seq := st.head.Seq + 1
+			var line auditLine
+			if jerr := json.Unmarshal(b, &line); jerr != nil {
+				if last {
+					// 写入中途崩溃留下的半行
+					st.torn = true
+					return
+				}
+				err = fmt.Errorf("%w: line %d: %s", ErrAuditChainBroken, seq, jerr)
+				return
+			}
+			if line.Seq != seq || line.Prev != st.head.Hash {
+				err = fmt.Errorf("%w: line %d: sequence or previous hash mismatch", ErrAuditChainBroken, seq)
+				return
+			}
+			if !hmac.Equal([]byte(auditHash(key, line.Prev, line.Seq, line.Record)), []byte(line.Hash)) {
+				err = fmt.Errorf("%w: line %d: hash mismatch", ErrAuditChainBroken, seq)
+				return
+			}
+			st.head = AuditHead{Seq: line.Seq, Hash: line.Hash}
+			if line.Seq == anchor.Seq && line.Hash == anchor.Hash {
+				st.anchored = true
+			}
+			st.noNewline = last
+		}
+		st.size += int64(len(raw))
+		if last {
+			return
+		}
+	}
+}
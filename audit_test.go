@@ -0,0 +1,306 @@
+package unionpay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// memoryAuditSink 保存审计记录供测试检查
+type memoryAuditSink struct {
+	records []*AuditRecord
+	err     error
+}
+
+func (s *memoryAuditSink) Audit(rec *AuditRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, rec)
+	return nil
+}
+
+func (s *memoryAuditSink) kinds() string {
+	var kinds []string
+	for _, rec := range s.records {
+		kinds = append(kinds, rec.Kind)
+	}
+	return strings.Join(kinds, ",")
+}
+
+func TestAuditRecordsAtSendTime(t *testing.T) {
+	up := newTestPayment(t)
+	up.SetClock(fixedClock(t, "20240102100000"))
+	sink := &memoryAuditSink{}
+	up.SetAuditSink(sink)
+
+	attempts := 0
+	fakeGateway(up, func(form url.Values) map[string]string {
+		attempts++
+		if attempts == 1 {
+			return nil
+		}
+		return respFields(form, "00", "accNo", "6216261000000000018")
+	})
+
+	if _, err := up.BalanceQuery("BAL20240102001", "6216261000000000018", "123456", "", ""); err == nil {
+		t.Fatal("network failure not returned")
+	}
+	if _, err := up.BalanceQuery("BAL20240102001", "6216261000000000018", "123456", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次实际发送均被记录
+	if got := sink.kinds(); got != "request,response,request,response" {
+		t.Fatalf("records = %s", got)
+	}
+	req := sink.records[0]
+	if req.OrderID != "BAL20240102001" || req.TxnType != "71" {
+		t.Errorf("request record = %+v", req)
+	}
+	// 保存原文,可使用签名证书重新验签
+	last := req.Signed[len(req.Signed)-1]
+	if last.K != "signature" || req.Signed[:len(req.Signed)-1].Join("&") != req.Canonical {
+		t.Fatalf("request signed = %+v, canonical = %s", req.Signed, req.Canonical)
+	}
+	sig, _ := base64.StdEncoding.DecodeString(last.V)
+	if err := up.creds().verifier.Verify([]byte(req.Canonical), sig); err != nil {
+		t.Errorf("request record does not verify: %v", err)
+	}
+	if !req.Time.Equal(up.now()) {
+		t.Errorf("record time %s, want injected clock %s", req.Time, up.now())
+	}
+	if rec := sink.records[1]; rec.Error == "" || rec.Verified {
+		t.Errorf("network failure record = %+v", rec)
+	}
+	rec := sink.records[3]
+	if !rec.Verified || !strings.Contains(rec.Canonical, "accNo=6216261000000000018") || !rec.Time.Equal(up.now()) {
+		t.Errorf("response record = %+v", rec)
+	}
+	if !strings.HasSuffix(rec.Body, "&signature="+rec.Signed[len(rec.Signed)-1].V) {
+		t.Errorf("response body = %s", rec.Body)
+	}
+}
+
+func TestAuditRequestNotSentOnSinkError(t *testing.T) {
+	up := newTestPayment(t)
+	up.SetAuditSink(&memoryAuditSink{err: os.ErrPermission})
+	sent := false
+	fakeGateway(up, func(form url.Values) map[string]string {
+		sent = true
+		return respFields(form, "00")
+	})
+
+	if _, err := up.BalanceQuery("BAL20240102001", "6216261000000000018", "123456", "", ""); err == nil {
+		t.Error("no error when the request record could not be written")
+	}
+	if sent {
+		t.Error("request sent without an audit record")
+	}
+}
+
+func TestAuditNotSignedOnly(t *testing.T) {
+	up := newTestPayment(t)
+	sink := &memoryAuditSink{}
+	up.SetAuditSink(sink)
+
+	if _, err := up.sign(up.creds(), KVpairs{{K: "merId", V: up.MerID()}, {K: "orderId", V: "ORDER0001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 0 {
+		t.Errorf("signing alone wrote %s", sink.kinds())
+	}
+}
+
+func TestAuditNotifyRaw(t *testing.T) {
+	up := newTestPayment(t)
+	sink := &memoryAuditSink{}
+	up.SetAuditSink(sink)
+
+	req := signedNotify(t, up, url.Values{
+		"merId":    {up.MerID()},
+		"orderId":  {"ORDER0001"},
+		"txnType":  {"01"},
+		"accNo":    {"6216261000000000018"},
+		"respCode": {"00"},
+	})
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	if err := up.verifyNotify(req.Form, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sink.kinds(); got != "notify" {
+		t.Fatalf("records = %s", got)
+	}
+	rec := sink.records[0]
+	canonical, sig := canonicalString(req.Form, nil)
+	if !rec.Verified || rec.Canonical != canonical || rec.Signed[len(rec.Signed)-1].V != sig {
+		t.Errorf("notify record = %+v", rec)
+	}
+}
+
+func writeAuditRecords(t *testing.T, path string, key []byte, n int) AuditHead {
+	t.Helper()
+
+	s, err := NewFileAuditSink(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < n; i++ {
+		if err = s.Audit(&AuditRecord{Kind: AuditRequest, OrderID: "ORDER0001"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s.Head()
+}
+
+func TestFileAuditSinkChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key := []byte("audit key")
+	writeAuditRecords(t, path, key, 2)
+	head := writeAuditRecords(t, path, key, 1)
+	if head.Seq != 3 {
+		t.Fatalf("head = %+v, want seq 3", head)
+	}
+
+	b, _ := os.ReadFile(path)
+	if got, err := VerifyAuditLog(bytes.NewReader(b), key, head); err != nil || got != head {
+		t.Errorf("VerifyAuditLog = %+v, %v", got, err)
+	}
+	if _, err := VerifyAuditLog(bytes.NewReader(b), []byte("other key"), AuditHead{}); err == nil {
+		t.Error("verified with another key")
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+
+	// 修改中间一行
+	tampered := strings.Replace(string(b), `"orderId":"ORDER0001"`, `"orderId":"ORDER0002"`, 1)
+	if _, err := VerifyAuditLog(strings.NewReader(tampered), key, AuditHead{}); err == nil {
+		t.Error("tampered record verified")
+	}
+
+	// 截去末行,仅靠锚点发现
+	truncated := strings.Join(lines[:2], "")
+	if _, err := VerifyAuditLog(strings.NewReader(truncated), key, AuditHead{}); err != nil {
+		t.Errorf("truncated log without anchor: %v", err)
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(truncated), key, head); !errors.Is(err, ErrAuditChainBroken) {
+		t.Errorf("truncated log with anchor err = %v, want %v", err, ErrAuditChainBroken)
+	}
+
+	// 不使用密钥时可重算整条链,锚点可以发现
+	var rewritten bytes.Buffer
+	prev := ""
+	for i, l := range lines[:3] {
+		var line auditLine
+		json.Unmarshal([]byte(l), &line)
+		line.Prev = prev
+		line.Hash = auditHash(nil, prev, int64(i+1), line.Record)
+		prev = line.Hash
+		out, _ := json.Marshal(line)
+		rewritten.Write(append(out, '\n'))
+	}
+	if _, err := VerifyAuditLog(bytes.NewReader(rewritten.Bytes()), key, head); err == nil {
+		t.Error("rewritten unkeyed chain verified with the key")
+	}
+}
+
+func TestFileAuditSinkRecoversTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeAuditRecords(t, path, nil, 2)
+
+	b, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(b), "\n")
+	torn := lines[0] + lines[1][:len(lines[1])/2]
+	if err := os.WriteFile(path, []byte(torn), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(torn), nil, AuditHead{}); err == nil {
+		t.Error("torn last line verified")
+	}
+
+	head := writeAuditRecords(t, path, nil, 1)
+	if head.Seq != 2 {
+		t.Errorf("head after recovery = %+v, want seq 2", head)
+	}
+	b, _ = os.ReadFile(path)
+	if got, err := VerifyAuditLog(bytes.NewReader(b), nil, head); err != nil || got != head {
+		t.Errorf("VerifyAuditLog after recovery = %+v, %v", got, err)
+	}
+
+	// 末行完整但缺少换行时保留该行
+	if err := os.WriteFile(path, bytes.TrimSuffix(b, []byte{'\n'}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if head = writeAuditRecords(t, path, nil, 1); head.Seq != 3 {
+		t.Errorf("head after missing newline = %+v, want seq 3", head)
+	}
+}
+
+func TestFileAuditSinkRotate(t *testing.T) {
+	dir := t.TempDir()
+	key := []byte("audit key")
+	first, second := filepath.Join(dir, "audit-1.jsonl"), filepath.Join(dir, "audit-2.jsonl")
+
+	s, err := NewFileAuditSink(first, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		s.Audit(&AuditRecord{Kind: AuditRequest, OrderID: "ORDER0001"})
+	}
+	prev := s.Head()
+	if err = s.Rotate(second); err != nil {
+		t.Fatal(err)
+	}
+	s.Audit(&AuditRecord{Kind: AuditRequest, OrderID: "ORDER0002"})
+	head := s.Head()
+	s.Close()
+
+	if head.Seq != 3 {
+		t.Fatalf("head after rotate = %+v, want seq 3", head)
+	}
+
+	b1, _ := os.ReadFile(first)
+	b2, _ := os.ReadFile(second)
+	got, err := VerifyAuditLog(bytes.NewReader(b1), key, AuditHead{})
+	if err != nil || got != prev {
+		t.Fatalf("first file = %+v, %v", got, err)
+	}
+	if got, err = VerifyAuditLogAfter(bytes.NewReader(b2), key, got, head); err != nil || got != head {
+		t.Errorf("second file = %+v, %v", got, err)
+	}
+
+	// 单独校验轮转后的文件,或接在其他文件之后均失败
+	if _, err = VerifyAuditLog(bytes.NewReader(b2), key, AuditHead{}); !errors.Is(err, ErrAuditChainBroken) {
+		t.Errorf("rotated file without prev err = %v, want %v", err, ErrAuditChainBroken)
+	}
+	if _, err = VerifyAuditLogAfter(bytes.NewReader(b2), key, AuditHead{Seq: 2, Hash: "other"}, AuditHead{}); !errors.Is(err, ErrAuditChainBroken) {
+		t.Errorf("rotated file after another head err = %v, want %v", err, ErrAuditChainBroken)
+	}
+
+	// 重新打开轮转后的文件继续追加
+	s, err = NewFileAuditSinkAfter(second, key, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = s.Audit(&AuditRecord{Kind: AuditRequest, OrderID: "ORDER0003"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Head(); got.Seq != 4 {
+		t.Errorf("head after reopen = %+v, want seq 4", got)
+	}
+	if _, err = NewFileAuditSink(second, key); !errors.Is(err, ErrAuditChainBroken) {
+		t.Errorf("reopen rotated file without prev err = %v, want %v", err, ErrAuditChainBroken)
+	}
+}
@@ -0,0 +1,203 @@
+package unionpay
+
+import (
+	"net/url"
+)
+
+// AuthElementResult 实名认证单个要素的验证结果
+type AuthElementResult int
+
+const (
+	AuthNotChecked  AuthElementResult = iota // 未上送,未验证
+	AuthMatched                              // 一致
+	AuthMismatched                           // 不一致
+	AuthUnconfirmed                          // 所在要素组验证不通过,银联未指明具体要素
+)
+
+func (r AuthElementResult) String() string {
+	switch r {
+	case AuthMatched:
+		return "matched"
+	case AuthMismatched:
+		return "mismatched"
+	case AuthUnconfirmed:
+		return "unconfirmed"
+	}
+	return "not checked"
+}
+
+// AuthenticateResult 实名认证结果
+// 银联只返回整体应答码,不返回逐项结果,各要素的结果由应答码推断:
+// 14,61推断为卡号不一致,66推断为身份信息或手机号所在要素组不一致,77推断为短信验证码不一致
+type AuthenticateResult struct {
+	Matched bool // 所有上送要素均一致
+
+	AccNo      AuthElementResult // 卡号
+	CustomerNm AuthElementResult // 姓名
+	CertifID   AuthElementResult // 证件号码
+	PhoneNo    AuthElementResult // 手机号
+	SmsCode    AuthElementResult // 短信验证码
+
+	QueryID  string
+	RespCode string
+	RespMsg  string
+}
+
+type AuthenticateCardResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	OrderID     string
+	TxnTime     string
+	AccNo       string
+	ReqReserved string
+	Reserved    string
+	QueryID     string
+	RespCode    string
+	RespMsg     string
+}
+
+// SendAuthSms 发送实名认证短信验证码(txnType 77),验证码发送到phoneNo
+func (up *UnionPay) SendAuthSms(orderID, accNo, phoneNo string) (resp *AuthenticateCardResponse, err error) {
+	return up.authenticate("77", "00", orderID, accNo, CustomerInfo{PhoneNo: phoneNo})
+}
+
+// AuthenticateCard 实名认证(txnType 72),验证卡号与姓名,证件号,手机号是否属于同一持卡人
+// 需先调用SendAuthSms获取短信验证码
+// 应答码为验证结论(00,14,61,66,77)时不返回错误,结果通过AuthenticateResult给出,逐项结果为推断值
+// 应答码为03,04,05,报文格式错误,系统错误等非验证结论时返回错误,不能视为要素不一致
+func (up *UnionPay) AuthenticateCard(orderID, accNo string, ci CustomerInfo) (result *AuthenticateResult, err error) {
+	resp, err := up.authenticate("72", "01", orderID, accNo, ci)
+
+	result = &AuthenticateResult{}
+	if err != nil {
+		e, ok := err.(*RespError)
+		if !ok || e.IsUnknown() || !isAuthOutcome(e.Code) {
+			result = nil
+			return
+		}
+		err = nil
+		result.RespCode = e.Code
+		result.RespMsg = e.Msg
+	} else {
+		result.QueryID = resp.QueryID
+		result.RespCode = resp.RespCode
+		result.RespMsg = resp.RespMsg
+	}
+
+	checked := func(v string) AuthElementResult {
+		if v == "" {
+			return AuthNotChecked
+		}
+		return AuthMatched
+	}
+	result.AccNo = AuthMatched
+	result.CustomerNm = checked(ci.CustomerNm)
+	result.CertifID = checked(ci.CertifID)
+	result.PhoneNo = checked(ci.PhoneNo)
+	result.SmsCode = checked(ci.SmsCode)
+
+	unconfirmed := func(r *AuthElementResult) {
+		if *r == AuthMatched {
+			*r = AuthUnconfirmed
+		}
+	}
+
+	switch result.RespCode {
+	case "00":
+		result.Matched = true
+	case "14", "61":
+		// 无效卡号
+		result.AccNo = AuthMismatched
+		result.CustomerNm = AuthNotChecked
+		result.CertifID = AuthNotChecked
+		result.PhoneNo = AuthNotChecked
+		result.SmsCode = AuthNotChecked
+	case "66":
+		// 持卡人身份信息或手机号输入不正确
+		unconfirmed(&result.CustomerNm)
+		unconfirmed(&result.CertifID)
+		unconfirmed(&result.PhoneNo)
+	case "77":
+		// 短信验证码错误或已过期
+		result.SmsCode = AuthMismatched
+	}
+	return
+}
+
+// isAuthOutcome 应答码是否为实名认证的验证结论
+func isAuthOutcome(respCode string) bool {
+	switch respCode {
+	case "14", "61", "66", "77":
+		return true
+	}
+	return false
+}
+
+func (up *UnionPay) authenticate(txnType, txnSubType, orderID, accNo string, ci CustomerInfo) (resp *AuthenticateCardResponse, err error) {
+	cred := up.creds()
+
+	var encAccNo, customerInfo string
+	encAccNo, err = up.encryptData(cred, accNo)
+	if err != nil {
+		return
+	}
+	customerInfo, err = up.customerInfo(cred, ci, accNo)
+	if err != nil {
+		return
+	}
+
+	kvs := KVpairs{}
+
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: txnType})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: txnSubType})
+	kvs = append(kvs, KVpair{K: "bizType", V: "000301"})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "orderId", V: orderID})
+	kvs = append(kvs, KVpair{K: "txnTime", V: up.txnTime()})
+	kvs = append(kvs, KVpair{K: "accType", V: "01"})
+	kvs = append(kvs, KVpair{K: "accNo", V: encAccNo})
+	kvs = append(kvs, KVpair{K: "customerInfo", V: customerInfo})
+	kvs = append(kvs, KVpair{K: "encryptCertId", V: up.encryptCertID(cred)})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	var result AuthenticateCardResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
@@ -0,0 +1,52 @@
+package unionpay
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAuthenticateCard(t *testing.T) {
+	ci := CustomerInfo{CustomerNm: "全渠道", CertifTp: "01", CertifID: "341126197709218366", PhoneNo: "13552535506", SmsCode: "111111"}
+
+	for _, c := range []struct {
+		respCode string
+		wantErr  bool
+		matched  bool
+		accNo    AuthElementResult
+		phoneNo  AuthElementResult
+		smsCode  AuthElementResult
+	}{
+		{respCode: "00", matched: true, accNo: AuthMatched, phoneNo: AuthMatched, smsCode: AuthMatched},
+		{respCode: "14", accNo: AuthMismatched, phoneNo: AuthNotChecked, smsCode: AuthNotChecked},
+		{respCode: "66", accNo: AuthMatched, phoneNo: AuthUnconfirmed, smsCode: AuthMatched},
+		{respCode: "77", accNo: AuthMatched, phoneNo: AuthMatched, smsCode: AuthMismatched},
+		{respCode: "03", wantErr: true},
+		{respCode: "05", wantErr: true},
+		{respCode: "30", wantErr: true}, // 报文格式错误
+		{respCode: "96", wantErr: true}, // 系统错误
+		{respCode: "", wantErr: true},   // 网络异常
+	} {
+		up := newTestPayment(t)
+		fakeGateway(up, func(form url.Values) map[string]string {
+			if c.respCode == "" {
+				return nil
+			}
+			return respFields(form, c.respCode)
+		})
+
+		result, err := up.AuthenticateCard("AUTH20240102001", "6216261000000000018", ci)
+		if c.wantErr {
+			if err == nil || result != nil {
+				t.Errorf("respCode %q: want error, got %+v", c.respCode, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("respCode %q: %v", c.respCode, err)
+			continue
+		}
+		if result.Matched != c.matched || result.AccNo != c.accNo || result.PhoneNo != c.phoneNo || result.SmsCode != c.smsCode {
+			t.Errorf("respCode %q: got %+v", c.respCode, result)
+		}
+	}
+}
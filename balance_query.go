@@ -0,0 +1,129 @@
+package unionpay
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+type BalanceQueryResponse struct {
+	Version      string
+	Encoding     string
+	CertID       string
+	Signature    string
+	SignMethod   string
+	TxnType      string
+	TxnSubType   string
+	BizType      string
+	AccessType   string
+	MerID        string
+	OrderID      string
+	TxnTime      string
+	AccNo        string
+	Balance      Amount // 余额 借方余额(透支)为负数
+	CurrencyCode string // 余额币种
+	ReqReserved  string
+	Reserved     string
+	QueryID      string
+	RespCode     string
+	RespMsg      string
+}
+
+// parseBalance 解析应答中的余额,首位C表示贷方余额(正),D表示借方余额(负),其后为以最小货币单位表示的金额
+func parseBalance(balance, currencyCode string) (a Amount, err error) {
+	if currencyCode != "" {
+		if a.Currency, err = currencyOf(currencyCode); err != nil {
+			return
+		}
+	}
+	a.Value, err = parseSignedBalance(balance)
+	return
+}
+
+// parseSignedBalance 解析带借贷标识的余额,如 C000000012345, D000000000100
+func parseSignedBalance(s string) (int64, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("%w: balance %q", ErrBadAmount, s)
+	}
+
+	var sign int64
+	switch s[0] {
+	case 'C':
+		sign = 1
+	case 'D':
+		sign = -1
+	default:
+		return 0, fmt.Errorf("%w: balance %q", ErrBadAmount, s)
+	}
+
+	n, err := strconv.ParseUint(s[1:], 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("%w: balance %q", ErrBadAmount, s)
+	}
+	return sign * int64(n), nil
+}
+
+// BalanceQuery 余额查询(txnType 71),适用于借记卡及预付卡
+// accNo和pin为明文,发送前分别使用加密证书加密
+func (up *UnionPay) BalanceQuery(orderID, accNo, pin, reqReserved, reserved string) (resp *BalanceQueryResponse, err error) {
+	cred := up.creds()
+
+	var encAccNo, ci string
+	encAccNo, err = up.encryptData(cred, accNo)
+	if err != nil {
+		return
+	}
+	ci, err = up.customerInfo(cred, CustomerInfo{Pin: pin}, accNo)
+	if err != nil {
+		return
+	}
+
+	kvs := KVpairs{}
+
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "71"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: "00"})
+	kvs = append(kvs, KVpair{K: "bizType", V: "000301"})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "orderId", V: orderID})
+	kvs = append(kvs, KVpair{K: "txnTime", V: up.txnTime()})
+	kvs = append(kvs, KVpair{K: "accType", V: "01"})
+	kvs = append(kvs, KVpair{K: "accNo", V: encAccNo})
+	kvs = append(kvs, KVpair{K: "customerInfo", V: ci})
+	kvs = append(kvs, KVpair{K: "encryptCertId", V: up.encryptCertID(cred)})
+	kvs = append(kvs, KVpair{K: "reqReserved", V: reqReserved})
+	kvs = append(kvs, KVpair{K: "reserved", V: reserved})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	var result BalanceQueryResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
@@ -0,0 +1,47 @@
+package unionpay
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestBalanceQuery(t *testing.T) {
+	for _, c := range []struct {
+		balance string
+		want    int64
+	}{
+		{balance: "C000000012345", want: 12345},
+		{balance: "D000000000100", want: -100},
+		{balance: "C000000000000", want: 0},
+	} {
+		up := newTestPayment(t)
+		fakeGateway(up, func(form url.Values) map[string]string {
+			if form.Get("txnType") != "71" || form.Get("customerInfo") == "" {
+				t.Errorf("unexpected request %v", form)
+			}
+			return respFields(form, "00",
+				"accNo", form.Get("accNo"),
+				"balance", c.balance,
+				"currencyCode", "156",
+				"queryId", "202401021400001234567",
+			)
+		})
+
+		resp, err := up.BalanceQuery("BAL20240102001", "6216261000000000018", "123456", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Balance; got.Value != c.want || got.Currency.Code != "156" || resp.CurrencyCode != "156" {
+			t.Errorf("balance %s: got %v, want %d 156", c.balance, got, c.want)
+		}
+	}
+}
+
+func TestParseSignedBalance(t *testing.T) {
+	for _, bad := range []string{"", "C", "12345", "X000000012345", "C-00000012345", "C0000000123.4"} {
+		if _, err := parseSignedBalance(bad); !errors.Is(err, ErrBadAmount) {
+			t.Errorf("%q: want error", bad)
+		}
+	}
+}
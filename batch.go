@@ -0,0 +1,392 @@
+package unionpay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const batchTrans = "/gateway/api/batchTrans.do"
+
+var (
+	ErrBatchIsEmpty       = errors.New("batch has no records")
+	ErrBatchMixedCurrency = errors.New("batch records have different currencies")
+	ErrBatchBadField      = errors.New("bad batch record field")
+)
+
+// BatchRecord 批量文件中的一条明细
+type BatchRecord struct {
+	OrderID     string // 商户订单号
+	AccNo       string // 账号
+	AccName     string // 户名
+	TxnAmt      Amount // 交易金额
+	ReqReserved string // 请求方保留域
+}
+
+// validate 明细各域写入以|分隔、\r\n换行的批量文件,按数据元字典校验且不能包含分隔符
+func (r BatchRecord) validate() error {
+	for _, f := range []KVpair{
+		{K: "orderId", V: r.OrderID},
+		{K: "accNo", V: r.AccNo},
+		{K: "accName", V: r.AccName},
+		{K: "reqReserved", V: r.ReqReserved},
+	} {
+		if err := validateFileField(f.K, f.V); err != nil {
+			return fmt.Errorf("%w: order %q: %w", ErrBatchBadField, r.OrderID, err)
+		}
+	}
+	return nil
+}
+
+// Batch 批量交易(txnType 21),通过NewBatchPayout/NewBatchCollection创建
+type Batch struct {
+	BatchNo string // 批次号 当天唯一 0001-9999
+
+	txnSubType string
+	bizType    string
+	records    []BatchRecord
+}
+
+// NewBatchPayout 批量代付
+func NewBatchPayout(batchNo string) *Batch {
+	return &Batch{BatchNo: batchNo, txnSubType: "03", bizType: "000401"}
+}
+
+// NewBatchCollection 批量代收
+func NewBatchCollection(batchNo string) *Batch {
+	return &Batch{BatchNo: batchNo, txnSubType: "02", bizType: "000501"}
+}
+
+func (b *Batch) Add(r BatchRecord) *Batch {
+	b.records = append(b.records, r)
+	return b
+}
+
+func (b *Batch) TotalQty() int {
+	return len(b.records)
+}
+
+// TotalAmt 总金额,未指定币种的明细按人民币计
+func (b *Batch) TotalAmt() (Amount, error) {
+	return b.total(CNY)
+}
+
+// total 总金额,同一批次的明细必须使用同一币种,未指定币种的明细使用def
+func (b *Batch) total(def Currency) (total Amount, err error) {
+	total.Currency = def
+	for i, r := range b.records {
+		c := r.TxnAmt.Currency
+		if c.Code == "" {
+			c = def
+		}
+		if i > 0 && c.Code != total.Currency.Code {
+			err = fmt.Errorf("%w: order %s is %s, want %s", ErrBatchMixedCurrency, r.OrderID, c.Alpha, total.Currency.Alpha)
+			return
+		}
+		total.Value += r.TxnAmt.Value
+		total.Currency = c
+	}
+	return
+}
+
+// File 生成批量文件内容,未指定币种的明细按人民币计
+// 首行为汇总: 商户代码|批次号|总笔数|总金额|交易日期
+// 明细行: 序号|商户订单号|账号|户名|交易金额|交易币种|请求方保留域
+// txnTime为批次的订单发送时间 YYYYMMDDHHmmss,明细各域不能包含分隔符|及换行
+func (b *Batch) File(merID, txnTime string) ([]byte, error) {
+	return b.file(merID, txnTime, CNY)
+}
+
+// file 生成批量文件内容,未指定币种的明细使用def
+func (b *Batch) file(merID, txnTime string, def Currency) ([]byte, error) {
+	if _, err := ParseTxnTime(txnTime); err != nil {
+		return nil, fmt.Errorf("bad txnTime %q: %s", txnTime, err)
+	}
+	total, err := b.total(def)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range b.records {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	buff := bytes.NewBufferString("")
+	fmt.Fprintf(buff, "%s|%s|%d|%s|%s\r\n", merID, b.BatchNo, b.TotalQty(), total.txnAmt(), txnTime[:8])
+	for i, r := range b.records {
+		fmt.Fprintf(buff, "%d|%s|%s|%s|%s|%s|%s\r\n",
+			i+1, r.OrderID, r.AccNo, r.AccName, r.TxnAmt.txnAmt(), total.Currency.Code, r.ReqReserved)
+	}
+	return buff.Bytes(), nil
+}
+
+// deflateBase64 银联批量文件及结果文件均使用deflate压缩后Base64编码
+func deflateBase64(data []byte) (string, error) {
+	buff := bytes.NewBufferString("")
+	w := zlib.NewWriter(buff)
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buff.Bytes()), nil
+}
+
+func inflateBase64(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+type BatchTransResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	BatchNo     string
+	TxnTime     string
+	ReqReserved string
+	Reserved    string
+	RespCode    string
+	RespMsg     string
+}
+
+// BatchTrans 提交批量交易,应答00仅表示批次已受理,结果通过BatchQuery获取
+func (up *UnionPay) BatchTrans(b *Batch, notifyURL, reqReserved string) (resp *BatchTransResponse, err error) {
+	cred := up.creds()
+
+	if b.TotalQty() == 0 {
+		err = ErrBatchIsEmpty
+		return
+	}
+	for _, r := range b.records {
+		if err = r.TxnAmt.Validate(); err != nil {
+			err = fmt.Errorf("order %s: %s", r.OrderID, err)
+			return
+		}
+	}
+
+	txnTime := up.txnTime()
+
+	total, err := b.total(up.txnCurrency())
+	if err != nil {
+		return
+	}
+
+	var file []byte
+	file, err = b.file(up.mchID, txnTime, up.txnCurrency())
+	if err != nil {
+		return
+	}
+
+	var fileContent string
+	fileContent, err = deflateBase64(file)
+	if err != nil {
+		return
+	}
+
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "21"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: b.txnSubType})
+	kvs = append(kvs, KVpair{K: "bizType", V: b.bizType})
+	kvs = append(kvs, KVpair{K: "backUrl", V: notifyURL})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "batchNo", V: b.BatchNo})
+	kvs = append(kvs, KVpair{K: "txnTime", V: txnTime})
+	kvs = append(kvs, KVpair{K: "totalQty", V: strconv.Itoa(b.TotalQty())})
+	kvs = append(kvs, KVpair{K: "totalAmt", V: total.txnAmt()})
+	kvs = append(kvs, KVpair{K: "fileContent", V: fileContent})
+	kvs = append(kvs, KVpair{K: "reqReserved", V: reqReserved})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + batchTrans)
+	if err != nil {
+		return
+	}
+
+	var result BatchTransResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
+
+// BatchResult 批量结果文件中的一条明细
+type BatchResult struct {
+	OrderID  string // 商户订单号
+	AccNo    string // 账号
+	TxnAmt   Amount // 交易金额
+	QueryID  string // 交易查询流水号
+	RespCode string // 应答码
+	RespMsg  string // 应答信息
+}
+
+type BatchQueryResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	BatchNo     string
+	TxnTime     string
+	FileContent string
+	FileName    string
+	RespCode    string
+	RespMsg     string
+
+	Results []BatchResult
+}
+
+// BatchQuery 查询批量交易结果(txnType 22),下载并解析结果文件
+// batchTxnTime为提交批次时的txnTime
+func (up *UnionPay) BatchQuery(b *Batch, batchTxnTime string) (resp *BatchQueryResponse, err error) {
+	cred := up.creds()
+
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "22"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: b.txnSubType})
+	kvs = append(kvs, KVpair{K: "bizType", V: b.bizType})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "batchNo", V: b.BatchNo})
+	kvs = append(kvs, KVpair{K: "txnTime", V: batchTxnTime})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + batchTrans)
+	if err != nil {
+		return
+	}
+
+	var result BatchQueryResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	if result.FileContent != "" {
+		var file []byte
+		file, err = inflateBase64(result.FileContent)
+		if err != nil {
+			return
+		}
+
+		var total Amount
+		total, err = b.total(up.txnCurrency())
+		if err != nil {
+			return
+		}
+
+		result.Results, err = ParseBatchResultFile(file, total.Currency)
+		if err != nil {
+			return
+		}
+	}
+
+	resp = &result
+	return
+}
+
+// ParseBatchResultFile 解析批量结果文件,结果文件不含币种,金额按c的最小货币单位解析
+// 首行为汇总信息,明细行: 序号|商户订单号|账号|交易金额|交易查询流水号|应答码|应答信息
+func ParseBatchResultFile(file []byte, c Currency) (results []BatchResult, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	for line := 0; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 0 || text == "" {
+			continue
+		}
+
+		f := strings.Split(text, "|")
+		if len(f) < 7 {
+			err = fmt.Errorf("bad batch result line %d: %q", line+1, text)
+			return
+		}
+
+		var amt Amount
+		amt, err = ParseTxnAmt(f[3], c.Code)
+		if err != nil {
+			err = fmt.Errorf("bad batch result line %d: %s", line+1, err)
+			return
+		}
+
+		results = append(results, BatchResult{
+			OrderID:  f[1],
+			AccNo:    f[2],
+			TxnAmt:   amt,
+			QueryID:  f[4],
+			RespCode: f[5],
+			RespMsg:  f[6],
+		})
+	}
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,147 @@
+package unionpay
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func testBatch() *Batch {
+	return NewBatchPayout("0001").
+		Add(BatchRecord{OrderID: "BATCH20240102001", AccNo: "6216261000000000018", AccName: "全渠道", TxnAmt: Amount{Value: 30000}, ReqReserved: "salary 01"}).
+		Add(BatchRecord{OrderID: "BATCH20240102002", AccNo: "6221558812340000", AccName: "互联网", TxnAmt: Amount{Value: 970000}})
+}
+
+func TestBatchFileGolden(t *testing.T) {
+	got, err := testBatch().File("777290058110048", "20240102140000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "batch_payout.golden")
+	if *update {
+		if err = ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("batch file mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+var usd, _ = LookupCurrency("USD")
+
+func TestBatchMixedCurrency(t *testing.T) {
+	b := testBatch().Add(BatchRecord{OrderID: "BATCH20240102003", AccNo: "6216261000000000018", AccName: "全渠道", TxnAmt: NewAmount(100, usd)})
+
+	if _, err := b.File("777290058110048", "20240102140000"); !errors.Is(err, ErrBatchMixedCurrency) {
+		t.Fatalf("File: %v", err)
+	}
+
+	up := newTestPayment(t)
+	fakeGateway(up, func(url.Values) map[string]string {
+		t.Fatal("mixed currency batch sent")
+		return nil
+	})
+	if _, err := up.BatchTrans(b, "https://example.com/notify", ""); err == nil {
+		t.Fatal("BatchTrans: want error")
+	}
+}
+
+func TestParseBatchResultFile(t *testing.T) {
+	file, err := ioutil.ReadFile(filepath.Join("testdata", "batch_result.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ParseBatchResultFile(file, CNY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("%d results, want 2", len(results))
+	}
+
+	want := BatchResult{
+		OrderID:  "BATCH20240102002",
+		AccNo:    "6221558812340000",
+		TxnAmt:   Fen(970000),
+		QueryID:  "202401021400001234568",
+		RespCode: "61",
+		RespMsg:  "账户余额不足",
+	}
+	if results[1] != want {
+		t.Errorf("got %+v\nwant %+v", results[1], want)
+	}
+
+	if _, err = ParseBatchResultFile([]byte("head\r\n1|only|three\r\n"), CNY); err == nil {
+		t.Error("short line: want error")
+	}
+}
+
+func TestBatchFileValidate(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		txnTime string
+		rec     BatchRecord
+	}{
+		{name: "empty txnTime", txnTime: ""},
+		{name: "short txnTime", txnTime: "202401"},
+		{name: "bad txnTime", txnTime: "2024010214000x"},
+		{name: "orderId separator", txnTime: "20240102140000", rec: BatchRecord{OrderID: "BATCH|003"}},
+		{name: "reqReserved newline", txnTime: "20240102140000", rec: BatchRecord{OrderID: "BATCH20240102003", ReqReserved: "a\r\n4|x|y"}},
+		{name: "accName separator", txnTime: "20240102140000", rec: BatchRecord{OrderID: "BATCH20240102003", AccName: "张|三"}},
+		{name: "orderId format", txnTime: "20240102140000", rec: BatchRecord{OrderID: "BATCH-003"}},
+	} {
+		b := testBatch()
+		if c.rec.OrderID != "" {
+			c.rec.AccNo, c.rec.TxnAmt = "6216261000000000018", Fen(100)
+			if c.rec.AccName == "" {
+				c.rec.AccName = "全渠道"
+			}
+			b.Add(c.rec)
+		}
+		_, err := b.File("777290058110048", c.txnTime)
+		if err == nil {
+			t.Errorf("%s: want error", c.name)
+		} else if c.rec.OrderID != "" {
+			var fe *FieldError
+			if !errors.Is(err, ErrBatchBadField) || !errors.As(err, &fe) {
+				t.Errorf("%s: %v, want %v with a FieldError", c.name, err, ErrBatchBadField)
+			}
+		}
+	}
+}
+
+func TestBatchTransMerchantCurrency(t *testing.T) {
+	up := newTestPayment(t).SetCurrency("USD")
+
+	var file []byte
+	fakeGateway(up, func(form url.Values) map[string]string {
+		var err error
+		if file, err = inflateBase64(form.Get("fileContent")); err != nil {
+			t.Fatal(err)
+		}
+		return respFields(form, "00", "batchNo", form.Get("batchNo"))
+	})
+
+	// 未指定币种的明细使用商户的交易币种,与指定为USD的明细属于同一币种
+	b := testBatch().Add(BatchRecord{OrderID: "BATCH20240102003", AccNo: "6216261000000000018", AccName: "全渠道", TxnAmt: NewAmount(100, usd)})
+	if _, err := up.BatchTrans(b, "https://example.com/notify", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(file), "|840|"); n != 3 {
+		t.Errorf("%d USD records in\n%s", n, file)
+	}
+}
@@ -0,0 +1,436 @@
+package unionpay
+
+import (
+	"net/http"
+	"net/url"
+)
+
+var billPayParamMap = map[string]bool{
+	"version":        true,  // 版本号 固定填写5.0.0
+	"encoding":       true,  // 编码方式 默认值 UTF-8
+	"certId":         true,  // 证书id
+	"signature":      true,  // 签名 填写对报文摘要的签名
+	"signMethod":     true,  // 签名方式 取值：01 表示采用的是RSA
+	"txnType":        true,  // 交易类型 取值：13 账单支付
+	"txnSubType":     true,  // 交易子类 01:前台缴费 02:后台缴费
+	"bizType":        true,  // 产品类型 000601
+	"channelType":    true,  // 渠道类型 07:互联网 08:移动
+	"frontUrl":       false, // 前台通知地址 前台缴费时上送
+	"backUrl":        true,  // 后台通知地址
+	"accessType":     true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
+	"merId":          true,  // 商户代码
+	"acqInsCode":     false, // 收单机构代码 收单机构接入时必须上送
+	"orderId":        true,  // 商户订单号 商户端生成
+	"txnTime":        true,  // 订单发送时间 商户发送交易时间
+	"txnAmt":         true,  // 交易金额 单位为分
+	"currencyCode":   true,  // 交易币种 默认为156
+	"bussCode":       true,  // 业务代码 账单类型,如水费,电费,燃气费
+	"billQueryInfo":  false, // 账单查询要素 组合域,如 {usr_num=缴费户号}
+	"billDetailInfo": false, // 账单详细信息 账单查询返回后原样上送
+	"accType":        false, // 账号类型 后台缴费时上送
+	"accNo":          false, // 账号 后台缴费时上送,使用加密证书公钥加密
+	"encryptCertId":  false, // 加密证书id 上送加密信息时必送
+	"customerInfo":   false, // 银行卡验证信息及身份信息 后台缴费时上送
+	"reqReserved":    false, // 请求方保留域 商户自定义保留域，交易应答时会原样返回
+	"reserved":       false, // 保留域
+	"orderDesc":      false, // 订单描述
+	"subMerId":       false, // 二级商户代码 商户类型为平台商户接入时必须上送
+	"subMerName":     false, // 二级商户全称 商户类型为平台商户接入时必须上送
+	"subMerAbbr":     false, // 二级商户简称 商户类型为平台商户接入时必须上送
+}
+
+var billQueryParamMap = map[string]bool{
+	"version":       true,  // 版本号 固定填写5.0.0
+	"encoding":      true,  // 编码方式 默认值 UTF-8
+	"certId":        true,  // 证书id
+	"signature":     true,  // 签名 填写对报文摘要的签名
+	"signMethod":    true,  // 签名方式 取值：01 表示采用的是RSA
+	"txnType":       true,  // 交易类型 取值：73 账单查询
+	"txnSubType":    true,  // 交易子类 取值：01
+	"bizType":       true,  // 产品类型 000601
+	"channelType":   true,  // 渠道类型 07:互联网 08:移动
+	"accessType":    true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
+	"merId":         true,  // 商户代码
+	"acqInsCode":    false, // 收单机构代码 收单机构接入时必须上送
+	"orderId":       true,  // 商户订单号 商户端生成
+	"txnTime":       true,  // 订单发送时间 商户发送交易时间
+	"bussCode":      true,  // 业务代码 账单类型,如水费,电费,燃气费
+	"billQueryInfo": true,  // 账单查询要素 组合域,如 {usr_num=缴费户号}
+	"subMerId":      false, // 二级商户代码 商户类型为平台商户接入时必须上送
+	"subMerName":    false, // 二级商户全称 商户类型为平台商户接入时必须上送
+	"subMerAbbr":    false, // 二级商户简称 商户类型为平台商户接入时必须上送
+}
+
+// Bill 账单查询返回的待缴账单
+type Bill struct {
+	UsrNum string // 缴费户号
+	UsrNm  string // 户名
+	Amount Amount // 应缴金额
+
+	QueryInfo  string            // 账单查询要素原文,含查询时上送的全部要素,缴费时原样上送
+	DetailInfo string            // 账单详细信息原文,缴费时原样上送
+	Fields     map[string]string // 全部子域
+}
+
+type BillQueryResponse struct {
+	Version        string
+	Encoding       string
+	CertID         string
+	Signature      string
+	SignMethod     string
+	TxnType        string
+	TxnSubType     string
+	BizType        string
+	AccessType     string
+	MerID          string
+	OrderID        string
+	TxnTime        string
+	BussCode       string
+	BillQueryInfo  string
+	BillDetailInfo string
+	ReqReserved    string
+	Reserved       string
+	RespCode       string
+	RespMsg        string
+}
+
+// Bill 解析账单详细信息
+func (r *BillQueryResponse) Bill() (bill *Bill, err error) {
+	fields := ParseComposite(r.BillDetailInfo)
+	bill = &Bill{
+		UsrNum:     fields["usr_num"],
+		UsrNm:      fields["usr_nm"],
+		QueryInfo:  r.BillQueryInfo,
+		DetailInfo: r.BillDetailInfo,
+		Fields:     fields,
+	}
+	bill.Amount, err = parseAmountField(fields, "query_amt", CNY)
+	return
+}
+
+// BillQuery 账单查询(txnType 73),按缴费户号及extraQueryInfo中的其他查询要素查询待缴账单
+func (up *UnionPay) BillQuery(orderID, bussCode, usrNum string, extraQueryInfo KVpairs) (resp *BillQueryResponse, err error) {
+	cred := up.creds()
+
+	queryInfo := BuildComposite(append(KVpairs{{K: "usr_num", V: usrNum}}, extraQueryInfo...))
+
+	params := make(map[string]string)
+	params["version"] = cred.version()       //版本号
+	params["encoding"] = "UTF-8"             //编码方式
+	params["certId"] = cred.certID           //证书id
+	params["signMethod"] = cred.signMethod() //签名方法
+	params["txnType"] = "73"                 //交易类型
+	params["txnSubType"] = "01"              //交易子类
+	params["bizType"] = "000601"             //业务类型
+	params["channelType"] = "07"             //渠道类型
+	params["merId"] = up.mchID               //商户代码
+	params["orderId"] = orderID              //商户订单号
+	params["txnTime"] = up.txnTime()         //订单发送时间
+	params["bussCode"] = bussCode            //业务代码
+	params["billQueryInfo"] = queryInfo      //账单查询要素
+
+	up.access.setParams(params) //接入类型及二级商户信息
+
+	kvs, err := GenKVpairs(billQueryParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	var result BillQueryResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+	if result.BillQueryInfo == "" {
+		// 应答未返回查询要素时使用上送的查询要素
+		result.BillQueryInfo = queryInfo
+	}
+
+	resp = &result
+	return
+}
+
+// FrontBillPay 前台缴费,返回自动提交到银联页面的html
+func (up *UnionPay) FrontBillPay(orderID string, amount Amount, bussCode string, bill *Bill, returnURL, notifyURL string, extraParams map[string]string) (html string, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params := up.initBillPayParams(cred, orderID, amount, bussCode, bill, notifyURL, extraParams)
+	params["txnSubType"] = "01"
+	params["frontUrl"] = returnURL
+
+	kvs, err := GenKVpairs(billPayParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+	html, err = up.checkoutHTML(kvs)
+	return
+}
+
+type BillPayResponse struct {
+	Version        string
+	Encoding       string
+	CertID         string
+	Signature      string
+	SignMethod     string
+	TxnType        string
+	TxnSubType     string
+	BizType        string
+	AccessType     string
+	MerID          string
+	OrderID        string
+	TxnTime        string
+	TxnAmt         Amount
+	BussCode       string
+	BillQueryInfo  string
+	BillDetailInfo string
+	ReqReserved    string
+	Reserved       string
+	QueryID        string
+	RespCode       string
+	RespMsg        string
+}
+
+// BackBillPay 后台缴费,accNo为明文卡号,发送前使用加密证书加密
+func (up *UnionPay) BackBillPay(orderID string, amount Amount, bussCode string, bill *Bill, accNo, notifyURL string, extraParams map[string]string) (resp *BillPayResponse, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params := up.initBillPayParams(cred, orderID, amount, bussCode, bill, notifyURL, extraParams)
+	params["txnSubType"] = "02"
+	params["accType"] = "01"
+	params["accNo"], err = up.encryptData(cred, accNo)
+	if err != nil {
+		return
+	}
+	params["encryptCertId"] = up.encryptCertID(cred)
+
+	kvs, err := GenKVpairs(billPayParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	var result BillPayResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
+
+func (up *UnionPay) initBillPayParams(cred *credentials, orderID string, amount Amount, bussCode string, bill *Bill, notifyURL string, extraParams map[string]string) (params map[string]string) {
+	params = make(map[string]string)
+
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "UTF-8"                       //编码方式
+	params["certId"] = cred.certID                     //证书id
+	params["signMethod"] = cred.signMethod()           //签名方法
+	params["txnType"] = "13"                           //交易类型
+	params["bizType"] = "000601"                       //业务类型
+	params["channelType"] = "07"                       //渠道类型
+	params["merId"] = up.mchID                         //商户代码
+	params["backUrl"] = notifyURL                      //后台通知地址
+	params["orderId"] = orderID                        //商户订单号
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["txnTime"] = up.txnTime()                   //订单发送时间
+	params["txnAmt"] = amount.txnAmt()                 //交易金额，最小货币单位
+	params["bussCode"] = bussCode                      //业务代码
+
+	if bill != nil {
+		params["billQueryInfo"] = bill.QueryInfo
+		if params["billQueryInfo"] == "" {
+			params["billQueryInfo"] = BuildComposite(KVpairs{{K: "usr_num", V: bill.UsrNum}})
+		}
+		params["billDetailInfo"] = bill.DetailInfo
+	}
+
+	if extraParams != nil {
+		for k, v := range extraParams {
+			_, ok := billPayParamMap[k]
+			if ok {
+				params[k] = v
+			}
+		}
+	}
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
+	return
+}
+
+type BillPayNotifyResponse struct {
+	Version            string
+	Encoding           string
+	CertID             string
+	Signature          string
+	SignMethod         string
+	TxnType            string
+	TxnSubType         string
+	BizType            string
+	AccessType         string
+	MerID              string
+	OrderID            string
+	TxnTime            string
+	CurrencyCode       string
+	TxnAmt             Amount // 交易金额，以币种的最小货币单位表示
+	BussCode           string // 业务代码
+	BillQueryInfo      string // 账单查询要素
+	BillDetailInfo     string // 账单详细信息
+	AccNo              string
+	PayCardType        string
+	ReqReserved        string
+	Reserved           string
+	QueryID            string
+	TraceNo            string
+	TraceTime          string
+	SettleDate         string
+	SettleCurrencyCode string
+	SettleAmt          Amount
+	RespCode           string
+	RespMsg            string
+}
+
+// Bill 解析通知中的账单信息
+func (r *BillPayNotifyResponse) Bill() (bill *Bill, err error) {
+	q := &BillQueryResponse{BillDetailInfo: r.BillDetailInfo}
+	return q.Bill()
+}
+
+func (up *UnionPay) BillPayNotify(req *http.Request) (resp *BillPayNotifyResponse, err error) {
+	if err = req.ParseForm(); err != nil {
+		return
+	}
+	vals := req.Form
+
+	if len(vals) == 0 {
+		err = ErrNotifyDataIsEmpty
+		return
+	}
+
+	var fields = []string{
+		"version",
+		"encoding",
+		"certId",
+		"signature",
+		"signMethod",
+		"txnType",
+		"txnSubType",
+		"bizType",
+		"accessType",
+		"merId",
+		"orderId",
+		"txnTime",
+		"currencyCode",
+		"txnAmt",
+		"bussCode",
+		"billQueryInfo",
+		"billDetailInfo",
+		"accNo",
+		"payCardType",
+		"reqReserved",
+		"reserved",
+		"queryId",
+		"traceNo",
+		"traceTime",
+		"settleDate",
+		"settleCurrencyCode",
+		"settleAmt",
+		"respCode",
+		"respMsg",
+	}
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
+	}
+
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
+		return
+	}
+
+	resp = &BillPayNotifyResponse{
+		Version:            vals.Get("version"),
+		Encoding:           vals.Get("encoding"),
+		CertID:             vals.Get("certId"),
+		Signature:          vals.Get("signature"),
+		SignMethod:         vals.Get("signMethod"),
+		TxnType:            vals.Get("txnType"),
+		TxnSubType:         vals.Get("txnSubType"),
+		BizType:            vals.Get("bizType"),
+		AccessType:         vals.Get("accessType"),
+		MerID:              vals.Get("merId"),
+		OrderID:            vals.Get("orderId"),
+		TxnTime:            vals.Get("txnTime"),
+		CurrencyCode:       vals.Get("currencyCode"),
+		TxnAmt:             txnAmt,
+		BussCode:           vals.Get("bussCode"),
+		BillQueryInfo:      vals.Get("billQueryInfo"),
+		BillDetailInfo:     vals.Get("billDetailInfo"),
+		AccNo:              vals.Get("accNo"),
+		PayCardType:        vals.Get("payCardType"),
+		ReqReserved:        vals.Get("reqReserved"),
+		Reserved:           vals.Get("reserved"),
+		QueryID:            vals.Get("queryId"),
+		TraceNo:            vals.Get("traceNo"),
+		TraceTime:          vals.Get("traceTime"),
+		SettleDate:         vals.Get("settleDate"),
+		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
+		SettleAmt:          settleAmt,
+		RespCode:           vals.Get("respCode"),
+		RespMsg:            vals.Get("respMsg"),
+	}
+
+	return
+}
@@ -0,0 +1,56 @@
+package unionpay
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestBillQueryInfoRoundTrip(t *testing.T) {
+	up := newTestPayment(t)
+
+	var payQueryInfo string
+	fakeGateway(up, func(form url.Values) map[string]string {
+		switch form.Get("txnType") {
+		case "73":
+			return respFields(form, "00",
+				"bussCode", form.Get("bussCode"),
+				"billDetailInfo", "{usr_num=10001&usr_nm=张三&query_amt=12345}",
+			)
+		case "13":
+			payQueryInfo = form.Get("billQueryInfo")
+			return respFields(form, "00", "queryId", "202401021400001234567")
+		}
+		return nil
+	})
+
+	q, err := up.BillQuery("BILL20240102001", "J19800000001", "10001", KVpairs{{K: "area_code", V: "310000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bill, err := q.Bill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bill.Amount != Fen(12345) || bill.UsrNm != "张三" {
+		t.Errorf("unexpected bill %+v", bill)
+	}
+
+	if _, err = up.BackBillPay("BILL20240102002", bill.Amount, "J19800000001", bill, "6216261000000000018", "https://example.com/notify", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{usr_num=10001&area_code=310000}"; payQueryInfo != want {
+		t.Errorf("billQueryInfo %q, want %q", payQueryInfo, want)
+	}
+}
+
+func TestBillQueryValidatesParams(t *testing.T) {
+	up := newTestPayment(t)
+	fakeGateway(up, func(url.Values) map[string]string {
+		t.Fatal("request sent without bussCode")
+		return nil
+	})
+
+	if _, err := up.BillQuery("BILL20240102001", "", "10001", nil); err == nil {
+		t.Fatal("want error for empty bussCode")
+	}
+}
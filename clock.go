@@ -0,0 +1,182 @@
+package unionpay
+
+import (
+	"fmt"
+	"time"
+)
+
+// Beijing 北京时间,txnTime等时间域均使用北京时间
+var Beijing = loadBeijing()
+
+func loadBeijing() *time.Location {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		// 系统缺少时区数据时使用固定的UTC+8,中国自1991年起不再实行夏令时
+		return time.FixedZone("CST", 8*60*60)
+	}
+	return loc
+}
+
+// Clock 时钟,测试时可注入固定时间
+type Clock interface {
+	Now() time.Time
+}
+
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// clockBox atomic.Value要求存入的值类型一致,nil表示使用系统时间
+type clockBox struct {
+	Clock
+}
+
+// SetClock 设置时钟,默认使用系统时间,可与交易并发调用
+// WithAccess等复制出的UnionPay共享时钟
+func (up *UnionPay) SetClock(c Clock) *UnionPay {
+	up.client.clock.Store(clockBox{c})
+	return up
+}
+
+// now 当前北京时间
+func (up *UnionPay) now() time.Time {
+	return up.client.now()
+}
+
+func (c *unionPayClient) now() time.Time {
+	if b, _ := c.clock.Load().(clockBox); b.Clock != nil {
+		return b.Now().In(Beijing)
+	}
+	return time.Now().In(Beijing)
+}
+
+// txnTime 订单发送时间 YYYYMMDDHHmmss 北京时间
+func (up *UnionPay) txnTime() string {
+	return up.now().Format("20060102150405")
+}
+
+// ParseTxnTime 解析订单发送时间 YYYYMMDDHHmmss
+func ParseTxnTime(txnTime string) (time.Time, error) {
+	return time.ParseInLocation("20060102150405", txnTime, Beijing)
+}
+
+// ParseSettleDate 解析清算日期 MMDD,年份取与ref最接近的年份,用于处理跨年
+// ref一般为该交易的订单发送时间
+func ParseSettleDate(settleDate string, ref time.Time) (time.Time, error) {
+	if len(settleDate) != 4 {
+		return time.Time{}, fmt.Errorf("bad settleDate: %q", settleDate)
+	}
+	return parseYearless("0102", settleDate, ref)
+}
+
+// ParseTraceTime 解析交易传输时间 MMDDHHmmss,年份推断同ParseSettleDate
+func ParseTraceTime(traceTime string, ref time.Time) (time.Time, error) {
+	if len(traceTime) != 10 {
+		return time.Time{}, fmt.Errorf("bad traceTime: %q", traceTime)
+	}
+	return parseYearless("0102150405", traceTime, ref)
+}
+
+func parseYearless(layout, value string, ref time.Time) (t time.Time, err error) {
+	ref = ref.In(Beijing)
+	// 先按闰年解析以接受0229
+	t, err = time.ParseInLocation("2006"+layout, "2000"+value, Beijing)
+	if err != nil {
+		return
+	}
+
+	var best time.Time
+	for _, year := range []int{ref.Year() - 1, ref.Year(), ref.Year() + 1} {
+		c := time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, Beijing)
+		if c.Month() != t.Month() {
+			// 非闰年的0229
+			continue
+		}
+		if best.IsZero() || absDuration(c.Sub(ref)) < absDuration(best.Sub(ref)) {
+			best = c
+		}
+	}
+	return best, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// ExpectedSettleDate 计算交易的清算日期
+// 生产环境23:00日切,23:00之后的交易计入下一清算日
+// 测试环境约13:30日切,13:30之前的交易计入上一清算日
+func (up *UnionPay) ExpectedSettleDate(txnTime time.Time) time.Time {
+	t := txnTime.In(Beijing)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, Beijing)
+
+	if up.testEnv {
+		if t.Hour()*60+t.Minute() < 13*60+30 {
+			return day.AddDate(0, 0, -1)
+		}
+		return day
+	}
+
+	if t.Hour() >= 23 {
+		return day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// settleTimes 以订单发送时间为参照解析清算日期及交易传输时间
+func settleTimes(txnTime, settleDate, traceTime string) (settle, trace time.Time, err error) {
+	ref, err := ParseTxnTime(txnTime)
+	if err != nil {
+		return
+	}
+
+	if settleDate != "" {
+		if settle, err = ParseSettleDate(settleDate, ref); err != nil {
+			return
+		}
+	}
+	if traceTime != "" {
+		trace, err = ParseTraceTime(traceTime, ref)
+	}
+	return
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *FrontConsumeNotifyResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *FrontConsumeReturnResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *MobilePaymentNotifyResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *ConsumeQueryResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *ConsumeRefundNotifyResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *ConsumeUndoNotifyResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
+
+// SettleTimes 解析清算日期及交易传输时间
+func (r *PayoutNotifyResponse) SettleTimes() (settleDate, traceTime time.Time, err error) {
+	return settleTimes(r.TxnTime, r.SettleDate, r.TraceTime)
+}
@@ -0,0 +1,194 @@
+package unionpay
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+
+	d, err := time.ParseInLocation("20060102", s, Beijing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParseSettleDate(t *testing.T) {
+	tests := []struct {
+		settleDate string
+		ref        string
+		want       string
+	}{
+		{"0102", "20240102103000", "20240102"},
+		{"0101", "20241231233000", "20250101"},
+		{"1231", "20250101001000", "20241231"},
+		{"0229", "20240229120000", "20240229"},
+		{"0229", "20250301120000", "20240229"},
+		{"0229", "20230301120000", "20240229"},
+	}
+	for _, tt := range tests {
+		ref, err := ParseTxnTime(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseSettleDate(tt.settleDate, ref)
+		if err != nil {
+			t.Errorf("ParseSettleDate(%s, %s): %v", tt.settleDate, tt.ref, err)
+			continue
+		}
+		if want := date(t, tt.want); !got.Equal(want) {
+			t.Errorf("ParseSettleDate(%s, %s) = %s, want %s", tt.settleDate, tt.ref, got, want)
+		}
+	}
+
+	ref := date(t, "20240102")
+	for _, bad := range []string{"", "102", "1301", "0230", "abcd"} {
+		if _, err := ParseSettleDate(bad, ref); err == nil {
+			t.Errorf("ParseSettleDate(%q) accepted", bad)
+		}
+	}
+}
+
+func TestParseTraceTime(t *testing.T) {
+	ref, _ := ParseTxnTime("20241231235959")
+	got, err := ParseTraceTime("0101000005", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := ParseTxnTime("20250101000005"); !got.Equal(want) {
+		t.Errorf("ParseTraceTime = %s, want %s", got, want)
+	}
+
+	if _, err = ParseTraceTime("01010000", ref); err == nil {
+		t.Error("short traceTime accepted")
+	}
+}
+
+func TestExpectedSettleDate(t *testing.T) {
+	tests := []struct {
+		testEnv bool
+		txnTime string
+		want    string
+	}{
+		{false, "20240102000000", "20240102"},
+		{false, "20240102225959", "20240102"},
+		{false, "20240102230000", "20240103"},
+		{false, "20241231233000", "20250101"},
+		{true, "20240102132959", "20240101"},
+		{true, "20240102133000", "20240102"},
+		{true, "20240101090000", "20231231"},
+	}
+	for _, tt := range tests {
+		up := newTestPayment(t).SetTestEnv(tt.testEnv)
+		txnTime, _ := ParseTxnTime(tt.txnTime)
+		if got, want := up.ExpectedSettleDate(txnTime), date(t, tt.want); !got.Equal(want) {
+			t.Errorf("testEnv=%v ExpectedSettleDate(%s) = %s, want %s", tt.testEnv, tt.txnTime, got, want)
+		}
+	}
+}
+
+func TestExpectedSettleDateUTCInput(t *testing.T) {
+	up := newTestPayment(t).SetTestEnv(false)
+	// 15:30 UTC 为北京时间23:30
+	txnTime := time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)
+	if got, want := up.ExpectedSettleDate(txnTime), date(t, "20240103"); !got.Equal(want) {
+		t.Errorf("ExpectedSettleDate = %s, want %s", got, want)
+	}
+}
+
+func TestPastSettleCutoff(t *testing.T) {
+	tests := []struct {
+		now     string
+		txnTime string
+		want    bool
+	}{
+		{"20240102220000", "20240102100000", false},
+		{"20240102230000", "20240102100000", true},
+		{"20240103010000", "20240102225959", true},
+		{"20240103010000", "20240102230001", false},
+		{"20240103010000", "bad", false},
+	}
+	for _, tt := range tests {
+		up := newTestPayment(t).SetTestEnv(false)
+		up.SetClock(fixedClock(t, tt.now))
+		if got := up.pastSettleCutoff(tt.txnTime); got != tt.want {
+			t.Errorf("now=%s pastSettleCutoff(%s) = %v, want %v", tt.now, tt.txnTime, got, tt.want)
+		}
+	}
+}
+
+func TestTxnTimeBeijing(t *testing.T) {
+	up := newTestPayment(t)
+	up.SetClock(ClockFunc(func() time.Time { return time.Date(2024, 1, 2, 16, 30, 0, 0, time.UTC) }))
+	if got := up.txnTime(); got != "20240103003000" {
+		t.Errorf("txnTime = %s, want 20240103003000", got)
+	}
+}
+
+func TestSetClockConcurrent(t *testing.T) {
+	up := newTestPayment(t)
+	clone, err := up.WithAccess(Access{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			up.SetClock(fixedClock(t, "20240102140000"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		clone.txnTime()
+	}
+	<-done
+
+	// 复制出的UnionPay共享时钟
+	if got := clone.txnTime(); got != "20240102140000" {
+		t.Errorf("txnTime = %s, want 20240102140000", got)
+	}
+	up.SetClock(nil)
+	if got := clone.now(); time.Since(got) > time.Minute {
+		t.Errorf("now = %s after SetClock(nil)", got)
+	}
+}
+
+func TestSettleTimes(t *testing.T) {
+	r := &FrontConsumeNotifyResponse{TxnTime: "20241231235900", SettleDate: "0101", TraceTime: "1231235901"}
+	settle, trace, err := r.SettleTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := date(t, "20250101"); !settle.Equal(want) {
+		t.Errorf("settleDate = %s, want %s", settle, want)
+	}
+	if want, _ := ParseTxnTime("20241231235901"); !trace.Equal(want) {
+		t.Errorf("traceTime = %s, want %s", trace, want)
+	}
+
+	r = &FrontConsumeNotifyResponse{TxnTime: "20241231235900"}
+	if settle, trace, err = r.SettleTimes(); err != nil || !settle.IsZero() || !trace.IsZero() {
+		t.Errorf("empty settleDate/traceTime = %s, %s, %v", settle, trace, err)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := sleepContext(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("sleepContext did not return on cancel")
+	}
+
+	if err := sleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Error(err)
+	}
+}
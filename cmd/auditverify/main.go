@@ -0,0 +1,95 @@
+// auditverify 校验FileAuditSink写出的哈希链审计文件
+//
+//	auditverify [-key KEYFILE] [-prev SEQ:HASH] [-anchor SEQ:HASH] audit.jsonl [audit-2.jsonl ...]
+//
+// 多个文件按轮转顺序给出,后一文件须接续前一文件构成一条链
+// -key为写入时使用的HMAC密钥文件,-prev为第一个文件之前的最后一条记录,从轮转后的文件开始校验时使用
+// -anchor为运行时留存在审计文件以外的锚点,须位于最后一个文件中,用于发现末尾截断
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shima-park/unionpay"
+)
+
+func main() {
+	keyPath := flag.String("key", os.Getenv("UNIONPAY_AUDIT_KEY_FILE"), "HMAC密钥文件")
+	prevFlag := flag.String("prev", "", "第一个文件之前的最后一条记录 SEQ:HASH")
+	anchorFlag := flag.String("anchor", "", "锚点 SEQ:HASH,须位于最后一个文件中")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: auditverify [-key KEYFILE] [-prev SEQ:HASH] [-anchor SEQ:HASH] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var key []byte
+	if *keyPath != "" {
+		b, err := os.ReadFile(*keyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		key = bytes.TrimSpace(b)
+	}
+
+	var prev, anchor unionpay.AuditHead
+	var err error
+	if *prevFlag != "" {
+		if prev, err = parseAnchor(*prevFlag); err != nil {
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	if *anchorFlag != "" {
+		if anchor, err = parseAnchor(*anchorFlag); err != nil {
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	// 前一文件失败时无法确定后续文件的起点,停止校验
+	files := flag.Args()
+	for i, path := range files {
+		var a unionpay.AuditHead
+		if i == len(files)-1 {
+			a = anchor
+		}
+		head, err := verifyFile(path, key, prev, a)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: FAIL after record %d: %s\n", path, head.Seq, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: OK %d records, head %d:%s\n", path, head.Seq-prev.Seq, head.Seq, head.Hash)
+		prev = head
+	}
+}
+
+func parseAnchor(s string) (head unionpay.AuditHead, err error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		err = fmt.Errorf("invalid anchor: %s", s)
+		return
+	}
+	head.Hash = s[i+1:]
+	head.Seq, err = strconv.ParseInt(s[:i], 10, 64)
+	return
+}
+
+func verifyFile(path string, key []byte, prev, anchor unionpay.AuditHead) (unionpay.AuditHead, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return prev, err
+	}
+	defer f.Close()
+	return unionpay.VerifyAuditLogAfter(f, key, prev, anchor)
+}
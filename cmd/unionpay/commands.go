@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+var errAborted = errors.New("aborted")
+
+func runQuery(e *env, args []string) error {
+	fs := newFlagSet(e, "query")
+	orderID := fs.String("order", "", "商户订单号")
+	txnTime := fs.String("txn-time", "", "订单发送时间 YYYYMMDDHHmmss")
+	queryID := fs.String("query-id", "", "查询流水号 可选")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := require(fs, "order", "txn-time"); err != nil {
+		return err
+	}
+
+	resp, err := e.up.ConsumeQuery(*orderID, *queryID, *txnTime, "")
+	if err != nil {
+		return err
+	}
+	return e.out.fields(structFields(resp))
+}
+
+func runRefund(e *env, args []string) error {
+	return runReverse(e, "refund", args, func(orderID, backURL string, amount unionpay.Amount, origQueryID string) (interface{}, error) {
+		return e.up.ConsumeRefund(orderID, backURL, amount, origQueryID, "", "")
+	})
+}
+
+func runUndo(e *env, args []string) error {
+	return runReverse(e, "undo", args, func(orderID, backURL string, amount unionpay.Amount, origQueryID string) (interface{}, error) {
+		return e.up.ConsumeUndo(orderID, backURL, amount, origQueryID, "", "")
+	})
+}
+
+func runReverse(e *env, name string, args []string, send func(orderID, backURL string, amount unionpay.Amount, origQueryID string) (interface{}, error)) error {
+	fs := newFlagSet(e, name)
+	orderID := fs.String("order", "", "本次交易的商户订单号")
+	origQueryID := fs.String("orig-query-id", "", "原消费交易的查询流水号")
+	amountStr := fs.String("amount", "", "金额 单位元,如12.34")
+	backURL := fs.String("back-url", "", "后台通知地址")
+	yes := fs.Bool("yes", false, "不再确认直接发送")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := require(fs, "order", "orig-query-id", "amount", "back-url"); err != nil {
+		return err
+	}
+
+	amount, err := unionpay.ParseYuan(*amountStr)
+	if err != nil {
+		return err
+	}
+	if err = amount.Validate(); err != nil {
+		return err
+	}
+
+	if !*yes {
+		prompt := fmt.Sprintf("%s %s of %s (merId %s, order %s)? [y/N] ", name, amount, *origQueryID, e.up.MerID(), *orderID)
+		if !confirm(e, prompt) {
+			return errAborted
+		}
+	}
+
+	resp, err := send(*orderID, *backURL, amount, *origQueryID)
+	if resultUnknown(err) {
+		return reportUnknown(e, err)
+	}
+	if err != nil {
+		return err
+	}
+	return e.out.fields(structFields(resp))
+}
+
+// resultUnknown 请求可能已被银联受理但结果未明:应答码为03,04,05,网络异常或应答验签失败
+func resultUnknown(err error) bool {
+	switch e := err.(type) {
+	case *unionpay.RespError:
+		return e.IsUnknown()
+	case *unionpay.SignatureError, *url.Error:
+		return true
+	}
+	return false
+}
+
+// reportUnknown 输出最后一次请求的订单信息及应答域,提示先查询再决定是否重发
+func reportUnknown(e *env, err error) error {
+	orderID, txnTime := e.last.form.Get("orderId"), e.last.form.Get("txnTime")
+
+	kvs := unionpay.KVpairs{
+		{K: "result", V: "unknown"},
+		{K: "orderId", V: orderID},
+		{K: "txnTime", V: txnTime},
+		{K: "error", V: err.Error()},
+	}
+	fields := unionpay.MaskValues(toValues(e.last.fields))
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if k != "signature" && k != "orderId" && k != "txnTime" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		kvs = append(kvs, unionpay.KVpair{K: k, V: fields[k]})
+	}
+	if oerr := e.out.fields(kvs); oerr != nil {
+		return oerr
+	}
+
+	fmt.Fprintf(e.stderr, "result unknown, do not resend; run: unionpay query -order %s -txn-time %s\n", orderID, txnTime)
+	return errResultUnknown
+}
+
+func toValues(fields map[string]string) url.Values {
+	vals := url.Values{}
+	for k, v := range fields {
+		vals.Set(k, v)
+	}
+	return vals
+}
+
+// runReverseOriginal 按原交易撤销或退货,由unionpay.Reverse决定撤销还是退货,结果未明时查询确认
+func runReverseOriginal(e *env, args []string) error {
+	fs := newFlagSet(e, "reverse")
+	orderID := fs.String("order", "", "本次交易的商户订单号")
+	refundOrderID := fs.String("refund-order", "", "撤销被拒绝改为退货时的商户订单号 默认同-order")
+	origOrderID := fs.String("orig-order", "", "原消费交易的商户订单号")
+	origTxnTime := fs.String("orig-txn-time", "", "原消费交易的订单发送时间 YYYYMMDDHHmmss")
+	amountStr := fs.String("amount", "", "金额 单位元 默认退回剩余全部金额")
+	refundedStr := fs.String("refunded", "", "原交易已发起且未失败的退货金额合计 单位元")
+	backURL := fs.String("back-url", "", "后台通知地址")
+	yes := fs.Bool("yes", false, "不再确认直接发送")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := require(fs, "order", "orig-order", "orig-txn-time", "back-url"); err != nil {
+		return err
+	}
+
+	var amount, refunded unionpay.Amount
+	var err error
+	if *amountStr != "" {
+		if amount, err = unionpay.ParseYuan(*amountStr); err != nil {
+			return err
+		}
+	}
+	if *refundedStr != "" {
+		if refunded, err = unionpay.ParseYuan(*refundedStr); err != nil {
+			return err
+		}
+	}
+
+	if !*yes {
+		desc := "remaining amount"
+		if !amount.IsZero() {
+			desc = amount.String()
+		}
+		prompt := fmt.Sprintf("reverse %s of %s %s (merId %s, order %s, refunded %s)? [y/N] ", desc, *origOrderID, *origTxnTime, e.up.MerID(), *orderID, refunded)
+		if !confirm(e, prompt) {
+			return errAborted
+		}
+	}
+
+	result, err := e.up.Reverse(
+		unionpay.OriginalTxn{OrderID: *origOrderID, TxnTime: *origTxnTime, Refunded: refunded},
+		amount,
+		unionpay.ReverseOptions{OrderID: *orderID, RefundOrderID: *refundOrderID, BackURL: *backURL},
+	)
+	if err != nil {
+		return err
+	}
+
+	kvs := unionpay.KVpairs{
+		{K: "kind", V: result.Kind.String()},
+		{K: "status", V: result.Status.String()},
+		{K: "orderId", V: result.OrderID},
+		{K: "txnTime", V: result.TxnTime},
+		{K: "txnAmt", V: result.TxnAmt.String()},
+		{K: "queryId", V: result.QueryID},
+		{K: "respCode", V: result.RespCode},
+		{K: "respMsg", V: result.RespMsg},
+	}
+	if err = e.out.fields(kvs.RemoveEmpty()); err != nil {
+		return err
+	}
+
+	switch result.Status {
+	case unionpay.ReverseFailed:
+		return fmt.Errorf("failed: %s %s", result.RespCode, result.RespMsg)
+	case unionpay.ReverseUnknown:
+		fmt.Fprintf(e.stderr, "result unknown, do not resend; run: unionpay query -order %s -txn-time %s\n", result.OrderID, result.TxnTime)
+		return errResultUnknown
+	}
+	return nil
+}
+
+func confirm(e *env, prompt string) bool {
+	fmt.Fprint(e.stderr, prompt)
+	line, _ := bufio.NewReader(e.in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func runDownloadSettlement(e *env, args []string) error {
+	fs := newFlagSet(e, "download-settlement")
+	date := fs.String("date", "", "清算日期 YYYY-MM-DD 默认昨天")
+	outDir := fs.String("out", ".", "保存目录")
+	extract := fs.Bool("extract", false, "同时解压全部文件")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	settleDate := time.Now().In(unionpay.Beijing).AddDate(0, 0, -1)
+	if *date != "" {
+		var err error
+		if settleDate, err = time.ParseInLocation("2006-01-02", *date, unionpay.Beijing); err != nil {
+			return err
+		}
+	}
+
+	pkg, err := e.up.DownloadSettlement(settleDate)
+	if err != nil {
+		return err
+	}
+
+	name := pkg.FileName
+	if name == "" {
+		name = fmt.Sprintf("%s_%s.zip", e.up.MerID(), pkg.SettleDate.Format("20060102"))
+	}
+	zipPath := filepath.Join(*outDir, filepath.Base(name))
+	if err = ioutil.WriteFile(zipPath, pkg.Zip, 0600); err != nil {
+		return err
+	}
+
+	rows := [][]string{{zipPath, strconv.Itoa(len(pkg.Zip)), "zip"}}
+	for _, f := range pkg.Files {
+		kind := "other"
+		switch {
+		case f.IsTxnFile():
+			kind = "transactions"
+		case f.IsErrorFile():
+			kind = "disputes"
+		}
+
+		path := f.Name
+		if *extract {
+			path = filepath.Join(*outDir, filepath.Base(f.Name))
+			if err = ioutil.WriteFile(path, f.Data, 0600); err != nil {
+				return err
+			}
+		}
+		rows = append(rows, []string{path, strconv.Itoa(len(f.Data)), kind})
+	}
+	return e.out.table([]string{"file", "size", "kind"}, rows)
+}
+
+// readForm 读取URL编码的表单报文 k1=v1&k2=v2,-in为空时读取标准输入
+func readForm(e *env, path string) (url.Values, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "" || path == "-" {
+		b, err = ioutil.ReadAll(e.in)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := url.ParseQuery(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, unionpay.ErrNotifyDataIsEmpty
+	}
+	return vals, nil
+}
+
+func runSign(e *env, args []string) error {
+	fs := newFlagSet(e, "sign")
+	in := fs.String("in", "", "表单报文文件 默认标准输入")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	vals, err := readForm(e, *in)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		if k != "signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	kvs := unionpay.KVpairs{}
+	for _, k := range keys {
+		kvs = append(kvs, unionpay.KVpair{K: k, V: vals.Get(k)})
+	}
+
+	sig, err := e.up.Sign(kvs)
+	if err != nil {
+		return err
+	}
+	return e.out.fields(unionpay.KVpairs{
+		{K: "canonical", V: kvs.RemoveEmpty().Join("&")},
+		{K: "signature", V: sig},
+	})
+}
+
+func runVerifyNotify(e *env, args []string) error {
+	fs := newFlagSet(e, "verify-notify")
+	in := fs.String("in", "", "通知报文原文文件 默认标准输入")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	vals, err := readForm(e, *in)
+	if err != nil {
+		return err
+	}
+
+	verr := e.up.VerifyNotify(vals)
+	result := "ok"
+	if verr != nil {
+		result = "failed"
+	}
+
+	kvs := unionpay.KVpairs{{K: "result", V: result}}
+	for _, k := range []string{"merId", "orderId", "txnType", "txnTime", "queryId", "respCode", "certId", "signMethod"} {
+		kvs = append(kvs, unionpay.KVpair{K: k, V: vals.Get(k)})
+	}
+	if verr != nil {
+		kvs = append(kvs, unionpay.KVpair{K: "error", V: verr.Error()})
+	}
+	if err = e.out.fields(kvs.RemoveEmpty()); err != nil {
+		return err
+	}
+	return verr
+}
+
+func runDecryptAccNo(e *env, args []string) error {
+	fs := newFlagSet(e, "decrypt-accno")
+	value := fs.String("value", "", "应答或通知中加密的accNo")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *value == "" && fs.NArg() > 0 {
+		*value = fs.Arg(0)
+	}
+	if err := require(fs, "value"); err != nil {
+		return err
+	}
+
+	accNo, err := e.up.DecryptData(*value)
+	if err != nil {
+		return err
+	}
+	return e.out.fields(unionpay.KVpairs{{K: "accNo", V: accNo}})
+}
+
+func runCertInfo(e *env, args []string) error {
+	fs := newFlagSet(e, "cert-info")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	h := e.up.Health()
+	rows := make([][]string, 0, len(h.Certs))
+	for _, c := range h.Certs {
+		rows = append(rows, []string{
+			string(c.Kind),
+			c.SerialNumber,
+			c.Subject,
+			c.NotBefore.Format(time.RFC3339),
+			c.NotAfter.Format(time.RFC3339),
+			strconv.Itoa(c.DaysLeft),
+		})
+	}
+	if err := e.out.table([]string{"kind", "serialNumber", "subject", "notBefore", "notAfter", "daysLeft"}, rows); err != nil {
+		return err
+	}
+
+	if !h.Healthy {
+		return fmt.Errorf("unhealthy: %s", strings.Join(h.Problems, "; "))
+	}
+	for _, p := range h.Problems {
+		fmt.Fprintln(e.stderr, "warning:", p)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// unionpay 运维命令行工具,按商户配置文件查询,退货,撤销,下载对账文件及排查签名问题
+//
+//	unionpay [-config merchant.json] [-format table|json] [-audit audit.jsonl -audit-key KEYFILE] <command> [flags]
+//
+// 商户配置文件与unionpay.MerchantConfig相同,相对证书路径以配置文件所在目录为基准
+// refund,undo及reverse会发起资金交易,必须指定-audit
+//
+// 退出状态 0:成功 1:失败 2:参数错误 3:交易结果未明,应先查询再决定是否重发
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/shima-park/unionpay"
+)
+
+var (
+	// errUsage 参数错误,以状态码2退出
+	errUsage = errors.New("usage")
+	// errResultUnknown 交易结果未明,以状态码3退出
+	errResultUnknown = errors.New("result unknown")
+)
+
+type command struct {
+	name    string
+	usage   string
+	run     func(env *env, args []string) error
+	audited bool // 资金交易,要求-audit
+}
+
+var commands = []command{
+	{"query", "查询交易 -order ORDER -txn-time YYYYMMDDHHmmss", runQuery, false},
+	{"refund", "退货 -order NEW_ORDER -orig-query-id QUERY_ID -amount 元 -back-url URL", runRefund, true},
+	{"undo", "消费撤销 -order NEW_ORDER -orig-query-id QUERY_ID -amount 元 -back-url URL", runUndo, true},
+	{"reverse", "撤销或退货 -order NEW_ORDER -orig-order ORDER -orig-txn-time YYYYMMDDHHmmss -back-url URL [-amount 元] [-refunded 元]", runReverseOriginal, true},
+	{"download-settlement", "下载对账文件 -date YYYY-MM-DD [-out DIR] [-extract]", runDownloadSettlement, false},
+	{"sign", "对表单报文签名 [-in FILE]", runSign, false},
+	{"verify-notify", "验证已保存的通知报文 [-in FILE]", runVerifyNotify, false},
+	{"decrypt-accno", "解密应答中的accNo -value VALUE", runDecryptAccNo, false},
+	{"cert-info", "证书信息及有效期", runCertInfo, false},
+}
+
+// gatewayMiddlewares 添加在最内层的网关中间件,测试时替换网关请求
+var gatewayMiddlewares []unionpay.Middleware
+
+// env 子命令的运行环境
+type env struct {
+	up     *unionpay.UnionPay
+	out    *output
+	in     io.Reader
+	stderr io.Writer
+	last   *exchange
+}
+
+// exchange 最后一次网关请求及应答,结果未明时输出供排查
+type exchange struct {
+	form   url.Values
+	fields map[string]string
+}
+
+func (x *exchange) middleware(next unionpay.RoundTripFunc) unionpay.RoundTripFunc {
+	return func(req *unionpay.Request) (*unionpay.Response, error) {
+		resp, err := next(req)
+		x.form, x.fields = req.Form, nil
+		if resp != nil {
+			x.fields = resp.Fields
+		}
+		return resp, err
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("unionpay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", envOr("UNIONPAY_CONFIG", "unionpay.json"), "商户配置文件")
+	format := fs.String("format", "table", "输出格式 table或json")
+	auditPath := fs.String("audit", "", "审计文件,为空时不记录")
+	auditKey := fs.String("audit-key", envOr("UNIONPAY_AUDIT_KEY_FILE", ""), "审计哈希链HMAC密钥文件")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: unionpay [flags] <command> [command flags]")
+		fs.PrintDefaults()
+		fmt.Fprintln(stderr, "\ncommands:")
+		for _, c := range commands {
+			fmt.Fprintf(stderr, "  %-20s %s\n", c.name, c.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format: %s\n", *format)
+		return 2
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == fs.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command: %s\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	if cmd.audited && *auditPath == "" {
+		fmt.Fprintf(stderr, "%s: -audit is required for fund transactions\n", cmd.name)
+		return 2
+	}
+
+	up, sink, err := openMerchant(*configPath, *auditPath, *auditKey)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if sink != nil {
+		defer func() {
+			// 锚点应保存在审计文件以外,校验时传给auditverify -anchor
+			head := sink.Head()
+			fmt.Fprintf(stderr, "audit head: %d:%s\n", head.Seq, head.Hash)
+			sink.Close()
+		}()
+	}
+
+	e := &env{up: up, out: &output{w: stdout, json: *format == "json"}, in: stdin, stderr: stderr, last: &exchange{}}
+	up.Use(e.last.middleware)
+	up.Use(gatewayMiddlewares...)
+	if err = cmd.run(e, fs.Args()[1:]); err != nil {
+		switch err {
+		case errUsage, flag.ErrHelp:
+			return 2
+		case errResultUnknown:
+			return 3
+		}
+		fmt.Fprintf(stderr, "%s: %s\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+func openMerchant(configPath, auditPath, auditKeyPath string) (up *unionpay.UnionPay, sink *unionpay.FileAuditSink, err error) {
+	cfg, err := unionpay.ReadMerchantConfig(configPath)
+	if err != nil {
+		return
+	}
+	if up, err = unionpay.NewPaymentFromConfig(cfg); err != nil {
+		return
+	}
+
+	if auditPath != "" {
+		var key []byte
+		if key, err = readAuditKey(auditKeyPath); err != nil {
+			return
+		}
+		if sink, err = unionpay.NewFileAuditSink(auditPath, key); err != nil {
+			return
+		}
+		up.SetAuditSink(sink)
+	}
+	return
+}
+
+// readAuditKey 读取HMAC密钥文件,路径为空时不使用密钥
+func readAuditKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(b), nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// newFlagSet 子命令参数,错误信息输出到e.stderr
+func newFlagSet(e *env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+// parseFlags 解析子命令参数,错误信息已由fs输出,以状态码2退出
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return errUsage
+	}
+	return err
+}
+
+// require 检查必填参数
+func require(fs *flag.FlagSet, names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if fs.Lookup(name).Value.String() == "" {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		fmt.Fprintf(fs.Output(), "missing required flags: %v\n", missing)
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
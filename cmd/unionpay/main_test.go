@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shima-park/unionpay"
+)
+
+// gatewayFunc 模拟网关,返回nil时视为网络异常
+type gatewayFunc func(form url.Values) map[string]string
+
+// testGateway 替换网关请求并记录发出的报文
+type testGateway struct {
+	fn   gatewayFunc
+	sent []url.Values
+}
+
+func (g *testGateway) middleware(unionpay.RoundTripFunc) unionpay.RoundTripFunc {
+	return func(req *unionpay.Request) (*unionpay.Response, error) {
+		g.sent = append(g.sent, req.Form)
+		fields := g.fn(req.Form)
+		if fields == nil {
+			return nil, &url.Error{Op: "Post", URL: req.URL.String(), Err: os.ErrDeadlineExceeded}
+		}
+
+		resp := &unionpay.Response{Fields: fields}
+		if fields["respCode"] != "00" {
+			return resp, &unionpay.RespError{Code: fields["respCode"], Msg: fields["respMsg"]}
+		}
+		return resp, nil
+	}
+}
+
+func respFields(form url.Values, respCode string, extra ...string) map[string]string {
+	m := map[string]string{
+		"merId":    form.Get("merId"),
+		"orderId":  form.Get("orderId"),
+		"txnType":  form.Get("txnType"),
+		"txnTime":  form.Get("txnTime"),
+		"respCode": respCode,
+		"respMsg":  "msg " + respCode,
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		m[extra[i]] = extra[i+1]
+	}
+	return m
+}
+
+// writeConfig 使用仓库根目录的测试证书写出商户配置
+func writeConfig(t *testing.T) string {
+	t.Helper()
+
+	cert, err := filepath.Abs("../../key.cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := filepath.Abs("../../key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(unionpay.MerchantConfig{MerID: "700000000000001", SignCert: cert, PrivateKey: key, VerifyCert: cert, TestEnv: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "unionpay.json")
+	if err = os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type runResult struct {
+	code           int
+	stdout, stderr string
+}
+
+// runWith 以g替换网关运行命令
+func runWith(t *testing.T, g *testGateway, stdin string, args ...string) runResult {
+	t.Helper()
+
+	gatewayMiddlewares = []unionpay.Middleware{g.middleware}
+	defer func() { gatewayMiddlewares = nil }()
+
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", writeConfig(t)}, args...)
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return runResult{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+func auditFlag(t *testing.T) string {
+	return "-audit=" + filepath.Join(t.TempDir(), "audit.jsonl")
+}
+
+var refundArgs = []string{"refund", "-order", "REFUND0001", "-orig-query-id", "202401021000000000001", "-amount", "12.34", "-back-url", "https://merchant.test/notify"}
+
+func TestRunUsage(t *testing.T) {
+	g := &testGateway{}
+	if r := runWith(t, g, ""); r.code != 2 || !strings.Contains(r.stderr, "commands:") {
+		t.Errorf("no command: %+v", r)
+	}
+	if r := runWith(t, g, "", "nope"); r.code != 2 || !strings.Contains(r.stderr, "unknown command: nope") {
+		t.Errorf("unknown command: %+v", r)
+	}
+}
+
+func TestRunFundCommandsRequireAudit(t *testing.T) {
+	for _, name := range []string{"refund", "undo", "reverse"} {
+		g := &testGateway{}
+		r := runWith(t, g, "", append([]string{name}, refundArgs[1:]...)...)
+		if r.code != 2 || !strings.Contains(r.stderr, "-audit is required") {
+			t.Errorf("%s without -audit: %+v", name, r)
+		}
+		if len(g.sent) != 0 {
+			t.Errorf("%s sent %d requests without -audit", name, len(g.sent))
+		}
+	}
+}
+
+func TestRunRefund(t *testing.T) {
+	g := &testGateway{fn: func(form url.Values) map[string]string {
+		return respFields(form, "00", "queryId", "202401021500000000003")
+	}}
+
+	r := runWith(t, g, "", append([]string{auditFlag(t)}, append(refundArgs, "-yes")...)...)
+	if r.code != 0 {
+		t.Fatalf("exit %d: %s", r.code, r.stderr)
+	}
+	if len(g.sent) != 1 || g.sent[0].Get("txnType") != "04" || g.sent[0].Get("txnAmt") != "1234" {
+		t.Fatalf("sent %v", g.sent)
+	}
+	if !strings.Contains(r.stdout, "202401021500000000003") || !strings.Contains(r.stderr, "audit head: ") {
+		t.Errorf("stdout %q stderr %q", r.stdout, r.stderr)
+	}
+}
+
+func TestRunRefundConfirm(t *testing.T) {
+	g := &testGateway{fn: func(form url.Values) map[string]string { return respFields(form, "00") }}
+
+	r := runWith(t, g, "n\n", append([]string{auditFlag(t)}, refundArgs...)...)
+	if r.code != 1 || len(g.sent) != 0 {
+		t.Errorf("declined refund: exit %d, sent %d", r.code, len(g.sent))
+	}
+	if !strings.Contains(r.stderr, "[y/N]") || !strings.Contains(r.stderr, "aborted") {
+		t.Errorf("prompt not on stderr: %q", r.stderr)
+	}
+
+	if r = runWith(t, g, "y\n", append([]string{auditFlag(t)}, refundArgs...)...); r.code != 0 || len(g.sent) != 1 {
+		t.Errorf("confirmed refund: exit %d, sent %d: %s", r.code, len(g.sent), r.stderr)
+	}
+}
+
+func TestRunRefundResultUnknown(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		fields func(form url.Values) map[string]string
+	}{
+		{"03", func(form url.Values) map[string]string { return respFields(form, "03") }},
+		{"network", func(url.Values) map[string]string { return nil }},
+	} {
+		g := &testGateway{fn: c.fields}
+		r := runWith(t, g, "", append([]string{auditFlag(t), "-format", "json"}, append(refundArgs, "-yes")...)...)
+		if r.code != 3 {
+			t.Errorf("%s: exit %d, want 3: %s", c.name, r.code, r.stderr)
+			continue
+		}
+
+		var out map[string]string
+		if err := json.Unmarshal([]byte(r.stdout), &out); err != nil {
+			t.Fatalf("%s: %v: %s", c.name, err, r.stdout)
+		}
+		txnTime := g.sent[0].Get("txnTime")
+		if out["result"] != "unknown" || out["orderId"] != "REFUND0001" || out["txnTime"] != txnTime {
+			t.Errorf("%s: output %v", c.name, out)
+		}
+		if c.name == "03" && out["respCode"] != "03" {
+			t.Errorf("%s: response fields not printed: %v", c.name, out)
+		}
+		if want := "unionpay query -order REFUND0001 -txn-time " + txnTime; !strings.Contains(r.stderr, want) {
+			t.Errorf("%s: stderr %q does not contain %q", c.name, r.stderr, want)
+		}
+		if len(g.sent) != 1 {
+			t.Errorf("%s: sent %d requests, want 1", c.name, len(g.sent))
+		}
+	}
+}
+
+func TestRunRefundRejected(t *testing.T) {
+	g := &testGateway{fn: func(form url.Values) map[string]string { return respFields(form, "12") }}
+
+	r := runWith(t, g, "", append([]string{auditFlag(t)}, append(refundArgs, "-yes")...)...)
+	if r.code != 1 || strings.Contains(r.stderr, "unionpay query") {
+		t.Errorf("rejected refund: %+v", r)
+	}
+}
+
+func TestRunFlagErrorsToStderr(t *testing.T) {
+	g := &testGateway{}
+	r := runWith(t, g, "", auditFlag(t), "refund", "-order", "REFUND0001")
+	if r.code != 2 || !strings.Contains(r.stderr, "missing required flags") || r.stdout != "" {
+		t.Errorf("missing flags: %+v", r)
+	}
+	if r = runWith(t, g, "", "query", "-bogus"); r.code != 2 || !strings.Contains(r.stderr, "-bogus") {
+		t.Errorf("unknown flag: %+v", r)
+	}
+}
+
+func TestRunReverseRefunded(t *testing.T) {
+	g := &testGateway{fn: func(form url.Values) map[string]string {
+		switch form.Get("txnType") {
+		case "00":
+			return respFields(form, "00", "origRespCode", "00", "queryId", "202401021000000000001", "txnAmt", "10000", "bizType", "000201")
+		case "04":
+			return respFields(form, "00", "queryId", "202401031000000000003")
+		}
+		return nil
+	}}
+
+	r := runWith(t, g, "", auditFlag(t), "reverse", "-order", "REFUND0002", "-orig-order", "ORDER0001", "-orig-txn-time", "20240102100000",
+		"-refunded", "30.00", "-back-url", "https://merchant.test/notify", "-yes")
+	if r.code != 0 {
+		t.Fatalf("exit %d: %s", r.code, r.stderr)
+	}
+	if len(g.sent) != 2 || g.sent[1].Get("txnType") != "04" || g.sent[1].Get("txnAmt") != "7000" {
+		t.Fatalf("sent %v", g.sent)
+	}
+	if !strings.Contains(r.stdout, "accepted") || !strings.Contains(r.stdout, "70.00") {
+		t.Errorf("stdout %q", r.stdout)
+	}
+}
+
+func TestRunCertInfo(t *testing.T) {
+	// 仓库中的测试证书已过期
+	r := runWith(t, &testGateway{}, "", "cert-info")
+	if r.code != 1 || !strings.Contains(r.stderr, "expired") {
+		t.Errorf("exit %d: %s", r.code, r.stderr)
+	}
+	if !strings.Contains(r.stdout, "SERIALNUMBER") {
+		t.Errorf("stdout %q", r.stdout)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shima-park/unionpay"
+)
+
+// output 按table或json格式输出
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// table 输出多行记录
+func (o *output) table(header []string, rows [][]string) error {
+	if o.json {
+		list := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			m := make(map[string]string, len(header))
+			for i, h := range header {
+				m[h] = row[i]
+			}
+			list = append(list, m)
+		}
+		return o.encode(list)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// fields 输出一条记录,kvs为有序的键值对
+func (o *output) fields(kvs unionpay.KVpairs) error {
+	if o.json {
+		m := make(map[string]string, len(kvs))
+		for _, kv := range kvs {
+			m[kv.K] = kv.V
+		}
+		return o.encode(m)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	for _, kv := range kvs {
+		fmt.Fprintf(tw, "%s\t%s\n", kv.K, kv.V)
+	}
+	return tw.Flush()
+}
+
+func (o *output) encode(v interface{}) error {
+	enc := json.NewEncoder(o.w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+var amountType = reflect.TypeOf(unionpay.Amount{})
+
+// structFields 应答结构体中的非空域,金额以主货币单位表示,不输出签名
+func structFields(v interface{}) unionpay.KVpairs {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	var kvs unionpay.KVpairs
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Name == "Signature" {
+			continue
+		}
+
+		var s string
+		switch fv := rv.Field(i); {
+		case f.Type == amountType:
+			if a := fv.Interface().(unionpay.Amount); !a.IsZero() {
+				s = a.String()
+			}
+		case fv.Kind() == reflect.String:
+			s = fv.String()
+		}
+		if s != "" {
+			kvs = append(kvs, unionpay.KVpair{K: f.Name, V: s})
+		}
+	}
+	return kvs
+}
@@ -2,11 +2,10 @@ package unionpay
 
 import (
 	"bytes"
-	"crypto/rsa"
 	"fmt"
 	"net/http"
+	"net/url"
 	"text/template"
-	"time"
 )
 
 var frontConsumeParamMap = map[string]bool{
@@ -23,6 +22,7 @@ var frontConsumeParamMap = map[string]bool{
 	"backUrl":         true,  // 后台通知地址 后台返回商户结果时使用，如上送，则发送商户后台交易结果通知
 	"accessType":      true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
 	"merId":           true,  // 商户代码
+	"acqInsCode":      false, // 收单机构代码 收单机构接入时必须上送
 	"subMerId":        false, // 二级商户代码 商户类型为平台商户接入时必须上送
 	"subMerName":      false, // 二级商户全称 商户类型为平台商户接入时必须上送
 	"subMerAbbr":      false, // 二级商户简称 商户类型为平台商户接入时必须上送
@@ -51,26 +51,36 @@ var frontConsumeParamMap = map[string]bool{
 	"orderDesc":       false, // 订单描述 移动支付上送
 }
 
-func (up *UnionPay) FrontConsume(orderID string, amount int64, returnURL, notifyURL string, extraParams map[string]string) (html string, err error) {
-	params := up.initFrontConsumeParams(orderID, amount, returnURL, notifyURL, extraParams)
+func (up *UnionPay) FrontConsume(orderID string, amount Amount, returnURL, notifyURL string, extraParams map[string]string) (html string, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params := up.initFrontConsumeParams(cred, orderID, amount, returnURL, notifyURL, extraParams)
 	kvs, err := GenKVpairs(frontConsumeParamMap, params, "signature")
 	if err != nil {
 		return
 	}
 
 	var sig string
-	sig, err = signature(up.privateKey, kvs)
+	sig, err = up.sign(cred, kvs)
 	if err != nil {
 		return
 	}
 
 	kvs = append(kvs, KVpair{K: "signature", V: sig})
-	html = up.checkoutHTML(kvs)
-
+	html, err = up.checkoutHTML(kvs)
 	return
 }
 
-func (up *UnionPay) checkoutHTML(kvs KVpairs) string {
+// checkoutHTML 生成自动提交的前台表单,表单由浏览器提交,生成时即写入审计记录
+func (up *UnionPay) checkoutHTML(kvs KVpairs) (string, error) {
+	if err := up.auditForm(kvs); err != nil {
+		return "", err
+	}
+
 	var tpl = `
 <html>
 <head>
@@ -98,31 +108,30 @@ document.getElementById("pay_form").submit();
 		"Data":   kvs,
 		"Action": up.getHost() + frontTransReq,
 	})
-	return buff.String()
+	return buff.String(), nil
 }
 
-func (up *UnionPay) initFrontConsumeParams(orderID string, amount int64, returnURL, notifyURL string, extraParams map[string]string) (params map[string]string) {
+func (up *UnionPay) initFrontConsumeParams(cred *credentials, orderID string, amount Amount, returnURL, notifyURL string, extraParams map[string]string) (params map[string]string) {
 	params = make(map[string]string)
 
-	params["certId"] = up.publicKey.SerialNumber.String() //证书id
-	params["merId"] = up.mchID                            //商户代码，请改自己的测试商户号
+	params["certId"] = cred.certID //证书id
+	params["merId"] = up.mchID     //商户代码，请改自己的测试商户号
 
-	params["frontUrl"] = returnURL                          //前台通知地址
-	params["backUrl"] = notifyURL                           //后台通知地址
-	params["orderId"] = orderID                             //商户订单号
-	params["txnTime"] = time.Now().Format("20060102150405") //订单发送时间
-	params["txnAmt"] = fmt.Sprintf("%d", amount)            //交易金额，单位分
-	params["signMethod"] = "01"                             //签名方法
+	params["frontUrl"] = returnURL           //前台通知地址
+	params["backUrl"] = notifyURL            //后台通知地址
+	params["orderId"] = orderID              //商户订单号
+	params["txnTime"] = up.txnTime()         //订单发送时间
+	params["txnAmt"] = amount.txnAmt()       //交易金额，最小货币单位
+	params["signMethod"] = cred.signMethod() //签名方法
 
-	params["version"] = "5.0.0"       //版本号
-	params["encoding"] = "utf-8"      //编码方式
-	params["txnType"] = "01"          //交易类型
-	params["txnSubType"] = "01"       //交易子类
-	params["bizType"] = "000201"      //业务类型
-	params["channelType"] = "08"      //渠道类型，07-PC，08-手机
-	params["accessType"] = "0"        //接入类型
-	params["currencyCode"] = "156"    //交易币种
-	params["defaultPayType"] = "0001" //默认支付方式
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "utf-8"                       //编码方式
+	params["txnType"] = "01"                           //交易类型
+	params["txnSubType"] = "01"                        //交易子类
+	params["bizType"] = "000201"                       //业务类型
+	params["channelType"] = "08"                       //渠道类型，07-PC，08-手机
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["defaultPayType"] = "0001"                  //默认支付方式
 
 	if extraParams != nil {
 		for k, v := range extraParams {
@@ -132,6 +141,8 @@ func (up *UnionPay) initFrontConsumeParams(orderID string, amount int64, returnU
 			}
 		}
 	}
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
 	return
 }
 
@@ -148,7 +159,7 @@ type FrontConsumeReturnResponse struct {
 	MerID              string // 商户代码 R
 	OrderID            string // 商户订单号 R
 	TxnTime            string // 订单发送时间 R
-	TxnAmt             string // 交易金额 R
+	TxnAmt             Amount // 交易金额 R
 	CurrencyCode       string // 交易币种 R
 	ReqReserved        string // 请求方保留域 R
 	Reserved           string // 保留域 O
@@ -163,7 +174,8 @@ type FrontConsumeReturnResponse struct {
 	TraceTime          string // 交易传输时间
 	SettleDate         string // 清算日期
 	SettleCurrencyCode string // 清算货币
-	SettleAmt          string // 清算金额
+	SettleAmt          Amount // 清算金额
+	InstalTransInfo    string // 分期付款信息域 C 分期付款交易时返回
 }
 
 func (up *UnionPay) FrontConsumeReturn(req *http.Request) (resp *FrontConsumeReturnResponse, err error) {
@@ -201,9 +213,15 @@ func (up *UnionPay) FrontConsumeReturn(req *http.Request) (resp *FrontConsumeRet
 		"settleDate",
 		"settleCurrencyCode",
 		"settleAmt",
+		"instalTransInfo",
 	}
 
-	if err = verify(up.verifySignCert.PublicKey.(*rsa.PublicKey), vals, fields); err != nil {
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
+	}
+
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
 		return
 	}
 
@@ -220,7 +238,7 @@ func (up *UnionPay) FrontConsumeReturn(req *http.Request) (resp *FrontConsumeRet
 		MerID:              vals.Get("merId"),
 		OrderID:            vals.Get("orderId"),
 		TxnTime:            vals.Get("txnTime"),
-		TxnAmt:             vals.Get("txnAmt"),
+		TxnAmt:             txnAmt,
 		CurrencyCode:       vals.Get("currencyCode"),
 		ReqReserved:        vals.Get("reqReserved"),
 		Reserved:           vals.Get("reserved"),
@@ -235,7 +253,8 @@ func (up *UnionPay) FrontConsumeReturn(req *http.Request) (resp *FrontConsumeRet
 		TraceTime:          vals.Get("traceTime"),
 		SettleDate:         vals.Get("settleDate"),
 		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
-		SettleAmt:          vals.Get("settleAmt"),
+		SettleAmt:          settleAmt,
+		InstalTransInfo:    vals.Get("instalTransInfo"),
 	}
 
 	if resp.RespCode != "00" {
@@ -259,14 +278,14 @@ type FrontConsumeNotifyResponse struct {
 	MerID              string // 商户代码 R
 	OrderID            string // 商户订单号 R
 	TxnTime            string // 订单发送时间 R
-	TxnAmt             string // 交易金额 R
+	TxnAmt             Amount // 交易金额 R
 	CurrencyCode       string // 交易币种 R
 	ReqReserved        string // 请求方保留域 R
 	Reserved           string // 保留域 O
 	QueryID            string // 交易查询流水号 M 消费交易的流水号，供后续查询用
 	RespCode           string // 响应码 M
 	RespMsg            string // 响应消息 M
-	SettleAmt          string // 清算金额 M
+	SettleAmt          Amount // 清算金额 M
 	SettleCurrencyCode string // 清算币种 M
 	SettleDate         string // 清算日期 M
 	TraceNo            string // 系统跟踪号 M
@@ -279,6 +298,7 @@ type FrontConsumeNotifyResponse struct {
 	PayCardNo          string // 支付卡标示 C 移动支付交易时，根据商户配置返回
 	PayCardIssueName   string // 支付卡名称 C 移动支付交易时，根据商户配置返回
 	BindID             string // 绑定标示号 R 绑定支付时，根据商户配置返回
+	InstalTransInfo    string // 分期付款信息域 C 分期付款交易时返回
 }
 
 func (up *UnionPay) FrontConsumeNotify(req *http.Request) (resp *FrontConsumeNotifyResponse, err error) {
@@ -320,9 +340,19 @@ func (up *UnionPay) FrontConsumeNotify(req *http.Request) (resp *FrontConsumeNot
 		"payCardNo",
 		"payCardIssueName",
 		"bindId",
+		"instalTransInfo",
+	}
+
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
 	}
+	return newFrontConsumeNotifyResponse(vals)
+}
 
-	if err = verify(up.verifySignCert.PublicKey.(*rsa.PublicKey), vals, fields); err != nil {
+// newFrontConsumeNotifyResponse 解析已验签的消费通知
+func newFrontConsumeNotifyResponse(vals url.Values) (resp *FrontConsumeNotifyResponse, err error) {
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
 		return
 	}
 
@@ -339,14 +369,14 @@ func (up *UnionPay) FrontConsumeNotify(req *http.Request) (resp *FrontConsumeNot
 		MerID:              vals.Get("merId"),
 		OrderID:            vals.Get("orderId"),
 		TxnTime:            vals.Get("txnTime"),
-		TxnAmt:             vals.Get("txnAmt"),
+		TxnAmt:             txnAmt,
 		CurrencyCode:       vals.Get("currencyCode"),
 		ReqReserved:        vals.Get("reqReserved"),
 		Reserved:           vals.Get("reserved"),
 		QueryID:            vals.Get("queryId"),
 		RespCode:           vals.Get("respCode"),
 		RespMsg:            vals.Get("respMsg"),
-		SettleAmt:          vals.Get("settleAmt"),
+		SettleAmt:          settleAmt,
 		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
 		SettleDate:         vals.Get("settleDate"),
 		TraceNo:            vals.Get("traceNo"),
@@ -359,6 +389,7 @@ func (up *UnionPay) FrontConsumeNotify(req *http.Request) (resp *FrontConsumeNot
 		PayCardNo:          vals.Get("payCardNo"),
 		PayCardIssueName:   vals.Get("payCardIssueName"),
 		BindID:             vals.Get("bindId"),
+		InstalTransInfo:    vals.Get("instalTransInfo"),
 	}
 
 	return
@@ -0,0 +1,212 @@
+package unionpay
+
+import (
+	"net/http"
+)
+
+var b2bConsumeParamMap = map[string]bool{
+	"version":      true,  // 版本号 固定填写5.0.0
+	"encoding":     true,  // 编码方式 默认值 UTF-8
+	"certId":       true,  // 证书id
+	"signature":    true,  // 签名 填写对报文摘要的签名
+	"signMethod":   true,  // 签名方式 取值：01 表示采用的是RSA
+	"txnType":      true,  // 交易类型 取值：01
+	"txnSubType":   true,  // 交易子类 取值：01
+	"bizType":      true,  // 产品类型 000202 B2B
+	"channelType":  true,  // 渠道类型 B2B仅支持07:互联网
+	"frontUrl":     true,  // 前台通知地址 企业网银支付完成后跳转回商户的地址
+	"backUrl":      true,  // 后台通知地址
+	"accessType":   true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
+	"merId":        true,  // 商户代码
+	"acqInsCode":   false, // 收单机构代码 收单机构接入时必须上送
+	"orderId":      true,  // 商户订单号 商户端生成
+	"txnTime":      true,  // 订单发送时间 商户发送交易时间
+	"txnAmt":       true,  // 交易金额 单位为分
+	"currencyCode": true,  // 交易币种 默认为156
+	"issInsCode":   false, // 发卡机构代码 上送时直接跳转到对应银行的企业网银,不上送时由用户在银联页面选择
+	"payTimeout":   false, // 订单支付超时时间
+	"orderDesc":    false, // 订单描述
+	"reqReserved":  false, // 请求方保留域 商户自定义保留域，交易应答时会原样返回
+	"reserved":     false, // 保留域
+	"riskRateInfo": false, // 风险信息域
+	"frontFailUrl": false, // 失败交易前台跳转地址
+	"subMerId":     false, // 二级商户代码 商户类型为平台商户接入时必须上送
+	"subMerName":   false, // 二级商户全称 商户类型为平台商户接入时必须上送
+	"subMerAbbr":   false, // 二级商户简称 商户类型为平台商户接入时必须上送
+}
+
+// FrontConsumeB2B 企业网银(B2B)前台消费,issInsCode为空时由用户在银联页面选择银行
+func (up *UnionPay) FrontConsumeB2B(orderID string, amount Amount, issInsCode, returnURL, notifyURL string, extraParams map[string]string) (html string, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params := up.initFrontConsumeB2BParams(cred, orderID, amount, issInsCode, returnURL, notifyURL, extraParams)
+	kvs, err := GenKVpairs(b2bConsumeParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+	html, err = up.checkoutHTML(kvs)
+	return
+}
+
+func (up *UnionPay) initFrontConsumeB2BParams(cred *credentials, orderID string, amount Amount, issInsCode, returnURL, notifyURL string, extraParams map[string]string) (params map[string]string) {
+	params = make(map[string]string)
+
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "UTF-8"                       //编码方式
+	params["certId"] = cred.certID                     //证书id
+	params["signMethod"] = cred.signMethod()           //签名方法
+	params["txnType"] = "01"                           //交易类型
+	params["txnSubType"] = "01"                        //交易子类
+	params["bizType"] = "000202"                       //业务类型 B2B
+	params["channelType"] = "07"                       //渠道类型 B2B仅支持PC
+	params["merId"] = up.mchID                         //商户代码
+	params["frontUrl"] = returnURL                     //前台通知地址
+	params["backUrl"] = notifyURL                      //后台通知地址
+	params["orderId"] = orderID                        //商户订单号
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["txnTime"] = up.txnTime()                   //订单发送时间
+	params["txnAmt"] = amount.txnAmt()                 //交易金额，最小货币单位
+	params["issInsCode"] = issInsCode                  //发卡机构代码
+
+	if extraParams != nil {
+		for k, v := range extraParams {
+			_, ok := b2bConsumeParamMap[k]
+			if ok {
+				params[k] = v
+			}
+		}
+	}
+	params["channelType"] = "07" //B2B仅支持PC,不允许extraParams覆盖
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
+	return
+}
+
+type B2BConsumeNotifyResponse struct {
+	Version            string // 版本号 R
+	Encoding           string // 编码方式 R
+	CertID             string // 证书id  M
+	Signature          string // 签名 M
+	SignMethod         string // 签名方式 M
+	TxnType            string // 交易类型 R
+	TxnSubType         string // 交易子类 R
+	BizType            string // 产品类型 R
+	AccessType         string // 接入类型 R
+	MerID              string // 商户代码 R
+	OrderID            string // 商户订单号 R
+	TxnTime            string // 订单发送时间 R
+	TxnAmt             Amount // 交易金额 R
+	CurrencyCode       string // 交易币种 R
+	ReqReserved        string // 请求方保留域 R
+	Reserved           string // 保留域 O
+	QueryID            string // 交易查询流水号 M
+	RespCode           string // 响应码 M
+	RespMsg            string // 响应消息 M
+	SettleAmt          Amount // 清算金额 M
+	SettleCurrencyCode string // 清算币种 M
+	SettleDate         string // 清算日期 M
+	TraceNo            string // 系统跟踪号 M
+	TraceTime          string // 交易传输时间 M
+	IssInsCode         string // 发卡机构代码 C 付款企业网银所属银行
+	PayType            string // 支付方式 C 0201:网银支付
+	AccNo              string // 付款账号 C 根据商户配置返回
+	PayCardIssueName   string // 付款银行名称 C 根据商户配置返回
+}
+
+// FrontConsumeB2BNotify 企业网银消费后台通知
+func (up *UnionPay) FrontConsumeB2BNotify(req *http.Request) (resp *B2BConsumeNotifyResponse, err error) {
+	if err = req.ParseForm(); err != nil {
+		return
+	}
+	vals := req.Form
+
+	if len(vals) == 0 {
+		err = ErrNotifyDataIsEmpty
+		return
+	}
+
+	var fields = []string{
+		"version",
+		"encoding",
+		"certId",
+		"signature",
+		"signMethod",
+		"txnType",
+		"txnSubType",
+		"bizType",
+		"accessType",
+		"merId",
+		"orderId",
+		"txnTime",
+		"txnAmt",
+		"currencyCode",
+		"reqReserved",
+		"reserved",
+		"queryId",
+		"respCode",
+		"respMsg",
+		"settleAmt",
+		"settleCurrencyCode",
+		"settleDate",
+		"traceNo",
+		"traceTime",
+		"issInsCode",
+		"payType",
+		"accNo",
+		"payCardIssueName",
+	}
+
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
+	}
+
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
+		return
+	}
+
+	resp = &B2BConsumeNotifyResponse{
+		Version:            vals.Get("version"),
+		Encoding:           vals.Get("encoding"),
+		CertID:             vals.Get("certId"),
+		Signature:          vals.Get("signature"),
+		SignMethod:         vals.Get("signMethod"),
+		TxnType:            vals.Get("txnType"),
+		TxnSubType:         vals.Get("txnSubType"),
+		BizType:            vals.Get("bizType"),
+		AccessType:         vals.Get("accessType"),
+		MerID:              vals.Get("merId"),
+		OrderID:            vals.Get("orderId"),
+		TxnTime:            vals.Get("txnTime"),
+		TxnAmt:             txnAmt,
+		CurrencyCode:       vals.Get("currencyCode"),
+		ReqReserved:        vals.Get("reqReserved"),
+		Reserved:           vals.Get("reserved"),
+		QueryID:            vals.Get("queryId"),
+		RespCode:           vals.Get("respCode"),
+		RespMsg:            vals.Get("respMsg"),
+		SettleAmt:          settleAmt,
+		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
+		SettleDate:         vals.Get("settleDate"),
+		TraceNo:            vals.Get("traceNo"),
+		TraceTime:          vals.Get("traceTime"),
+		IssInsCode:         vals.Get("issInsCode"),
+		PayType:            vals.Get("payType"),
+		AccNo:              vals.Get("accNo"),
+		PayCardIssueName:   vals.Get("payCardIssueName"),
+	}
+
+	return
+}
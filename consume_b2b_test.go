@@ -0,0 +1,80 @@
+package unionpay
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFrontConsumeB2B(t *testing.T) {
+	up := newTestPayment(t)
+
+	for _, c := range []struct {
+		issInsCode string
+		extra      map[string]string
+	}{
+		{issInsCode: "ICBC"},
+		{issInsCode: ""}, // 由用户在银联页面选择银行
+		{issInsCode: "CMB", extra: map[string]string{"channelType": "08"}}, // B2B仅支持PC,extraParams不能覆盖channelType
+	} {
+		page, err := up.FrontConsumeB2B("B2B20240102001", Fen(1000000), c.issInsCode, "https://example.com/return", "https://example.com/notify", c.extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		form := htmlForm(t, page)
+		for k, want := range map[string]string{
+			"txnType":     "01",
+			"txnSubType":  "01",
+			"bizType":     "000202",
+			"channelType": "07",
+			"txnAmt":      "1000000",
+			"issInsCode":  c.issInsCode,
+		} {
+			if got := form.Get(k); got != want {
+				t.Errorf("issInsCode %q: %s got %q, want %q", c.issInsCode, k, got, want)
+			}
+		}
+		if _, ok := form["issInsCode"]; !ok && c.issInsCode != "" {
+			t.Errorf("issInsCode %q not sent", c.issInsCode)
+		}
+	}
+}
+
+func TestFrontConsumeB2BNotify(t *testing.T) {
+	up := newTestPayment(t)
+
+	vals := url.Values{}
+	vals.Set("version", "5.0.0")
+	vals.Set("encoding", "UTF-8")
+	vals.Set("signMethod", "01")
+	vals.Set("txnType", "01")
+	vals.Set("txnSubType", "01")
+	vals.Set("bizType", "000202")
+	vals.Set("accessType", "0")
+	vals.Set("merId", "700000000000001")
+	vals.Set("orderId", "B2B20240102001")
+	vals.Set("txnTime", "20240102140000")
+	vals.Set("txnAmt", "1000000")
+	vals.Set("currencyCode", "156")
+	vals.Set("queryId", "202401021400001234567")
+	vals.Set("respCode", "00")
+	vals.Set("respMsg", "success")
+	vals.Set("issInsCode", "ICBC")
+	vals.Set("payType", "0201")
+	vals.Set("payCardIssueName", "工商银行")
+
+	resp, err := up.FrontConsumeB2BNotify(signedNotify(t, up, vals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.BizType != "000202" || resp.IssInsCode != "ICBC" || resp.PayType != "0201" || resp.PayCardIssueName != "工商银行" || resp.TxnAmt != Fen(1000000) {
+		t.Errorf("unexpected notify %+v", resp)
+	}
+
+	// 白名单外的域参与签名时验签失败
+	vals.Del("signature")
+	vals.Set("bindId", "B0001")
+	if _, err = up.FrontConsumeB2BNotify(signedNotify(t, up, vals)); err == nil {
+		t.Error("accepted a field outside the B2B notify whitelist")
+	}
+}
@@ -10,6 +10,7 @@ type ConsumeQueryResponse struct {
 	SignMethod         string
 	TxnType            string
 	TxnSubType         string
+	BizType            string // 产品类型 撤销或退货时沿用
 	AccessType         string
 	MerID              string
 	OrderID            string
@@ -18,7 +19,7 @@ type ConsumeQueryResponse struct {
 	CurrencyCode       string
 	AccNo              string
 	PayCardType        string
-	TxnAmt             string // 长度为1到12字节的变长整型数值，以分为单位
+	TxnAmt             Amount // 交易金额，以币种的最小货币单位表示
 	ReqReserved        string
 	Reserved           string
 	IssuerIdentifyMode string
@@ -27,24 +28,29 @@ type ConsumeQueryResponse struct {
 	TraceTime          string
 	SettleDate         string
 	SettleCurrencyCode string
-	SettleAmt          string
+	SettleAmt          Amount
+	ExchangeRate       string // 汇率 境外交易时返回
+	ExchangeDate       string // 兑换日期 境外交易时返回
 	OrigRespCode       string
 	OrigRespMsg        string
 	RespCode           string
 	RespMsg            string
+	InstalTransInfo    string // 分期付款信息域 分期付款交易时返回
 }
 
 func (up *UnionPay) ConsumeQuery(orderID, queryID, txnTime, reserved string) (resp *ConsumeQueryResponse, err error) {
+	cred := up.creds()
+
 	kvs := KVpairs{}
 
-	kvs = append(kvs, KVpair{K: "version", V: "5.0.0"})
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
 	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
-	kvs = append(kvs, KVpair{K: "certId", V: up.publicKey.SerialNumber.String()})
-	kvs = append(kvs, KVpair{K: "signMethod", V: "01"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
 	kvs = append(kvs, KVpair{K: "txnType", V: "00"})
 	kvs = append(kvs, KVpair{K: "txnSubType", V: "00"})
 	kvs = append(kvs, KVpair{K: "bizType", V: "000000"})
-	kvs = append(kvs, KVpair{K: "accessType", V: "0"})
+	kvs = append(kvs, up.access.kvpairs()...)
 	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
 	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
 	kvs = append(kvs, KVpair{K: "orderId", V: orderID})
@@ -53,7 +59,7 @@ func (up *UnionPay) ConsumeQuery(orderID, queryID, txnTime, reserved string) (re
 	kvs = append(kvs, KVpair{K: "queryId", V: queryID})
 
 	var sig string
-	sig, err = signature(up.privateKey, kvs)
+	sig, err = up.sign(cred, kvs)
 	if err != nil {
 		return
 	}
@@ -72,7 +78,7 @@ func (up *UnionPay) ConsumeQuery(orderID, queryID, txnTime, reserved string) (re
 	}
 
 	var result ConsumeQueryResponse
-	err = up.client.PostForm(u, data, &result)
+	err = up.client.PostForm(up.context(), u, data, &result)
 	if err != nil {
 		return
 	}
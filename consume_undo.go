@@ -1,11 +1,8 @@
 package unionpay
 
 import (
-	"crypto/rsa"
-	"fmt"
 	"net/http"
 	"net/url"
-	"time"
 )
 
 type ConsumeUndoResponse struct {
@@ -21,7 +18,7 @@ type ConsumeUndoResponse struct {
 	MerID       string
 	OrderID     string
 	TxnTime     string
-	TxnAmt      string // 长度为1到12字节的变长整型数值，以分为单位
+	TxnAmt      Amount // 交易金额，以币种的最小货币单位表示
 	ReqReserved string
 	Reserved    string
 	QueryID     string
@@ -30,29 +27,39 @@ type ConsumeUndoResponse struct {
 	RespMsg     string
 }
 
-func (up *UnionPay) ConsumeUndo(orderID, returnURL string, amount int64, originQueryID, reqReserved, reserved string) (resp *ConsumeUndoResponse, err error) {
+func (up *UnionPay) ConsumeUndo(orderID, returnURL string, amount Amount, originQueryID, reqReserved, reserved string) (resp *ConsumeUndoResponse, err error) {
+	return up.consumeUndo("000201", orderID, up.txnTime(), returnURL, amount, originQueryID, reqReserved, reserved)
+}
+
+func (up *UnionPay) consumeUndo(bizType, orderID, txnTime, returnURL string, amount Amount, originQueryID, reqReserved, reserved string) (resp *ConsumeUndoResponse, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
 	kvs := KVpairs{}
 
-	kvs = append(kvs, KVpair{K: "version", V: "5.0.0"})
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
 	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
-	kvs = append(kvs, KVpair{K: "certId", V: up.publicKey.SerialNumber.String()})
-	kvs = append(kvs, KVpair{K: "signMethod", V: "01"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
 	kvs = append(kvs, KVpair{K: "txnType", V: "31"})
 	kvs = append(kvs, KVpair{K: "txnSubType", V: "00"})
-	kvs = append(kvs, KVpair{K: "bizType", V: "000201"})
+	kvs = append(kvs, KVpair{K: "bizType", V: bizType})
 	kvs = append(kvs, KVpair{K: "backUrl", V: returnURL})
-	kvs = append(kvs, KVpair{K: "accessType", V: "0"})
+	kvs = append(kvs, up.access.kvpairs()...)
 	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
 	kvs = append(kvs, KVpair{K: "orderId", V: orderID})
-	kvs = append(kvs, KVpair{K: "txnTime", V: time.Now().Format("20060102150405")})
-	kvs = append(kvs, KVpair{K: "txnAmt", V: fmt.Sprint(amount)})
+	kvs = append(kvs, KVpair{K: "txnTime", V: txnTime})
+	kvs = append(kvs, KVpair{K: "txnAmt", V: amount.txnAmt()})
 	kvs = append(kvs, KVpair{K: "reqReserved", V: reqReserved})
 	kvs = append(kvs, KVpair{K: "reserved", V: reserved})
 	kvs = append(kvs, KVpair{K: "origQryId", V: originQueryID})
 	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
 
 	var sig string
-	sig, err = signature(up.privateKey, kvs)
+	sig, err = up.sign(cred, kvs)
 	if err != nil {
 		return
 	}
@@ -71,7 +78,7 @@ func (up *UnionPay) ConsumeUndo(orderID, returnURL string, amount int64, originQ
 	}
 
 	var result ConsumeUndoResponse
-	err = up.client.PostForm(u, data, &result)
+	err = up.client.PostForm(up.context(), u, data, &result)
 	if err != nil {
 		return
 	}
@@ -93,7 +100,7 @@ type ConsumeUndoNotifyResponse struct {
 	OrderID            string
 	TxnTime            string
 	CurrencyCode       string
-	TxnAmt             string // 长度为1到12字节的变长整型数值，以分为单位
+	TxnAmt             Amount // 交易金额，以币种的最小货币单位表示
 	ReqReserved        string
 	Reserved           string
 	QueryID            string
@@ -102,7 +109,7 @@ type ConsumeUndoNotifyResponse struct {
 	TraceTime          string
 	SettleDate         string
 	SettleCurrencyCode string
-	SettleAmt          string
+	SettleAmt          Amount
 	RespCode           string
 	RespMsg            string
 }
@@ -140,7 +147,12 @@ func (up *UnionPay) ConsumeUndoNotify(req *http.Request) (resp *ConsumeUndoNotif
 		"respCode",
 		"respMsg",
 	}
-	if err = verify(up.verifySignCert.PublicKey.(*rsa.PublicKey), vals, fields); err != nil {
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
+	}
+
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
 		return
 	}
 
@@ -158,7 +170,7 @@ func (up *UnionPay) ConsumeUndoNotify(req *http.Request) (resp *ConsumeUndoNotif
 		OrderID:            vals.Get("orderId"),
 		TxnTime:            vals.Get("txnTime"),
 		CurrencyCode:       vals.Get("currencyCode"),
-		TxnAmt:             vals.Get("txnAmt"),
+		TxnAmt:             txnAmt,
 		ReqReserved:        vals.Get("reqReserved"),
 		Reserved:           vals.Get("reserved"),
 		QueryID:            vals.Get("queryId"),
@@ -167,7 +179,7 @@ func (up *UnionPay) ConsumeUndoNotify(req *http.Request) (resp *ConsumeUndoNotif
 		TraceTime:          vals.Get("traceTime"),
 		SettleDate:         vals.Get("settleDate"),
 		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
-		SettleAmt:          vals.Get("settleAmt"),
+		SettleAmt:          settleAmt,
 		RespCode:           vals.Get("respCode"),
 		RespMsg:            vals.Get("respMsg"),
 	}
@@ -0,0 +1,300 @@
+package unionpay
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shima-park/unionpay/gm"
+)
+
+const (
+	// DefaultExpiryWarningDays 证书剩余有效天数小于该值时Health报告告警
+	DefaultExpiryWarningDays = 30
+	// DefaultVerifyCertGracePeriod 重新加载证书后,替换前的银联验签证书继续用于路由及验证通知的时长
+	// 银联可能在证书切换前后一段时间内仍使用原证书签名通知或重发通知
+	DefaultVerifyCertGracePeriod = 72 * time.Hour
+)
+
+var ErrMerIDMismatch = errors.New("credentials belong to another merchant")
+
+// CertKind 证书用途
+type CertKind string
+
+const (
+	CertSign    CertKind = "sign"    // 商户签名证书
+	CertVerify  CertKind = "verify"  // 银联验签证书
+	CertEncrypt CertKind = "encrypt" // 银联敏感信息加密证书
+)
+
+// CertInfo 证书信息
+type CertInfo struct {
+	Kind         CertKind
+	SerialNumber string
+	Subject      string
+	NotBefore    time.Time
+	NotAfter     time.Time
+}
+
+// DaysUntilExpiry 距离过期的天数,已过期时为负数
+func (c CertInfo) DaysUntilExpiry(now time.Time) int {
+	return int(math.Floor(c.NotAfter.Sub(now).Hours() / 24))
+}
+
+func x509CertInfo(kind CertKind, c *x509.Certificate) CertInfo {
+	return CertInfo{
+		Kind:         kind,
+		SerialNumber: c.SerialNumber.String(),
+		Subject:      c.Subject.String(),
+		NotBefore:    c.NotBefore,
+		NotAfter:     c.NotAfter,
+	}
+}
+
+func sm2CertInfo(kind CertKind, c *gm.Certificate) CertInfo {
+	return CertInfo{
+		Kind:         kind,
+		SerialNumber: c.SerialNumber.String(),
+		Subject:      c.Subject.String(),
+		NotBefore:    c.NotBefore,
+		NotAfter:     c.NotAfter,
+	}
+}
+
+// credentials 证书及密钥,创建后不再修改,整体原子替换
+// 每笔交易开始时取一次,保证certId与签名来自同一套证书
+type credentials struct {
+	signer       Signer            //报文签名器
+	certID       string            //签名证书序列号 上送certId
+	signPub      crypto.PublicKey  //签名证书公钥 用于校验替换的签名器
+	privateKey   *rsa.PrivateKey   //签名私钥 用于解密应答中的敏感信息,使用外部签名器时为空
+	verifier     Verifier          //验签
+	verifyCertID string            //银联验签证书序列号 通知中的certId
+	encrypter    DataEncrypter     //敏感信息加密
+	certs        []CertInfo        //证书有效期
+	retired      []retiredVerifier //替换前的验签证书
+}
+
+// retiredVerifier 重新加载前的验签证书,until之前仍接受该证书签名的通知及应答
+type retiredVerifier struct {
+	certID   string
+	verifier Verifier
+	until    time.Time
+}
+
+// verifierFor 按报文中的certId选择验签证书,宽限期内接受替换前的证书,未知certId返回当前证书
+func (c *credentials) verifierFor(certID string, now time.Time) (v Verifier, ok bool) {
+	if certID == c.verifyCertID {
+		return c.verifier, true
+	}
+	for _, r := range c.retired {
+		if r.certID == certID && now.Before(r.until) {
+			return r.verifier, true
+		}
+	}
+	return c.verifier, false
+}
+
+// retire 替换为next时保留当前及仍在宽限期内的验签证书,当前证书保留grace
+func (c *credentials) retire(next *credentials, now time.Time, grace time.Duration) []retiredVerifier {
+	var retired []retiredVerifier
+	for _, r := range c.retired {
+		if r.certID != next.verifyCertID && now.Before(r.until) {
+			retired = append(retired, r)
+		}
+	}
+	if c.verifyCertID != next.verifyCertID && grace > 0 {
+		retired = append(retired, retiredVerifier{certID: c.verifyCertID, verifier: c.verifier, until: now.Add(grace)})
+	}
+	return retired
+}
+
+// signMethod 签名方法
+func (c *credentials) signMethod() string {
+	return c.signer.SignMethod()
+}
+
+// version 版本号 RSA使用5.0.0,国密使用5.1.0
+func (c *credentials) version() string {
+	if c.signMethod() == SignMethodRSA {
+		return "5.0.0"
+	}
+	return "5.1.0"
+}
+
+func (c *credentials) withCert(info CertInfo) []CertInfo {
+	certs := make([]CertInfo, 0, len(c.certs)+1)
+	for _, ci := range c.certs {
+		if ci.Kind != info.Kind {
+			certs = append(certs, ci)
+		}
+	}
+	return append(certs, info)
+}
+
+// credentialStore 由WithAccess复制出的UnionPay共享,替换后所有副本同时生效
+type credentialStore struct {
+	mu sync.Mutex // 串行化更新
+	v  atomic.Value
+}
+
+func newCredentialStore(c *credentials) *credentialStore {
+	s := new(credentialStore)
+	s.v.Store(c)
+	return s
+}
+
+func (s *credentialStore) load() *credentials {
+	return s.v.Load().(*credentials)
+}
+
+// update 复制当前证书修改后替换
+func (s *credentialStore) update(fn func(c *credentials)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *s.load()
+	fn(&c)
+	s.v.Store(&c)
+}
+
+func (up *UnionPay) creds() *credentials {
+	return up.cred.load()
+}
+
+// SetExpiryWarningDays 设置证书剩余有效天数小于days时Health报告告警,默认DefaultExpiryWarningDays
+func (up *UnionPay) SetExpiryWarningDays(days int) *UnionPay {
+	up.expiryWarningDays = days
+	return up
+}
+
+// SetVerifyCertGracePeriod 设置重新加载证书后替换前的验签证书的保留时长,默认DefaultVerifyCertGracePeriod,0为不保留
+func (up *UnionPay) SetVerifyCertGracePeriod(d time.Duration) *UnionPay {
+	up.verifyCertGrace = d
+	return up
+}
+
+// ReloadCredentials 按配置重新加载证书并原子替换,进行中的交易继续使用替换前的证书
+// 配置中的merId必须与当前商户一致,未配置加密证书时保留原加密证书
+// 替换前的验签证书在宽限期内仍用于路由及验证通知,见SetVerifyCertGracePeriod
+func (up *UnionPay) ReloadCredentials(cfg MerchantConfig) error {
+	if cfg.MerID != up.mchID {
+		return fmt.Errorf("%w: %s", ErrMerIDMismatch, cfg.MerID)
+	}
+
+	n, err := NewPaymentFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	next := n.creds()
+	now := up.now()
+	up.cred.update(func(c *credentials) {
+		encrypter, certs := c.encrypter, c.certs
+		retired := c.retire(next, now, up.verifyCertGrace)
+		*c = *next
+		c.retired = retired
+		if cfg.EncryptCert == "" && encrypter != nil {
+			c.encrypter = encrypter
+			for _, ci := range certs {
+				if ci.Kind == CertEncrypt {
+					c.certs = c.withCert(ci)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Certs 当前使用的证书
+func (up *UnionPay) Certs() []CertInfo {
+	return append([]CertInfo(nil), up.creds().certs...)
+}
+
+// ExpiryFunc 证书有效期回调,可用于告警或上报监控指标
+type ExpiryFunc func(merID string, cert CertInfo, daysLeft int)
+
+// WatchCertExpiry 立即并每隔interval报告一次全部证书的剩余有效天数,调用返回的函数停止
+func (up *UnionPay) WatchCertExpiry(interval time.Duration, fn ExpiryFunc) (stop func()) {
+	done := make(chan struct{})
+	report := func() {
+		now := up.now()
+		for _, ci := range up.Certs() {
+			fn(up.mchID, ci, ci.DaysUntilExpiry(now))
+		}
+	}
+
+	go func() {
+		report()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// CertStatus 证书状态
+type CertStatus struct {
+	CertInfo
+	DaysLeft int
+}
+
+// CredentialHealth 证书及密钥状态汇总
+type CredentialHealth struct {
+	MerID      string
+	SignMethod string
+	CertID     string
+	CanDecrypt bool // 是否可解密应答中的敏感信息
+	CanEncrypt bool // 是否可加密上送敏感信息
+	Certs      []CertStatus
+	Healthy    bool     // 全部证书均在有效期内
+	Problems   []string // 已过期,未生效或即将过期的证书
+}
+
+// Health 汇总当前证书及密钥状态
+func (up *UnionPay) Health() CredentialHealth {
+	c := up.creds()
+	now := up.now()
+
+	h := CredentialHealth{
+		MerID:      up.mchID,
+		SignMethod: c.signMethod(),
+		CertID:     c.certID,
+		CanDecrypt: c.privateKey != nil,
+		CanEncrypt: c.encrypter != nil,
+		Healthy:    true,
+	}
+	for _, ci := range c.certs {
+		days := ci.DaysUntilExpiry(now)
+		h.Certs = append(h.Certs, CertStatus{CertInfo: ci, DaysLeft: days})
+
+		switch {
+		case now.After(ci.NotAfter):
+			h.Healthy = false
+			h.Problems = append(h.Problems, fmt.Sprintf("%s cert %s expired at %s", ci.Kind, ci.SerialNumber, ci.NotAfter.Format(time.RFC3339)))
+		case now.Before(ci.NotBefore):
+			h.Healthy = false
+			h.Problems = append(h.Problems, fmt.Sprintf("%s cert %s not valid until %s", ci.Kind, ci.SerialNumber, ci.NotBefore.Format(time.RFC3339)))
+		case days < up.expiryWarningDays:
+			h.Problems = append(h.Problems, fmt.Sprintf("%s cert %s expires in %d days", ci.Kind, ci.SerialNumber, days))
+		}
+	}
+	return h
+}
@@ -0,0 +1,201 @@
+package unionpay
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadCredentialsMerIDMismatch(t *testing.T) {
+	up := newTestPayment(t)
+	certID := up.creds().certID
+
+	err := up.ReloadCredentials(MerchantConfig{MerID: "700000000000002", SignCert: "key.cert", PrivateKey: "key.pem", VerifyCert: "key.cert"})
+	if !errors.Is(err, ErrMerIDMismatch) {
+		t.Errorf("err = %v, want %v", err, ErrMerIDMismatch)
+	}
+	if got := up.creds().certID; got != certID {
+		t.Errorf("certId changed to %s", got)
+	}
+}
+
+func TestReloadKeepsRetiredVerifyCert(t *testing.T) {
+	up := newTestPayment(t)
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, Beijing)
+	up.SetClock(ClockFunc(func() time.Time { return now }))
+
+	r := NewRegistry()
+	r.Add(up)
+	oldCertID := up.creds().verifyCertID
+
+	// 签名在切换前生成,使用原验签证书对应的私钥
+	vals := url.Values{
+		"version":  {"5.0.0"},
+		"merId":    {up.MerID()},
+		"orderId":  {"ORDER0001"},
+		"txnType":  {"01"},
+		"certId":   {oldCertID},
+		"respCode": {"00"},
+	}
+	notify := signedNotify(t, up, vals)
+	if err := notify.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+
+	newVerifyCert := writeTestCert(t, testKey(t), 20240102)
+	err := up.ReloadCredentials(MerchantConfig{MerID: up.MerID(), SignCert: "key.cert", PrivateKey: "key.pem", VerifyCert: newVerifyCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up.creds().verifyCertID != "20240102" {
+		t.Fatalf("verifyCertId = %s after reload", up.creds().verifyCertID)
+	}
+
+	if got, err := r.Route(routeRequest(t, up.MerID(), oldCertID)); err != nil || got != up {
+		t.Errorf("old certId within grace period: %p, %v", got, err)
+	}
+	if got, err := r.Route(routeRequest(t, up.MerID(), "20240102")); err != nil || got != up {
+		t.Errorf("new certId: %p, %v", got, err)
+	}
+	if err = up.verifyNotify(notify.Form, nil); err != nil {
+		t.Errorf("notify signed with the retired cert: %v", err)
+	}
+
+	now = now.Add(DefaultVerifyCertGracePeriod)
+	if _, err = r.Route(routeRequest(t, up.MerID(), oldCertID)); !errors.Is(err, ErrUnknownCertID) {
+		t.Errorf("old certId after grace period err = %v, want %v", err, ErrUnknownCertID)
+	}
+	if err = up.verifyNotify(notify.Form, nil); err == nil {
+		t.Error("notify signed with the retired cert verified after grace period")
+	}
+}
+
+func TestReloadWithoutGracePeriod(t *testing.T) {
+	up := newTestPayment(t).SetVerifyCertGracePeriod(0)
+	oldCertID := up.creds().verifyCertID
+
+	newVerifyCert := writeTestCert(t, testKey(t), 20240102)
+	err := up.ReloadCredentials(MerchantConfig{MerID: up.MerID(), SignCert: "key.cert", PrivateKey: "key.pem", VerifyCert: newVerifyCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := up.creds().verifierFor(oldCertID, up.now()); ok {
+		t.Error("old verify cert kept with grace period 0")
+	}
+}
+
+func TestRetireKeepsEarlierCerts(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, Beijing)
+	c := &credentials{verifyCertID: "2", retired: []retiredVerifier{
+		{certID: "1", until: now.Add(time.Hour)},
+		{certID: "0", until: now},
+	}}
+
+	retired := c.retire(&credentials{verifyCertID: "3"}, now, time.Hour)
+	var ids []string
+	for _, r := range retired {
+		ids = append(ids, r.certID)
+	}
+	if strings.Join(ids, ",") != "1,2" {
+		t.Errorf("retired = %v, want 1,2", ids)
+	}
+
+	if retired = c.retire(&credentials{verifyCertID: "2"}, now, time.Hour); len(retired) != 1 || retired[0].certID != "1" {
+		t.Errorf("reload with the same verify cert retired %+v", retired)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, Beijing)
+	up := newTestPayment(t).SetExpiryWarningDays(10)
+	up.SetClock(ClockFunc(func() time.Time { return now }))
+
+	valid := CertInfo{Kind: CertSign, SerialNumber: "1", NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.AddDate(1, 0, 0)}
+	tests := []struct {
+		name     string
+		cert     CertInfo
+		healthy  bool
+		problem  string
+		daysLeft int
+	}{
+		{"valid", valid, true, "", 366},
+		{"expired", CertInfo{Kind: CertVerify, SerialNumber: "2", NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.Add(-time.Hour)}, false, "verify cert 2 expired", -1},
+		{"not yet valid", CertInfo{Kind: CertVerify, SerialNumber: "3", NotBefore: now.Add(time.Hour), NotAfter: now.AddDate(1, 0, 0)}, false, "verify cert 3 not valid until", 366},
+		{"expiring", CertInfo{Kind: CertEncrypt, SerialNumber: "4", NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.AddDate(0, 0, 9).Add(time.Hour)}, true, "encrypt cert 4 expires in 9 days", 9},
+	}
+	for _, tt := range tests {
+		up.cred.update(func(c *credentials) {
+			c.certs = []CertInfo{tt.cert}
+		})
+
+		h := up.Health()
+		if h.Healthy != tt.healthy {
+			t.Errorf("%s: Healthy = %v, want %v", tt.name, h.Healthy, tt.healthy)
+		}
+		if len(h.Certs) != 1 || h.Certs[0].DaysLeft != tt.daysLeft {
+			t.Errorf("%s: Certs = %+v, want DaysLeft %d", tt.name, h.Certs, tt.daysLeft)
+		}
+		switch {
+		case tt.problem == "" && len(h.Problems) != 0:
+			t.Errorf("%s: Problems = %v", tt.name, h.Problems)
+		case tt.problem != "" && (len(h.Problems) != 1 || !strings.HasPrefix(h.Problems[0], tt.problem)):
+			t.Errorf("%s: Problems = %v, want %q", tt.name, h.Problems, tt.problem)
+		}
+	}
+
+	if h := up.Health(); h.MerID != up.MerID() || h.SignMethod != SignMethodRSA || !h.CanDecrypt || !h.CanEncrypt {
+		t.Errorf("Health = %+v", h)
+	}
+}
+
+func TestWatchCertExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, Beijing)
+	up := newTestPayment(t)
+	up.SetClock(ClockFunc(func() time.Time { return now }))
+	up.cred.update(func(c *credentials) {
+		c.certs = []CertInfo{{Kind: CertSign, SerialNumber: "1", NotAfter: now.AddDate(0, 0, 20)}}
+	})
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	reported := make(chan struct{}, 16)
+	stop := up.WatchCertExpiry(time.Millisecond, func(merID string, cert CertInfo, daysLeft int) {
+		if merID != up.MerID() || cert.SerialNumber != "1" || daysLeft != 20 {
+			t.Errorf("report %s %+v %d", merID, cert, daysLeft)
+		}
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		select {
+		case reported <- struct{}{}:
+		default:
+		}
+	})
+
+	// 立即报告一次,之后按间隔报告
+	for i := 0; i < 2; i++ {
+		select {
+		case <-reported:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no report")
+		}
+	}
+
+	stop()
+	stop()
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	n := calls
+	mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != n {
+		t.Errorf("%d reports after stop", calls-n)
+	}
+}
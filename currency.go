@@ -0,0 +1,344 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrBadExchangeRate = errors.New("bad exchange rate")
+)
+
+// Currency ISO 4217币种,txnAmt及settleAmt以该币种的最小货币单位表示
+type Currency struct {
+	Code       string // 数字代码 如156
+	Alpha      string // 字母代码 如CNY
+	MinorUnits int    // 小数位数 如人民币为2,日元为0
+}
+
+var CNY = Currency{Code: "156", Alpha: "CNY", MinorUnits: 2}
+
+// currencies ISO 4217 现行币种及小数位数,不含贵金属,基金等无小数位数定义的代码
+var currencies = []Currency{
+	{Code: "008", Alpha: "ALL", MinorUnits: 2},
+	{Code: "012", Alpha: "DZD", MinorUnits: 2},
+	{Code: "032", Alpha: "ARS", MinorUnits: 2},
+	{Code: "036", Alpha: "AUD", MinorUnits: 2},
+	{Code: "044", Alpha: "BSD", MinorUnits: 2},
+	{Code: "048", Alpha: "BHD", MinorUnits: 3},
+	{Code: "050", Alpha: "BDT", MinorUnits: 2},
+	{Code: "051", Alpha: "AMD", MinorUnits: 2},
+	{Code: "052", Alpha: "BBD", MinorUnits: 2},
+	{Code: "060", Alpha: "BMD", MinorUnits: 2},
+	{Code: "064", Alpha: "BTN", MinorUnits: 2},
+	{Code: "068", Alpha: "BOB", MinorUnits: 2},
+	{Code: "072", Alpha: "BWP", MinorUnits: 2},
+	{Code: "084", Alpha: "BZD", MinorUnits: 2},
+	{Code: "090", Alpha: "SBD", MinorUnits: 2},
+	{Code: "096", Alpha: "BND", MinorUnits: 2},
+	{Code: "104", Alpha: "MMK", MinorUnits: 2},
+	{Code: "108", Alpha: "BIF", MinorUnits: 0},
+	{Code: "116", Alpha: "KHR", MinorUnits: 2},
+	{Code: "124", Alpha: "CAD", MinorUnits: 2},
+	{Code: "132", Alpha: "CVE", MinorUnits: 2},
+	{Code: "136", Alpha: "KYD", MinorUnits: 2},
+	{Code: "144", Alpha: "LKR", MinorUnits: 2},
+	{Code: "152", Alpha: "CLP", MinorUnits: 0},
+	CNY,
+	{Code: "170", Alpha: "COP", MinorUnits: 2},
+	{Code: "174", Alpha: "KMF", MinorUnits: 0},
+	{Code: "188", Alpha: "CRC", MinorUnits: 2},
+	{Code: "191", Alpha: "HRK", MinorUnits: 2},
+	{Code: "192", Alpha: "CUP", MinorUnits: 2},
+	{Code: "203", Alpha: "CZK", MinorUnits: 2},
+	{Code: "208", Alpha: "DKK", MinorUnits: 2},
+	{Code: "214", Alpha: "DOP", MinorUnits: 2},
+	{Code: "222", Alpha: "SVC", MinorUnits: 2},
+	{Code: "230", Alpha: "ETB", MinorUnits: 2},
+	{Code: "232", Alpha: "ERN", MinorUnits: 2},
+	{Code: "238", Alpha: "FKP", MinorUnits: 2},
+	{Code: "242", Alpha: "FJD", MinorUnits: 2},
+	{Code: "262", Alpha: "DJF", MinorUnits: 0},
+	{Code: "270", Alpha: "GMD", MinorUnits: 2},
+	{Code: "292", Alpha: "GIP", MinorUnits: 2},
+	{Code: "320", Alpha: "GTQ", MinorUnits: 2},
+	{Code: "324", Alpha: "GNF", MinorUnits: 0},
+	{Code: "328", Alpha: "GYD", MinorUnits: 2},
+	{Code: "332", Alpha: "HTG", MinorUnits: 2},
+	{Code: "340", Alpha: "HNL", MinorUnits: 2},
+	{Code: "344", Alpha: "HKD", MinorUnits: 2},
+	{Code: "348", Alpha: "HUF", MinorUnits: 2},
+	{Code: "352", Alpha: "ISK", MinorUnits: 0},
+	{Code: "356", Alpha: "INR", MinorUnits: 2},
+	{Code: "360", Alpha: "IDR", MinorUnits: 2},
+	{Code: "364", Alpha: "IRR", MinorUnits: 2},
+	{Code: "368", Alpha: "IQD", MinorUnits: 3},
+	{Code: "376", Alpha: "ILS", MinorUnits: 2},
+	{Code: "388", Alpha: "JMD", MinorUnits: 2},
+	{Code: "392", Alpha: "JPY", MinorUnits: 0},
+	{Code: "398", Alpha: "KZT", MinorUnits: 2},
+	{Code: "400", Alpha: "JOD", MinorUnits: 3},
+	{Code: "404", Alpha: "KES", MinorUnits: 2},
+	{Code: "408", Alpha: "KPW", MinorUnits: 2},
+	{Code: "410", Alpha: "KRW", MinorUnits: 0},
+	{Code: "414", Alpha: "KWD", MinorUnits: 3},
+	{Code: "417", Alpha: "KGS", MinorUnits: 2},
+	{Code: "418", Alpha: "LAK", MinorUnits: 2},
+	{Code: "422", Alpha: "LBP", MinorUnits: 2},
+	{Code: "426", Alpha: "LSL", MinorUnits: 2},
+	{Code: "430", Alpha: "LRD", MinorUnits: 2},
+	{Code: "434", Alpha: "LYD", MinorUnits: 3},
+	{Code: "446", Alpha: "MOP", MinorUnits: 2},
+	{Code: "454", Alpha: "MWK", MinorUnits: 2},
+	{Code: "458", Alpha: "MYR", MinorUnits: 2},
+	{Code: "462", Alpha: "MVR", MinorUnits: 2},
+	{Code: "480", Alpha: "MUR", MinorUnits: 2},
+	{Code: "484", Alpha: "MXN", MinorUnits: 2},
+	{Code: "496", Alpha: "MNT", MinorUnits: 2},
+	{Code: "498", Alpha: "MDL", MinorUnits: 2},
+	{Code: "504", Alpha: "MAD", MinorUnits: 2},
+	{Code: "512", Alpha: "OMR", MinorUnits: 3},
+	{Code: "516", Alpha: "NAD", MinorUnits: 2},
+	{Code: "524", Alpha: "NPR", MinorUnits: 2},
+	{Code: "532", Alpha: "ANG", MinorUnits: 2},
+	{Code: "533", Alpha: "AWG", MinorUnits: 2},
+	{Code: "548", Alpha: "VUV", MinorUnits: 0},
+	{Code: "554", Alpha: "NZD", MinorUnits: 2},
+	{Code: "558", Alpha: "NIO", MinorUnits: 2},
+	{Code: "566", Alpha: "NGN", MinorUnits: 2},
+	{Code: "578", Alpha: "NOK", MinorUnits: 2},
+	{Code: "586", Alpha: "PKR", MinorUnits: 2},
+	{Code: "590", Alpha: "PAB", MinorUnits: 2},
+	{Code: "598", Alpha: "PGK", MinorUnits: 2},
+	{Code: "600", Alpha: "PYG", MinorUnits: 0},
+	{Code: "604", Alpha: "PEN", MinorUnits: 2},
+	{Code: "608", Alpha: "PHP", MinorUnits: 2},
+	{Code: "634", Alpha: "QAR", MinorUnits: 2},
+	{Code: "643", Alpha: "RUB", MinorUnits: 2},
+	{Code: "646", Alpha: "RWF", MinorUnits: 0},
+	{Code: "654", Alpha: "SHP", MinorUnits: 2},
+	{Code: "682", Alpha: "SAR", MinorUnits: 2},
+	{Code: "690", Alpha: "SCR", MinorUnits: 2},
+	{Code: "694", Alpha: "SLL", MinorUnits: 2},
+	{Code: "702", Alpha: "SGD", MinorUnits: 2},
+	{Code: "704", Alpha: "VND", MinorUnits: 0},
+	{Code: "706", Alpha: "SOS", MinorUnits: 2},
+	{Code: "710", Alpha: "ZAR", MinorUnits: 2},
+	{Code: "728", Alpha: "SSP", MinorUnits: 2},
+	{Code: "748", Alpha: "SZL", MinorUnits: 2},
+	{Code: "752", Alpha: "SEK", MinorUnits: 2},
+	{Code: "756", Alpha: "CHF", MinorUnits: 2},
+	{Code: "760", Alpha: "SYP", MinorUnits: 2},
+	{Code: "764", Alpha: "THB", MinorUnits: 2},
+	{Code: "776", Alpha: "TOP", MinorUnits: 2},
+	{Code: "780", Alpha: "TTD", MinorUnits: 2},
+	{Code: "784", Alpha: "AED", MinorUnits: 2},
+	{Code: "788", Alpha: "TND", MinorUnits: 3},
+	{Code: "800", Alpha: "UGX", MinorUnits: 0},
+	{Code: "807", Alpha: "MKD", MinorUnits: 2},
+	{Code: "818", Alpha: "EGP", MinorUnits: 2},
+	{Code: "826", Alpha: "GBP", MinorUnits: 2},
+	{Code: "834", Alpha: "TZS", MinorUnits: 2},
+	{Code: "840", Alpha: "USD", MinorUnits: 2},
+	{Code: "858", Alpha: "UYU", MinorUnits: 2},
+	{Code: "860", Alpha: "UZS", MinorUnits: 2},
+	{Code: "882", Alpha: "WST", MinorUnits: 2},
+	{Code: "886", Alpha: "YER", MinorUnits: 2},
+	{Code: "901", Alpha: "TWD", MinorUnits: 2},
+	{Code: "925", Alpha: "SLE", MinorUnits: 2},
+	{Code: "926", Alpha: "VED", MinorUnits: 2},
+	{Code: "927", Alpha: "UYW", MinorUnits: 4},
+	{Code: "928", Alpha: "VES", MinorUnits: 2},
+	{Code: "929", Alpha: "MRU", MinorUnits: 2},
+	{Code: "930", Alpha: "STN", MinorUnits: 2},
+	{Code: "931", Alpha: "CUC", MinorUnits: 2},
+	{Code: "932", Alpha: "ZWL", MinorUnits: 2},
+	{Code: "933", Alpha: "BYN", MinorUnits: 2},
+	{Code: "934", Alpha: "TMT", MinorUnits: 2},
+	{Code: "936", Alpha: "GHS", MinorUnits: 2},
+	{Code: "938", Alpha: "SDG", MinorUnits: 2},
+	{Code: "940", Alpha: "UYI", MinorUnits: 0},
+	{Code: "941", Alpha: "RSD", MinorUnits: 2},
+	{Code: "943", Alpha: "MZN", MinorUnits: 2},
+	{Code: "944", Alpha: "AZN", MinorUnits: 2},
+	{Code: "946", Alpha: "RON", MinorUnits: 2},
+	{Code: "947", Alpha: "CHE", MinorUnits: 2},
+	{Code: "948", Alpha: "CHW", MinorUnits: 2},
+	{Code: "949", Alpha: "TRY", MinorUnits: 2},
+	{Code: "950", Alpha: "XAF", MinorUnits: 0},
+	{Code: "951", Alpha: "XCD", MinorUnits: 2},
+	{Code: "952", Alpha: "XOF", MinorUnits: 0},
+	{Code: "953", Alpha: "XPF", MinorUnits: 0},
+	{Code: "967", Alpha: "ZMW", MinorUnits: 2},
+	{Code: "968", Alpha: "SRD", MinorUnits: 2},
+	{Code: "969", Alpha: "MGA", MinorUnits: 2},
+	{Code: "970", Alpha: "COU", MinorUnits: 2},
+	{Code: "971", Alpha: "AFN", MinorUnits: 2},
+	{Code: "972", Alpha: "TJS", MinorUnits: 2},
+	{Code: "973", Alpha: "AOA", MinorUnits: 2},
+	{Code: "975", Alpha: "BGN", MinorUnits: 2},
+	{Code: "976", Alpha: "CDF", MinorUnits: 2},
+	{Code: "977", Alpha: "BAM", MinorUnits: 2},
+	{Code: "978", Alpha: "EUR", MinorUnits: 2},
+	{Code: "979", Alpha: "MXV", MinorUnits: 2},
+	{Code: "980", Alpha: "UAH", MinorUnits: 2},
+	{Code: "981", Alpha: "GEL", MinorUnits: 2},
+	{Code: "984", Alpha: "BOV", MinorUnits: 2},
+	{Code: "985", Alpha: "PLN", MinorUnits: 2},
+	{Code: "986", Alpha: "BRL", MinorUnits: 2},
+	{Code: "990", Alpha: "CLF", MinorUnits: 4},
+	{Code: "997", Alpha: "USN", MinorUnits: 2},
+}
+
+// LookupCurrency 按数字代码或字母代码查找币种
+func LookupCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, c := range currencies {
+		if c.Code == code || c.Alpha == code {
+			return c, nil
+		}
+	}
+	return Currency{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, code)
+}
+
+// currencyOf 报文中的币种代码,表中没有的数字代码按2位小数处理,避免新增币种导致已验签的应答或通知无法解析
+func currencyOf(code string) (Currency, error) {
+	c, err := LookupCurrency(code)
+	if err == nil {
+		return c, nil
+	}
+	if len(code) != 3 || strings.Trim(code, "0123456789") != "" {
+		return Currency{}, err
+	}
+	return Currency{Code: code, Alpha: code, MinorUnits: 2}, nil
+}
+
+// Decimal 定点小数,值为 Unscaled / 10^Scale
+type Decimal struct {
+	Unscaled int64
+	Scale    int
+}
+
+func (d Decimal) Rat() *big.Rat {
+	den := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.Scale)), nil)
+	return new(big.Rat).SetFrac(big.NewInt(d.Unscaled), den)
+}
+
+func (d Decimal) String() string {
+	return d.Rat().FloatString(d.Scale)
+}
+
+// Minor 将最小货币单位的金额转换为该币种的小数金额,如 156 分 -> 1.56
+func (c Currency) Minor(amt int64) Decimal {
+	return Decimal{Unscaled: amt, Scale: c.MinorUnits}
+}
+
+// ParseExchangeRate 解析汇率,8位数字,首位表示小数位数,如 "61234567" 为 1.234567
+func ParseExchangeRate(s string) (d Decimal, err error) {
+	if len(s) != 8 {
+		err = ErrBadExchangeRate
+		return
+	}
+
+	d.Scale = int(s[0] - '0')
+	if d.Scale < 0 || d.Scale > 7 {
+		err = ErrBadExchangeRate
+		return
+	}
+
+	d.Unscaled, err = strconv.ParseInt(s[1:], 10, 64)
+	if err != nil {
+		err = ErrBadExchangeRate
+	}
+	return
+}
+
+// CrossBorderInfo 境外交易的交易金额,清算金额及汇率
+type CrossBorderInfo struct {
+	TxnAmt       Amount    // 交易金额 交易币种
+	SettleAmt    Amount    // 清算金额 清算币种
+	ExchangeRate Decimal   // 交易币种到清算币种的汇率,境内交易为零值
+	ExchangeDate time.Time // 兑换日期,境内交易为零值
+}
+
+func parseCrossBorder(txnAmt, settleAmt Amount, exchangeRate, exchangeDate, txnTime string) (info *CrossBorderInfo, err error) {
+	info = &CrossBorderInfo{TxnAmt: txnAmt, SettleAmt: settleAmt}
+	if info.TxnAmt.Currency.Code == "" {
+		info.TxnAmt.Currency = CNY
+	}
+
+	info.ExchangeRate, info.ExchangeDate, err = parseExchange(exchangeRate, exchangeDate, txnTime)
+	return
+}
+
+// parseExchange 解析汇率及兑换日期,兑换日期 MMDD 的年份取与订单发送时间最接近的年份
+func parseExchange(exchangeRate, exchangeDate, txnTime string) (rate Decimal, date time.Time, err error) {
+	if exchangeRate != "" {
+		if rate, err = ParseExchangeRate(exchangeRate); err != nil {
+			return
+		}
+	}
+	if exchangeDate == "" {
+		return
+	}
+
+	ref, err := ParseTxnTime(txnTime)
+	if err != nil {
+		err = fmt.Errorf("bad txnTime %q: %s", txnTime, err)
+		return
+	}
+	if len(exchangeDate) != 4 {
+		err = fmt.Errorf("bad exchangeDate: %q", exchangeDate)
+		return
+	}
+	date, err = parseYearless("0102", exchangeDate, ref)
+	return
+}
+
+// CrossBorder 解析通知中的汇率,交易金额及清算金额按各自币种的小数位数表示
+func (r *FrontConsumeNotifyResponse) CrossBorder() (*CrossBorderInfo, error) {
+	return parseCrossBorder(r.TxnAmt, r.SettleAmt, r.ExchangeRate, r.ExchangeDate, r.TxnTime)
+}
+
+// CrossBorder 解析查询结果中的汇率,交易金额及清算金额按各自币种的小数位数表示
+func (r *ConsumeQueryResponse) CrossBorder() (*CrossBorderInfo, error) {
+	return parseCrossBorder(r.TxnAmt, r.SettleAmt, r.ExchangeRate, r.ExchangeDate, r.TxnTime)
+}
+
+// Exchange 解析通知中的汇率及兑换日期,境内交易返回零值
+func (r *FrontConsumeNotifyResponse) Exchange() (rate Decimal, date time.Time, err error) {
+	return parseExchange(r.ExchangeRate, r.ExchangeDate, r.TxnTime)
+}
+
+// Exchange 解析查询结果中的汇率及兑换日期,境内交易返回零值
+func (r *ConsumeQueryResponse) Exchange() (rate Decimal, date time.Time, err error) {
+	return parseExchange(r.ExchangeRate, r.ExchangeDate, r.TxnTime)
+}
+
+// SetCurrency 设置交易币种,如境外商户使用USD,txnAmt以该币种最小货币单位上送
+func (up *UnionPay) SetCurrency(code string) *UnionPay {
+	c, err := LookupCurrency(code)
+	if err != nil {
+		log.Fatal(err)
+	}
+	up.currency = c
+	return up
+}
+
+// txnCurrency 商户设置的交易币种,未设置时为人民币
+func (up *UnionPay) txnCurrency() Currency {
+	if up.currency.Code == "" {
+		return CNY
+	}
+	return up.currency
+}
+
+func (up *UnionPay) currencyCode() string {
+	return up.txnCurrency().Code
+}
@@ -0,0 +1,153 @@
+package unionpay
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+	tests := []struct {
+		code       string
+		alpha      string
+		minorUnits int
+	}{
+		{"156", "CNY", 2},
+		{"usd", "USD", 2},
+		{" JPY ", "JPY", 0},
+		{"048", "BHD", 3},
+		{"368", "IQD", 3},
+		{"CLF", "CLF", 4},
+		{"986", "BRL", 2},
+		{"ISK", "ISK", 0},
+	}
+	for _, tt := range tests {
+		c, err := LookupCurrency(tt.code)
+		if err != nil {
+			t.Errorf("LookupCurrency(%q): %v", tt.code, err)
+			continue
+		}
+		if c.Alpha != tt.alpha || c.MinorUnits != tt.minorUnits {
+			t.Errorf("LookupCurrency(%q) = %+v, want %s with %d minor units", tt.code, c, tt.alpha, tt.minorUnits)
+		}
+	}
+
+	for _, code := range []string{"", "XAU", "999", "ABC"} {
+		if _, err := LookupCurrency(code); !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("LookupCurrency(%q) err = %v, want %v", code, err, ErrUnknownCurrency)
+		}
+	}
+}
+
+func TestCurrencyTableUnique(t *testing.T) {
+	codes, alphas := map[string]bool{}, map[string]bool{}
+	for _, c := range currencies {
+		if len(c.Code) != 3 || len(c.Alpha) != 3 {
+			t.Errorf("bad currency %+v", c)
+		}
+		if codes[c.Code] || alphas[c.Alpha] {
+			t.Errorf("duplicate currency %+v", c)
+		}
+		codes[c.Code], alphas[c.Alpha] = true, true
+	}
+}
+
+func TestParseTxnAmtUnknownCurrency(t *testing.T) {
+	amt, err := ParseTxnAmt("12345", "999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amt.Currency.Code != "999" || amt.Currency.MinorUnits != 2 || amt.Decimal().String() != "123.45" {
+		t.Errorf("got %+v %s, want 123.45 in 999 with 2 minor units", amt.Currency, amt.Decimal())
+	}
+
+	if _, err = ParseTxnAmt("1", "ZZZ"); err == nil {
+		t.Error("unknown alpha code accepted")
+	}
+}
+
+func TestParseExchangeRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"61234567", "1.234567", true},
+		{"00000001", "1", true},
+		{"71234567", "0.1234567", true},
+		{"81234567", "", false},
+		{"1234567", "", false},
+		{"6123456a", "", false},
+	}
+	for _, tt := range tests {
+		d, err := ParseExchangeRate(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseExchangeRate(%q) err = %v", tt.in, err)
+			continue
+		}
+		if tt.ok && d.String() != tt.want {
+			t.Errorf("ParseExchangeRate(%q) = %s, want %s", tt.in, d, tt.want)
+		}
+	}
+}
+
+func TestCrossBorder(t *testing.T) {
+	r, err := newFrontConsumeNotifyResponse(url.Values{
+		"txnAmt":             {"1000"},
+		"currencyCode":       {"392"},
+		"settleAmt":          {"6523"},
+		"settleCurrencyCode": {"156"},
+		"exchangeRate":       {"70652300"},
+		"exchangeDate":       {"0102"},
+		"txnTime":            {"20231231235000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := r.CrossBorder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.TxnAmt.String(); got != "1000 JPY" {
+		t.Errorf("TxnAmt = %s, want 1000 JPY", got)
+	}
+	if got := info.SettleAmt.String(); got != "65.23 CNY" {
+		t.Errorf("SettleAmt = %s, want 65.23 CNY", got)
+	}
+	if got := info.ExchangeRate.String(); got != "0.0652300" {
+		t.Errorf("ExchangeRate = %s, want 0.0652300", got)
+	}
+	if got := info.ExchangeDate.Format("2006-01-02"); got != "2024-01-02" {
+		t.Errorf("ExchangeDate = %s, want 2024-01-02", got)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		rate, date, txnTime string
+		wantRate, wantDate  string
+		ok                  bool
+	}{
+		{"61234567", "0615", "20240614220000", "1.234567", "2024-06-15", true},
+		{"61234567", "1231", "20240101001000", "1.234567", "2023-12-31", true},
+		{"61234567", "0229", "20240229100000", "1.234567", "2024-02-29", true},
+		{"", "", "20240102140000", "0", "0001-01-01", true},
+		{"61234567", "1332", "20240102140000", "", "", false},
+		{"61234567", "0102", "", "", "", false},
+	}
+	for _, tt := range tests {
+		r := &ConsumeQueryResponse{ExchangeRate: tt.rate, ExchangeDate: tt.date, TxnTime: tt.txnTime}
+		rate, date, err := r.Exchange()
+		if (err == nil) != tt.ok {
+			t.Errorf("Exchange(%q, %q) err = %v", tt.rate, tt.date, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if rate.String() != tt.wantRate || date.Format("2006-01-02") != tt.wantDate {
+			t.Errorf("Exchange(%q, %q) = %s %s, want %s %s", tt.rate, tt.date, rate, date.Format("2006-01-02"), tt.wantRate, tt.wantDate)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package unionpay
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidPin = errors.New("pin must be 4 to 12 digits")
+
+// CustomerInfo 银行卡验证信息及身份信息,上送时生成customerInfo域
+type CustomerInfo struct {
+	CertifTp   string // 证件类型 01:身份证
+	CertifID   string // 证件号码
+	CustomerNm string // 姓名
+	PhoneNo    string // 手机号 加密上送
+	SmsCode    string // 短信验证码
+	Pin        string // 持卡人密码 转换为PIN block后加密上送
+	Cvn2       string // 信用卡背面的CVN2三位数字 加密上送
+	Expired    string // 有效期 YYMM 加密上送
+}
+
+// customerInfo 生成customerInfo域
+// 手机号,CVN2,有效期拼接后使用加密证书加密放入encryptedInfo子域,密码单独加密放入pin子域
+// 整个组合域再做Base64编码
+func (up *UnionPay) customerInfo(cred *credentials, ci CustomerInfo, accNo string) (s string, err error) {
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "certifTp", V: ci.CertifTp})
+	kvs = append(kvs, KVpair{K: "certifId", V: ci.CertifID})
+	kvs = append(kvs, KVpair{K: "customerNm", V: ci.CustomerNm})
+	kvs = append(kvs, KVpair{K: "smsCode", V: ci.SmsCode})
+
+	if ci.Pin != "" {
+		var pin string
+		pin, err = up.encryptPin(cred, ci.Pin, accNo)
+		if err != nil {
+			return
+		}
+		kvs = append(kvs, KVpair{K: "pin", V: pin})
+	}
+
+	encKvs := KVpairs{}
+	encKvs = append(encKvs, KVpair{K: "phoneNo", V: ci.PhoneNo})
+	encKvs = append(encKvs, KVpair{K: "cvn2", V: ci.Cvn2})
+	encKvs = append(encKvs, KVpair{K: "expired", V: ci.Expired})
+	encKvs = encKvs.RemoveEmpty()
+	if len(encKvs) > 0 {
+		var encrypted string
+		encrypted, err = up.encryptData(cred, encKvs.Join("&"))
+		if err != nil {
+			return
+		}
+		kvs = append(kvs, KVpair{K: "encryptedInfo", V: encrypted})
+	}
+
+	s = base64.StdEncoding.EncodeToString([]byte(BuildComposite(kvs)))
+	return
+}
+
+// encryptPin 按ANSI X9.8格式生成带主账号的PIN block后加密
+func (up *UnionPay) encryptPin(cred *credentials, pin, accNo string) (string, error) {
+	block, err := pinBlock(pin, accNo)
+	if err != nil {
+		return "", err
+	}
+	return up.encryptData(cred, string(block))
+}
+
+func pinBlock(pin, accNo string) ([]byte, error) {
+	if len(pin) < 4 || len(pin) > 12 || strings.Trim(pin, "0123456789") != "" {
+		return nil, ErrInvalidPin
+	}
+
+	pinField, err := hex.DecodeString(fmt.Sprintf("%02d%s%s", len(pin), pin, strings.Repeat("F", 14-len(pin))))
+	if err != nil {
+		return nil, err
+	}
+
+	// 主账号去掉校验位后取右12位,不足左补0
+	pan := accNo
+	if len(pan) > 0 {
+		pan = pan[:len(pan)-1]
+	}
+	if len(pan) > 12 {
+		pan = pan[len(pan)-12:]
+	}
+	panField, err := hex.DecodeString("0000" + strings.Repeat("0", 12-len(pan)) + pan)
+	if err != nil {
+		return nil, err
+	}
+
+	block := make([]byte, 8)
+	for i := range block {
+		block[i] = pinField[i] ^ panField[i]
+	}
+	return block, nil
+}
@@ -0,0 +1,185 @@
+package unionpay
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldFormat 数据元格式
+type FieldFormat string
+
+const (
+	FormatN    FieldFormat = "N"              // 数字
+	FormatAN   FieldFormat = "AN"             // 字母和数字
+	FormatANS  FieldFormat = "ANS"            // 字母,数字和特殊字符
+	FormatTime FieldFormat = "YYYYMMDDHHmmss" // 北京时间
+)
+
+// FieldSpec 数据元定义
+type FieldSpec struct {
+	Name     string      // 域名
+	Format   FieldFormat // 格式
+	MinLen   int         // 最小长度
+	MaxLen   int         // 最大长度 0表示不限制
+	Values   []string    // 取值范围 为空表示不限制
+	Required bool        // 必送域 上送时不能为空
+}
+
+// dictionary 请求报文数据元字典,依据ACP 5.0.0规范
+// 不在字典中的域不做校验
+var dictionary = map[string]FieldSpec{
+	"version":         {Name: "版本号", Format: FormatANS, MinLen: 5, MaxLen: 5, Values: []string{"5.0.0", "5.1.0"}, Required: true},
+	"encoding":        {Name: "编码方式", Format: FormatANS, MinLen: 1, MaxLen: 20, Values: []string{"UTF-8", "GBK"}, Required: true},
+	"certId":          {Name: "证书ID", Format: FormatN, MinLen: 1, MaxLen: 128, Required: true},
+	"signMethod":      {Name: "签名方法", Format: FormatN, MinLen: 2, MaxLen: 2, Values: []string{"01", "11", "12"}, Required: true},
+	"txnType":         {Name: "交易类型", Format: FormatN, MinLen: 2, MaxLen: 2, Values: []string{"00", "01", "02", "03", "04", "05", "11", "12", "13", "14", "21", "22", "31", "32", "33", "71", "72", "73", "74", "75", "76", "77", "78", "79", "94", "99"}, Required: true},
+	"txnSubType":      {Name: "交易子类", Format: FormatN, MinLen: 2, MaxLen: 2, Required: true},
+	"bizType":         {Name: "产品类型", Format: FormatN, MinLen: 6, MaxLen: 6, Required: true},
+	"channelType":     {Name: "渠道类型", Format: FormatN, MinLen: 2, MaxLen: 2, Values: []string{"05", "07", "08"}, Required: true},
+	"accessType":      {Name: "接入类型", Format: FormatN, MinLen: 1, MaxLen: 1, Values: []string{AccessDirect, AccessAcquirer, AccessPlatform}, Required: true},
+	"merId":           {Name: "商户代码", Format: FormatAN, MinLen: 15, MaxLen: 15, Required: true},
+	"acqInsCode":      {Name: "收单机构代码", Format: FormatAN, MinLen: 8, MaxLen: 11},
+	"subMerId":        {Name: "二级商户代码", Format: FormatAN, MinLen: 5, MaxLen: 15},
+	"subMerName":      {Name: "二级商户全称", Format: FormatANS, MinLen: 1, MaxLen: 40},
+	"subMerAbbr":      {Name: "二级商户简称", Format: FormatANS, MinLen: 1, MaxLen: 16},
+	"orderId":         {Name: "商户订单号", Format: FormatAN, MinLen: 8, MaxLen: 32},
+	"txnTime":         {Name: "订单发送时间", Format: FormatTime, MinLen: 14, MaxLen: 14, Required: true},
+	"payTimeout":      {Name: "支付超时时间", Format: FormatTime, MinLen: 14, MaxLen: 14},
+	"txnAmt":          {Name: "交易金额", Format: FormatN, MinLen: 1, MaxLen: 12},
+	"currencyCode":    {Name: "交易币种", Format: FormatN, MinLen: 3, MaxLen: 3},
+	"frontUrl":        {Name: "前台通知地址", Format: FormatANS, MinLen: 1, MaxLen: 256},
+	"frontFailUrl":    {Name: "失败交易前台跳转地址", Format: FormatANS, MinLen: 1, MaxLen: 256},
+	"backUrl":         {Name: "后台通知地址", Format: FormatANS, MinLen: 1, MaxLen: 256},
+	"accType":         {Name: "账号类型", Format: FormatN, MinLen: 2, MaxLen: 2, Values: []string{"01", "02", "03"}},
+	"accNo":           {Name: "账号", Format: FormatANS, MinLen: 1, MaxLen: 1024},
+	"customerInfo":    {Name: "银行卡验证信息及身份信息", Format: FormatANS, MinLen: 1, MaxLen: 2048},
+	"encryptCertId":   {Name: "加密证书ID", Format: FormatN, MinLen: 1, MaxLen: 128},
+	"issInsCode":      {Name: "发卡机构代码", Format: FormatAN, MinLen: 1, MaxLen: 20},
+	"instalTransInfo": {Name: "分期付款信息域", Format: FormatANS, MinLen: 1, MaxLen: 1024},
+	"defaultPayType":  {Name: "默认支付方式", Format: FormatN, MinLen: 4, MaxLen: 4},
+	"customerIp":      {Name: "持卡人IP", Format: FormatANS, MinLen: 1, MaxLen: 40},
+	"orderDesc":       {Name: "订单描述", Format: FormatANS, MinLen: 1, MaxLen: 32},
+	"reqReserved":     {Name: "请求方保留域", Format: FormatANS, MinLen: 1, MaxLen: 1024},
+	"reserved":        {Name: "保留域", Format: FormatANS, MinLen: 1, MaxLen: 2048},
+	"riskRateInfo":    {Name: "风险信息域", Format: FormatANS, MinLen: 1, MaxLen: 2048},
+	"queryId":         {Name: "查询流水号", Format: FormatAN, MinLen: 21, MaxLen: 21},
+	"origQryId":       {Name: "原交易查询流水号", Format: FormatAN, MinLen: 21, MaxLen: 21},
+	"termId":          {Name: "终端号", Format: FormatAN, MinLen: 8, MaxLen: 8},
+	"qrNo":            {Name: "C2B码", Format: FormatAN, MinLen: 1, MaxLen: 20},
+	"batchNo":         {Name: "批次号", Format: FormatN, MinLen: 4, MaxLen: 4},
+	"totalQty":        {Name: "总笔数", Format: FormatN, MinLen: 1, MaxLen: 10},
+	"totalAmt":        {Name: "总金额", Format: FormatN, MinLen: 1, MaxLen: 15},
+	"bussCode":        {Name: "业务类型号", Format: FormatAN, MinLen: 1, MaxLen: 20},
+	"settleDate":      {Name: "清算日期", Format: FormatN, MinLen: 4, MaxLen: 4},
+	"fileType":        {Name: "文件类型", Format: FormatN, MinLen: 2, MaxLen: 2},
+	"accName":         {Name: "户名", Format: FormatANS, MinLen: 1, MaxLen: 60},
+}
+
+// FieldError 请求报文域校验错误
+// 域值可能是卡号,证件号等敏感信息,错误中不包含域值
+type FieldError struct {
+	Field  string // 域名 如orderId
+	Reason string // 原因
+}
+
+// LookupField 查找数据元定义,返回的定义为副本
+func LookupField(key string) (FieldSpec, bool) {
+	spec, ok := dictionary[key]
+	if ok {
+		spec.Values = append([]string(nil), spec.Values...)
+	}
+	return spec, ok
+}
+
+func (e *FieldError) Error() string {
+	name := e.Field
+	if spec, ok := dictionary[e.Field]; ok {
+		name = fmt.Sprintf("%s(%s)", e.Field, spec.Name)
+	}
+	return fmt.Sprintf("invalid field %s: %s", name, e.Reason)
+}
+
+// ValidateField 按数据元字典校验单个域,必送域不能为空,其余空值及字典中不存在的域不做校验
+func ValidateField(key, value string) error {
+	spec, ok := dictionary[key]
+	if !ok {
+		return nil
+	}
+
+	fieldErr := func(format string, a ...interface{}) error {
+		return &FieldError{Field: key, Reason: fmt.Sprintf(format, a...)}
+	}
+
+	if value == "" {
+		if spec.Required {
+			return fieldErr("required")
+		}
+		return nil
+	}
+
+	// ANS域可能包含中文,按字符计算长度
+	n := utf8.RuneCountInString(value)
+	if n < spec.MinLen || (spec.MaxLen > 0 && n > spec.MaxLen) {
+		if spec.MinLen == spec.MaxLen {
+			return fieldErr("length %d, want %d", n, spec.MinLen)
+		}
+		return fieldErr("length %d, want %d..%d", n, spec.MinLen, spec.MaxLen)
+	}
+
+	switch spec.Format {
+	case FormatN:
+		if strings.Trim(value, "0123456789") != "" {
+			return fieldErr("must be numeric (N)")
+		}
+	case FormatAN:
+		for _, r := range value {
+			if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return fieldErr("must be letters and digits (AN)")
+			}
+		}
+	case FormatANS:
+		for _, r := range value {
+			if unicode.IsControl(r) {
+				return fieldErr("contains control character %U", r)
+			}
+		}
+	case FormatTime:
+		if _, err := time.ParseInLocation("20060102150405", value, Beijing); err != nil {
+			return fieldErr("must be %s", FormatTime)
+		}
+	}
+
+	if len(spec.Values) > 0 {
+		for _, v := range spec.Values {
+			if strings.EqualFold(v, value) {
+				return nil
+			}
+		}
+		return fieldErr("not in %s", strings.Join(spec.Values, ","))
+	}
+	return nil
+}
+
+// validateFileField 校验写入以|分隔、\r\n换行的批量文件的域,除字典校验外不能包含分隔符|
+func validateFileField(key, value string) error {
+	if err := ValidateField(key, value); err != nil {
+		return err
+	}
+	if strings.Contains(value, "|") {
+		return &FieldError{Field: key, Reason: "contains separator |"}
+	}
+	return nil
+}
+
+// ValidateKVpairs 按数据元字典校验请求报文的全部域
+func ValidateKVpairs(kvs KVpairs) error {
+	for _, kv := range kvs {
+		if err := ValidateField(kv.K, kv.V); err != nil {
+			return err
+		}
+	}
+	return nil
+}
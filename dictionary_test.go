@@ -0,0 +1,90 @@
+package unionpay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateField(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{"orderId", "ORDER0001", true},
+		{"orderId", "ORDER01", false},
+		{"orderId", "ORDER_0001", false},
+		{"orderId", "", true},
+		{"txnTime", "20240102150405", true},
+		{"txnTime", "20241302150405", false},
+		{"txnTime", "", false},
+		{"merId", "", false},
+		{"version", "5.1.0", true},
+		{"version", "5.2.0", false},
+		{"txnAmt", "12a", false},
+		{"orderDesc", "测试订单", true},
+		{"orderDesc", "line\nbreak", false},
+		{"signMethod", "01", true},
+		{"unknownField", "", true},
+		{"unknownField", "anything\x00", true},
+	}
+	for _, tt := range tests {
+		err := ValidateField(tt.key, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateField(%s, %q) = %v, want ok=%v", tt.key, tt.value, err, tt.ok)
+		}
+		if err != nil {
+			if fe, ok := err.(*FieldError); !ok || fe.Field != tt.key {
+				t.Errorf("ValidateField(%s, %q) error %T %v is not a FieldError for the field", tt.key, tt.value, err, err)
+			}
+		}
+	}
+}
+
+func TestFieldErrorOmitsValue(t *testing.T) {
+	for _, c := range []struct{ key, value string }{
+		{"accNo", "6216261000000000018\x00"},
+		{"txnAmt", "6216261000000000018a"},
+		{"orderId", "6216261000000000018-01"},
+		{"version", "6216261000000000018"},
+		{"accName", "张三|6216261000000000018"},
+	} {
+		err := validateFileField(c.key, c.value)
+		if err == nil {
+			t.Errorf("%s: want error", c.key)
+			continue
+		}
+		if strings.Contains(err.Error(), "6216261000000000018") {
+			t.Errorf("%s: error %q contains the value", c.key, err)
+		}
+	}
+}
+
+func TestValidateKVpairsRequired(t *testing.T) {
+	kvs := KVpairs{
+		{K: "version", V: "5.1.0"},
+		{K: "txnType", V: ""},
+		{K: "reserved", V: ""},
+	}
+	err := ValidateKVpairs(kvs)
+	if fe, ok := err.(*FieldError); !ok || fe.Field != "txnType" {
+		t.Errorf("err = %v, want required txnType", err)
+	}
+}
+
+func TestLookupFieldCopy(t *testing.T) {
+	spec, ok := LookupField("version")
+	if !ok || !spec.Required || len(spec.Values) == 0 {
+		t.Fatalf("LookupField(version) = %+v, %v", spec, ok)
+	}
+	spec.Values[0] = "9.9.9"
+	spec.MaxLen = 100
+
+	if err := ValidateField("version", "9.9.9"); err == nil {
+		t.Error("modifying the returned spec changed the dictionary")
+	}
+
+	if _, ok = LookupField("unknownField"); ok {
+		t.Error("unknown field found")
+	}
+}
@@ -0,0 +1,102 @@
+package unionpay
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEncryptCertNotSet = errors.New("encrypt cert is not set")
+	ErrPrivateKeyNotSet  = errors.New("private key is not set")
+	ErrNotRSAEncryptCert = errors.New("encrypt cert is not an RSA cert")
+)
+
+// DataEncrypter 敏感信息加密
+type DataEncrypter interface {
+	// Encrypt 加密并编码为上送的密文
+	Encrypt(data []byte) (string, error)
+	// CertID 上送encryptCertId
+	CertID() string
+}
+
+// RSAEncrypter 使用银联加密证书公钥加密,密文做Base64编码
+type RSAEncrypter struct {
+	cert *x509.Certificate
+	pub  *rsa.PublicKey
+}
+
+// NewRSAEncrypter 证书公钥不是RSA公钥时返回错误
+func NewRSAEncrypter(cert *x509.Certificate) (*RSAEncrypter, error) {
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotRSAEncryptCert, cert.PublicKey)
+	}
+	return &RSAEncrypter{cert: cert, pub: pub}, nil
+}
+
+func (e *RSAEncrypter) Encrypt(data []byte) (string, error) {
+	b, err := rsa.EncryptPKCS1v15(rand.Reader, e.pub, data)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (e *RSAEncrypter) CertID() string {
+	return e.cert.SerialNumber.String()
+}
+
+// Cert 加密证书
+func (e *RSAEncrypter) Cert() *x509.Certificate {
+	return e.cert
+}
+
+// SetEncrypter 设置敏感信息加密方式
+func (up *UnionPay) SetEncrypter(e DataEncrypter) *UnionPay {
+	up.cred.update(func(c *credentials) {
+		c.encrypter = e
+	})
+	return up
+}
+
+// encryptData 加密敏感信息(卡号,密码,手机号等)
+// 使用调用方取得的cred,保证同一笔交易的密文与encryptCertId来自同一份证书
+func (up *UnionPay) encryptData(cred *credentials, data string) (string, error) {
+	e := cred.encrypter
+	if e == nil {
+		return "", ErrEncryptCertNotSet
+	}
+	return e.Encrypt([]byte(data))
+}
+
+// encryptCertID 加密证书的证书id,上送加密信息时需同时上送encryptCertId
+func (up *UnionPay) encryptCertID(cred *credentials) string {
+	e := cred.encrypter
+	if e == nil {
+		return ""
+	}
+	return e.CertID()
+}
+
+// DecryptData 使用签名私钥解密银联返回的加密信息,如应答中的accNo
+func (up *UnionPay) DecryptData(data string) (string, error) {
+	priKey := up.creds().privateKey
+	if priKey == nil {
+		return "", ErrPrivateKeyNotSet
+	}
+
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+
+	b, err = rsa.DecryptPKCS1v15(rand.Reader, priKey, b)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
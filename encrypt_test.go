@@ -0,0 +1,121 @@
+package unionpay
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// swappingEncrypter 加密时替换商户的加密方式,模拟交易进行中重新加载证书
+type swappingEncrypter struct {
+	certID string
+	up     *UnionPay
+	next   DataEncrypter
+}
+
+func (e *swappingEncrypter) Encrypt(data []byte) (string, error) {
+	if e.next != nil {
+		e.up.SetEncrypter(e.next)
+	}
+	return e.certID + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (e *swappingEncrypter) CertID() string {
+	return e.certID
+}
+
+func TestEncryptUsesTransactionCredentials(t *testing.T) {
+	up := newTestPayment(t)
+	next := &swappingEncrypter{certID: "2"}
+	up.SetEncrypter(&swappingEncrypter{certID: "1", up: up, next: next})
+
+	var form url.Values
+	fakeGateway(up, func(f url.Values) map[string]string {
+		form = f
+		return respFields(f, "00")
+	})
+
+	ci := CustomerInfo{CustomerNm: "全渠道", PhoneNo: "13552535506", SmsCode: "111111"}
+	if _, err := up.AuthenticateCard("AUTH20240102001", "6216261000000000018", ci); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := form.Get("encryptCertId"); got != "1" {
+		t.Errorf("encryptCertId = %s, want 1", got)
+	}
+	if accNo := form.Get("accNo"); !strings.HasPrefix(accNo, "1:") {
+		t.Errorf("accNo encrypted as %s", accNo)
+	}
+	b, _ := base64.StdEncoding.DecodeString(form.Get("customerInfo"))
+	if !strings.Contains(string(b), "encryptedInfo=1:") {
+		t.Errorf("customerInfo = %s", b)
+	}
+
+	// 下一笔交易使用新的加密证书
+	if _, err := up.AuthenticateCard("AUTH20240102002", "6216261000000000018", ci); err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Get("encryptCertId"); got != "2" {
+		t.Errorf("next encryptCertId = %s, want 2", got)
+	}
+}
+
+func TestEncryptCertNotSet(t *testing.T) {
+	up, err := newPayment("700000000000001", "key.cert", "key.pem", "key.cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = up.encryptData(up.creds(), "6216261000000000018"); err != ErrEncryptCertNotSet {
+		t.Errorf("err = %v, want %v", err, ErrEncryptCertNotSet)
+	}
+	if id := up.encryptCertID(up.creds()); id != "" {
+		t.Errorf("encryptCertId = %q without encrypter", id)
+	}
+}
+
+func TestNewRSAEncrypterKeyType(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(20240102),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewRSAEncrypter(cert); !errors.Is(err, ErrNotRSAEncryptCert) {
+		t.Errorf("ECDSA cert err = %v, want %v", err, ErrNotRSAEncryptCert)
+	}
+
+	path := filepath.Join(t.TempDir(), "enc.cert")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	up := newTestPayment(t)
+	if err = up.setEncryptCert(path); !errors.Is(err, ErrNotRSAEncryptCert) {
+		t.Errorf("setEncryptCert err = %v, want %v", err, ErrNotRSAEncryptCert)
+	}
+	if id := up.encryptCertID(up.creds()); id == "20240102" {
+		t.Error("encrypter replaced by a failed setEncryptCert")
+	}
+}
@@ -90,9 +90,9 @@ func IndexServer(w http.ResponseWriter, req *http.Request) {
 
 func PaymentWebServer(w http.ResponseWriter, req *http.Request) {
 	var (
-		orderID           = time.Now().Format("20060102150405999")
-		amount      int64 = 1
-		extraParams       = map[string]string{
+		orderID     = time.Now().Format("20060102150405999")
+		amount      = unionpay.Fen(1)
+		extraParams = map[string]string{
 			"orderDesc": "test body",
 		}
 	)
@@ -109,9 +109,9 @@ func PaymentWebServer(w http.ResponseWriter, req *http.Request) {
 
 func PaymentAPPServer(w http.ResponseWriter, req *http.Request) {
 	var (
-		orderID           = time.Now().Format("20060102150405999")
-		amount      int64 = 1
-		extraParams       = map[string]string{
+		orderID     = time.Now().Format("20060102150405999")
+		amount      = unionpay.Fen(1)
+		extraParams = map[string]string{
 			"orderDesc": "test body",
 		}
 	)
@@ -137,12 +137,12 @@ func ReturnWebServer(w http.ResponseWriter, req *http.Request) {
 	var html = fmt.Sprintf(`
 Result:%+v<br>
 <a href="/unionpay/consume-query?order_id=%s&query_id=%s&txn_time=%s">查询订单</a><br>
-<a href="/unionpay/consume-undo?query_id=%s&amount=%s">订单取消</a><br>
-<a href="/unionpay/consume-refund?query_id=%s&amount=%s">订单退款</a><br>
+<a href="/unionpay/consume-undo?query_id=%s&amount=%d">订单取消</a><br>
+<a href="/unionpay/consume-refund?query_id=%s&amount=%d">订单退款</a><br>
 `, r,
 		r.OrderID, r.QueryID, r.TxnTime,
-		r.QueryID, r.TxnAmt,
-		r.QueryID, r.TxnAmt)
+		r.QueryID, r.TxnAmt.Value,
+		r.QueryID, r.TxnAmt.Value)
 	fmt.Fprintf(w, html)
 	return
 }
@@ -174,7 +174,7 @@ func RefundServer(w http.ResponseWriter, req *http.Request) {
 		reserved      = req.URL.Query().Get("reserved")
 	)
 
-	refundResp, err := up.ConsumeRefund(orderID, returnURL, amount, originQueryID, reqReserved, reserved)
+	refundResp, err := up.ConsumeRefund(orderID, returnURL, unionpay.Fen(amount), originQueryID, reqReserved, reserved)
 	if err != nil {
 		fmt.Fprintf(w, "Error:%s", err.Error())
 		return
@@ -193,7 +193,7 @@ func UndoServer(w http.ResponseWriter, req *http.Request) {
 		reserved      = req.URL.Query().Get("reserved")
 	)
 
-	refundResp, err := up.ConsumeUndo(orderID, returnURL, amount, originQueryID, reqReserved, reserved)
+	refundResp, err := up.ConsumeUndo(orderID, returnURL, unionpay.Fen(amount), originQueryID, reqReserved, reserved)
 	if err != nil {
 		fmt.Fprintf(w, "Error:%s", err.Error())
 		return
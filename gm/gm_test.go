@@ -0,0 +1,211 @@
+package gm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("bad hex integer %s", s)
+	}
+	return v
+}
+
+// GB/T 32905-2016 附录A
+func TestSM3Vectors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"abc", "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"},
+		{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd", "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"},
+	}
+	for _, tt := range tests {
+		sum := SM3([]byte(tt.in))
+		if got := hex.EncodeToString(sum[:]); got != tt.want {
+			t.Errorf("SM3(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+
+		// 分段写入结果一致
+		h := NewSM3()
+		for i := 0; i < len(tt.in); i += 7 {
+			end := i + 7
+			if end > len(tt.in) {
+				end = len(tt.in)
+			}
+			h.Write([]byte(tt.in[i:end]))
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+			t.Errorf("NewSM3 streaming %q = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// GB/T 32907-2016 附录A
+func TestSM4Vectors(t *testing.T) {
+	key := mustHex(t, "0123456789abcdeffedcba9876543210")
+	block, err := NewSM4(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := make([]byte, SM4BlockSize)
+	block.Encrypt(dst, key)
+	if want := mustHex(t, "681edf34d206965e86b3e94f536e4246"); !bytes.Equal(dst, want) {
+		t.Errorf("SM4 encrypt = %x, want %x", dst, want)
+	}
+
+	block.Decrypt(dst, dst)
+	if !bytes.Equal(dst, key) {
+		t.Errorf("SM4 decrypt = %x, want %x", dst, key)
+	}
+
+	if testing.Short() {
+		return
+	}
+	copy(dst, key)
+	for i := 0; i < 1000000; i++ {
+		block.Encrypt(dst, dst)
+	}
+	if want := mustHex(t, "595298c7c6fd271f0402f804c33d3f66"); !bytes.Equal(dst, want) {
+		t.Errorf("SM4 encrypt 1000000 times = %x, want %x", dst, want)
+	}
+}
+
+func TestSM4KeySize(t *testing.T) {
+	if _, err := NewSM4(make([]byte, 15)); err != KeySizeError(15) {
+		t.Errorf("err = %v, want %v", err, KeySizeError(15))
+	}
+}
+
+// sm2Vector GM/T 0003.5-2012 sm2p256v1曲线签名示例
+var sm2Vector = struct {
+	d, x, y, k, r, s string
+	uid, msg         string
+}{
+	d:   "3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8",
+	x:   "09F9DF311E5421A150DD7D161E4BC5C672179FAD1833FC076BB08FF356F35020",
+	y:   "CCEA490CE26775A52DC6EA718CC1AA600AED05FBF35E084A6632F6072DA9AD13",
+	k:   "59276E27D506861A16680F3AD9C02DCCEF3CC1FA3CDBE4CE6D54B80DEAC1BC21",
+	r:   "F5A03B0648D2C4630EEAC513E1BB81A15944DA3827D5B74143AC7EACEEE720B3",
+	s:   "B1B6AA29DF212FD8763182BC0D421CA1BB9038FD1F7F42D4840B69C485BBC1AA",
+	uid: "1234567812345678",
+	msg: "message digest",
+}
+
+func sm2VectorKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	priv, err := NewSM2PrivateKey(mustInt(t, sm2Vector.d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestSM2VectorKey(t *testing.T) {
+	priv := sm2VectorKey(t)
+	if priv.X.Cmp(mustInt(t, sm2Vector.x)) != 0 || priv.Y.Cmp(mustInt(t, sm2Vector.y)) != 0 {
+		t.Errorf("public key = (%X, %X), want (%s, %s)", priv.X, priv.Y, sm2Vector.x, sm2Vector.y)
+	}
+}
+
+// nonceReader 使签名使用的随机数k为给定值
+type nonceReader struct {
+	k *big.Int
+}
+
+func (r nonceReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	// 随机数按 b mod (n-1) + 1 取值
+	new(big.Int).Sub(r.k, big.NewInt(1)).FillBytes(p)
+	return len(p), nil
+}
+
+func TestSM2SignVector(t *testing.T) {
+	priv := sm2VectorKey(t)
+	sig, err := SignSM2(nonceReader{mustInt(t, sm2Vector.k)}, priv, []byte(sm2Vector.uid), []byte(sm2Vector.msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := marshalSM2Signature(mustInt(t, sm2Vector.r), mustInt(t, sm2Vector.s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, want) {
+		t.Errorf("signature = %x, want %x", sig, want)
+	}
+}
+
+func TestSM2VerifyVector(t *testing.T) {
+	priv := sm2VectorKey(t)
+	sig := append(mustHex(t, sm2Vector.r), mustHex(t, sm2Vector.s)...)
+
+	if err := VerifySM2(&priv.PublicKey, []byte(sm2Vector.uid), []byte(sm2Vector.msg), sig); err != nil {
+		t.Errorf("r||s signature: %v", err)
+	}
+	if err := VerifySM2(&priv.PublicKey, []byte(sm2Vector.uid), []byte("message digesT"), sig); err != ErrInvalidSignature {
+		t.Errorf("tampered message err = %v, want %v", err, ErrInvalidSignature)
+	}
+	if err := VerifySM2(&priv.PublicKey, []byte("8765432187654321"), []byte(sm2Vector.msg), sig); err != ErrInvalidSignature {
+		t.Errorf("other uid err = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestSM2SignerRoundTrip(t *testing.T) {
+	priv, err := GenerateSM2Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SM2Signer{Key: priv}
+
+	msg := []byte("merId=700000000000001&orderId=ORDER0001")
+	sig, err := s.Sign(rand.Reader, msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := s.Public().(*ecdsa.PublicKey)
+	if err = VerifySM2(pub, nil, msg, sig); err != nil {
+		t.Error(err)
+	}
+
+	other, _ := GenerateSM2Key(rand.Reader)
+	if err = VerifySM2(&other.PublicKey, nil, msg, sig); err != ErrInvalidSignature {
+		t.Errorf("other key err = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestSM2RejectsOtherCurve(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsSM2(&p256.PublicKey) {
+		t.Error("P-256 key recognised as SM2")
+	}
+	if _, err = SignSM2(rand.Reader, p256, nil, []byte("msg")); err != ErrNotSM2Key {
+		t.Errorf("sign err = %v, want %v", err, ErrNotSM2Key)
+	}
+}
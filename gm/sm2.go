@@ -0,0 +1,128 @@
+package gm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// DefaultUID SM2签名默认用户标识
+var DefaultUID = []byte("1234567812345678")
+
+var (
+	ErrInvalidSignature = errors.New("gm: invalid SM2 signature")
+	ErrNotSM2Key        = errors.New("gm: not an SM2 key")
+)
+
+// SM2Curve SM2推荐曲线 sm2p256v1,点乘为常数时间实现
+func SM2Curve() elliptic.Curve {
+	return sm2.P256Sm2()
+}
+
+// IsSM2 公钥是否为SM2曲线上的点
+func IsSM2(pub *ecdsa.PublicKey) bool {
+	return pub != nil && pub.Curve != nil && pub.Curve.Params().Name == SM2Curve().Params().Name
+}
+
+// NewSM2PrivateKey 由私钥整数d创建SM2私钥
+func NewSM2PrivateKey(d *big.Int) (*ecdsa.PrivateKey, error) {
+	c := SM2Curve()
+	n := c.Params().N
+	if d.Sign() <= 0 || d.Cmp(new(big.Int).Sub(n, big.NewInt(1))) >= 0 {
+		return nil, errors.New("gm: SM2 private key out of range")
+	}
+
+	priv := &ecdsa.PrivateKey{D: new(big.Int).Set(d)}
+	priv.Curve = c
+	priv.X, priv.Y = c.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return priv, nil
+}
+
+// GenerateSM2Key 生成SM2密钥对
+func GenerateSM2Key(r io.Reader) (*ecdsa.PrivateKey, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	k, err := sm2.GenerateKey(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewSM2PrivateKey(k.D)
+}
+
+func toSM2Public(pub *ecdsa.PublicKey) *sm2.PublicKey {
+	return &sm2.PublicKey{Curve: sm2.P256Sm2(), X: pub.X, Y: pub.Y}
+}
+
+type sm2Signature struct {
+	R, S *big.Int
+}
+
+func marshalSM2Signature(r, s *big.Int) ([]byte, error) {
+	return asn1.Marshal(sm2Signature{R: r, S: s})
+}
+
+// SignSM2 使用SM2私钥对msg签名,uid为空时使用DefaultUID,返回DER编码的签名
+// 签名由github.com/tjfoc/gmsm/sm2计算
+func SignSM2(r io.Reader, priv *ecdsa.PrivateKey, uid, msg []byte) ([]byte, error) {
+	if !IsSM2(&priv.PublicKey) {
+		return nil, ErrNotSM2Key
+	}
+	if len(uid) == 0 {
+		uid = DefaultUID
+	}
+	if r == nil {
+		r = rand.Reader
+	}
+
+	key := &sm2.PrivateKey{PublicKey: *toSM2Public(&priv.PublicKey), D: priv.D}
+	rr, s, err := sm2.Sm2Sign(key, msg, uid, r)
+	if err != nil {
+		return nil, err
+	}
+	return marshalSM2Signature(rr, s)
+}
+
+// VerifySM2 验证SM2签名,sig可以为DER编码或64字节的 r||s
+func VerifySM2(pub *ecdsa.PublicKey, uid, msg, sig []byte) error {
+	if !IsSM2(pub) {
+		return ErrNotSM2Key
+	}
+	if len(uid) == 0 {
+		uid = DefaultUID
+	}
+
+	var rs sm2Signature
+	if len(sig) == 64 {
+		rs.R = new(big.Int).SetBytes(sig[:32])
+		rs.S = new(big.Int).SetBytes(sig[32:])
+	} else if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) > 0 {
+		return ErrInvalidSignature
+	}
+
+	if !sm2.Sm2Verify(toSM2Public(pub), msg, uid, rs.R, rs.S) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SM2Signer 实现crypto.Signer,Sign的digest参数为待签名原文,签名时按SM2规范计算杂凑
+type SM2Signer struct {
+	Key *ecdsa.PrivateKey
+	UID []byte // 为空时使用DefaultUID
+}
+
+func (s *SM2Signer) Public() crypto.PublicKey {
+	return &s.Key.PublicKey
+}
+
+func (s *SM2Signer) Sign(r io.Reader, msg []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return SignSM2(r, s.Key, s.UID, msg)
+}
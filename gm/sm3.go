@@ -0,0 +1,27 @@
+// Package gm 国密算法 SM2签名,SM3杂凑,SM4分组密码,用于银联全渠道5.1.0国密报文
+// 算法实现使用github.com/tjfoc/gmsm,本包只做密钥格式转换及银联报文需要的封装
+package gm
+
+import (
+	"hash"
+
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+// SM3Size SM3杂凑值长度
+const SM3Size = 32
+
+// SM3BlockSize SM3分组长度
+const SM3BlockSize = 64
+
+// NewSM3 返回SM3杂凑
+func NewSM3() hash.Hash {
+	return sm3.New()
+}
+
+// SM3 计算data的SM3杂凑值
+func SM3(data []byte) [SM3Size]byte {
+	var sum [SM3Size]byte
+	copy(sum[:], sm3.Sm3Sum(data))
+	return sum
+}
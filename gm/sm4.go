@@ -0,0 +1,25 @@
+package gm
+
+import (
+	"crypto/cipher"
+	"strconv"
+
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// SM4BlockSize SM4分组长度
+const SM4BlockSize = 16
+
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "gm: invalid SM4 key size " + strconv.Itoa(int(k))
+}
+
+// NewSM4 返回SM4分组密码,key长度为16字节
+func NewSM4(key []byte) (cipher.Block, error) {
+	if len(key) != 16 {
+		return nil, KeySizeError(len(key))
+	}
+	return sm4.NewCipher(key)
+}
@@ -0,0 +1,104 @@
+package gm
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+var (
+	oidPublicKeyEC = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSM2         = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+)
+
+// Certificate SM2证书,标准库crypto/x509无法解析SM2曲线的公钥
+type Certificate struct {
+	Raw          []byte
+	SerialNumber *big.Int
+	Issuer       pkix.Name
+	Subject      pkix.Name
+	NotBefore    time.Time
+	NotAfter     time.Time
+	PublicKey    *ecdsa.PublicKey
+}
+
+// ParseCertificate 解析DER编码的SM2证书,公钥算法须为id-ecPublicKey且曲线为sm2p256v1
+// 证书由github.com/tjfoc/gmsm/x509解析
+func ParseCertificate(der []byte) (*Certificate, error) {
+	c, err := smx509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("gm: bad certificate: %s", err)
+	}
+
+	pub, ok := c.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !IsSM2(pub) {
+		return nil, ErrNotSM2Key
+	}
+
+	return &Certificate{
+		Raw:          c.Raw,
+		SerialNumber: c.SerialNumber,
+		Issuer:       c.Issuer,
+		Subject:      c.Subject,
+		NotBefore:    c.NotBefore,
+		NotAfter:     c.NotAfter,
+		PublicKey:    pub,
+	}, nil
+}
+
+// checkSM2Algorithm 公钥算法为id-ecPublicKey且曲线为sm2p256v1,部分CA直接使用SM2算法标识
+func checkSM2Algorithm(alg pkix.AlgorithmIdentifier) error {
+	if alg.Algorithm.Equal(oidSM2) {
+		return nil
+	}
+	if !alg.Algorithm.Equal(oidPublicKeyEC) {
+		return ErrNotSM2Key
+	}
+
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidSM2) {
+		return ErrNotSM2Key
+	}
+	return nil
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// ParsePrivateKey 解析DER编码的SM2私钥,支持PKCS#8及SEC1格式
+func ParsePrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	var p8 pkcs8
+	if _, err := asn1.Unmarshal(der, &p8); err == nil && len(p8.Algo.Algorithm) > 0 {
+		if err = checkSM2Algorithm(p8.Algo); err != nil {
+			return nil, err
+		}
+		der = p8.PrivateKey
+	}
+
+	var k ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &k); err != nil {
+		return nil, fmt.Errorf("gm: bad SM2 private key: %s", err)
+	}
+	if k.Version != 1 {
+		return nil, fmt.Errorf("gm: unknown EC private key version %d", k.Version)
+	}
+	if len(k.NamedCurveOID) > 0 && !k.NamedCurveOID.Equal(oidSM2) {
+		return nil, ErrNotSM2Key
+	}
+	return NewSM2PrivateKey(new(big.Int).SetBytes(k.PrivateKey))
+}
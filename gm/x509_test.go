@@ -0,0 +1,77 @@
+package gm
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+func TestParseCertificate(t *testing.T) {
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &smx509.Certificate{
+		SerialNumber: big.NewInt(69026124),
+		Subject:      pkix.Name{CommonName: "test sm2 sign cert"},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := smx509.CreateCertificate(tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.String() != "69026124" || cert.Subject.CommonName != "test sm2 sign cert" || !cert.NotAfter.Equal(tmpl.NotAfter) {
+		t.Errorf("got serial %s subject %s notAfter %s", cert.SerialNumber, cert.Subject, cert.NotAfter)
+	}
+	if cert.PublicKey.X.Cmp(key.X) != 0 || cert.PublicKey.Y.Cmp(key.Y) != 0 || !IsSM2(cert.PublicKey) {
+		t.Error("public key differs from the certified key")
+	}
+
+	if _, err = ParseCertificate(der[:len(der)-1]); err == nil {
+		t.Error("truncated certificate accepted")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	want := sm2VectorKey(t)
+	sec1, err := asn1.Marshal(ecPrivateKey{Version: 1, PrivateKey: want.D.FillBytes(make([]byte, 32)), NamedCurveOID: oidSM2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve, _ := asn1.Marshal(oidSM2)
+	p8, err := asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyEC, Parameters: asn1.RawValue{FullBytes: curve}},
+		PrivateKey: sec1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, der := range map[string][]byte{"SEC1": sec1, "PKCS#8": p8} {
+		priv, err := ParsePrivateKey(der)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if priv.D.Cmp(want.D) != 0 || priv.X.Cmp(want.X) != 0 {
+			t.Errorf("%s: parsed key differs", name)
+		}
+	}
+
+	p256, _ := asn1.Marshal(ecPrivateKey{Version: 1, PrivateKey: want.D.Bytes(), NamedCurveOID: asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}})
+	if _, err = ParsePrivateKey(p256); err != ErrNotSM2Key {
+		t.Errorf("P-256 key err = %v, want %v", err, ErrNotSM2Key)
+	}
+}
@@ -0,0 +1,143 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrInvalidInstallmentPeriods = errors.New("invalid number of installments")
+
+// InstallmentFeeBearer 分期手续费承担方
+type InstallmentFeeBearer string
+
+const (
+	InstallmentFeeByCardholder InstallmentFeeBearer = "0" // 持卡人承担
+	InstallmentFeeByMerchant   InstallmentFeeBearer = "1" // 商户承担(商户贴息)
+)
+
+// InstallmentPlan 分期付款方案
+type InstallmentPlan struct {
+	Periods    int                  // 分期期数 如3,6,12,24
+	FeeBearer  InstallmentFeeBearer // 手续费承担方 默认持卡人承担
+	IssInsCode string               // 发卡机构代码 指定分期银行
+}
+
+// instalTransInfo 生成分期付款信息域
+func (p InstallmentPlan) instalTransInfo() (string, error) {
+	if p.Periods <= 0 || p.Periods > 99 {
+		return "", ErrInvalidInstallmentPeriods
+	}
+
+	feeBearer := p.FeeBearer
+	if feeBearer == "" {
+		feeBearer = InstallmentFeeByCardholder
+	}
+
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "numberOfInstallments", V: fmt.Sprintf("%02d", p.Periods)})
+	kvs = append(kvs, KVpair{K: "mchntFeeSubsidy", V: string(feeBearer)})
+	return BuildComposite(kvs), nil
+}
+
+// FrontConsumeInstallment 前台分期付款消费(txnSubType 03)
+func (up *UnionPay) FrontConsumeInstallment(orderID string, amount Amount, returnURL, notifyURL string, plan InstallmentPlan, extraParams map[string]string) (html string, err error) {
+	var info string
+	info, err = plan.instalTransInfo()
+	if err != nil {
+		return
+	}
+
+	params := make(map[string]string)
+	for k, v := range extraParams {
+		params[k] = v
+	}
+	params["txnSubType"] = "03"
+	params["instalTransInfo"] = info
+	if plan.IssInsCode != "" {
+		params["issInsCode"] = plan.IssInsCode
+	}
+
+	return up.FrontConsume(orderID, amount, returnURL, notifyURL, params)
+}
+
+// InstallmentInfo 通知及查询中返回的分期付款信息
+type InstallmentInfo struct {
+	Periods                int                  // 分期期数
+	FeeBearer              InstallmentFeeBearer // 手续费承担方
+	FirstInstallmentAmount Amount               // 首期金额
+	InstallmentAmount      Amount               // 每期金额
+	InstallmentFee         Amount               // 手续费
+	InstallmentFeeRate     string               // 手续费费率
+
+	Fields map[string]string // 全部子域
+}
+
+// ParseInstalTransInfo 解析分期付款信息域,为空时返回nil
+// 子域中的金额以交易币种c的最小货币单位表示,c为零值时按人民币计
+func ParseInstalTransInfo(s string, c Currency) (info *InstallmentInfo, err error) {
+	if s == "" {
+		return
+	}
+	if c.Code == "" {
+		c = CNY
+	}
+
+	fields := ParseComposite(s)
+	info = &InstallmentInfo{
+		FeeBearer:          InstallmentFeeBearer(fields["mchntFeeSubsidy"]),
+		InstallmentFeeRate: fields["installmentFeeRate"],
+		Fields:             fields,
+	}
+
+	if info.Periods, err = atoiField(fields, "numberOfInstallments"); err != nil {
+		return
+	}
+	if info.FirstInstallmentAmount, err = parseAmountField(fields, "firstInstallmentAmount", c); err != nil {
+		return
+	}
+	if info.InstallmentAmount, err = parseAmountField(fields, "installmentAmount", c); err != nil {
+		return
+	}
+	if info.InstallmentFee, err = parseAmountField(fields, "installmentFee", c); err != nil {
+		return
+	}
+	return
+}
+
+func atoiField(fields map[string]string, key string) (int, error) {
+	v, ok := fields[key]
+	if !ok || v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %s", key, err)
+	}
+	return n, nil
+}
+
+// parseAmountField 解析组合域中以币种c的最小货币单位表示的金额子域
+func parseAmountField(fields map[string]string, key string, c Currency) (Amount, error) {
+	a, err := ParseTxnAmt(fields[key], c.Code)
+	if err != nil {
+		return a, fmt.Errorf("bad %s: %w", key, err)
+	}
+	return a, nil
+}
+
+// Installment 解析通知中的分期付款信息
+func (r *FrontConsumeNotifyResponse) Installment() (*InstallmentInfo, error) {
+	return ParseInstalTransInfo(r.InstalTransInfo, r.TxnAmt.Currency)
+}
+
+// Installment 解析前台返回中的分期付款信息
+func (r *FrontConsumeReturnResponse) Installment() (*InstallmentInfo, error) {
+	return ParseInstalTransInfo(r.InstalTransInfo, r.TxnAmt.Currency)
+}
+
+// Installment 解析查询结果中的分期付款信息
+func (r *ConsumeQueryResponse) Installment() (*InstallmentInfo, error) {
+	return ParseInstalTransInfo(r.InstalTransInfo, r.TxnAmt.Currency)
+}
@@ -0,0 +1,134 @@
+package unionpay
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestInstalTransInfoRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		plan InstallmentPlan
+		want string
+	}{
+		{plan: InstallmentPlan{Periods: 3}, want: "{numberOfInstallments=03&mchntFeeSubsidy=0}"},
+		{plan: InstallmentPlan{Periods: 12, FeeBearer: InstallmentFeeByMerchant}, want: "{numberOfInstallments=12&mchntFeeSubsidy=1}"},
+		{plan: InstallmentPlan{Periods: 24, FeeBearer: InstallmentFeeByCardholder}, want: "{numberOfInstallments=24&mchntFeeSubsidy=0}"},
+	} {
+		got, err := c.plan.instalTransInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("%+v: got %s, want %s", c.plan, got, c.want)
+		}
+
+		info, err := ParseInstalTransInfo(got, CNY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		feeBearer := c.plan.FeeBearer
+		if feeBearer == "" {
+			feeBearer = InstallmentFeeByCardholder
+		}
+		if info.Periods != c.plan.Periods || info.FeeBearer != feeBearer {
+			t.Errorf("%+v: parsed %+v", c.plan, info)
+		}
+	}
+
+	for _, periods := range []int{0, -1, 100} {
+		if _, err := (InstallmentPlan{Periods: periods}).instalTransInfo(); err != ErrInvalidInstallmentPeriods {
+			t.Errorf("periods %d: %v", periods, err)
+		}
+	}
+}
+
+func TestParseInstalTransInfo(t *testing.T) {
+	info, err := ParseInstalTransInfo("{numberOfInstallments=06&mchntFeeSubsidy=1&firstInstallmentAmount=16700&installmentAmount=16660&installmentFee=360&installmentFeeRate=0.0060}", Currency{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &InstallmentInfo{
+		Periods:                6,
+		FeeBearer:              InstallmentFeeByMerchant,
+		FirstInstallmentAmount: Fen(16700),
+		InstallmentAmount:      Fen(16660),
+		InstallmentFee:         Fen(360),
+		InstallmentFeeRate:     "0.0060",
+	}
+	info.Fields = nil
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v\nwant %+v", info, want)
+	}
+
+	jpy, _ := LookupCurrency("JPY")
+	if info, err = ParseInstalTransInfo("{numberOfInstallments=06&installmentAmount=16660}", jpy); err != nil || info.InstallmentAmount != NewAmount(16660, jpy) {
+		t.Errorf("JPY: %+v, %v", info, err)
+	}
+	if info, err = ParseInstalTransInfo("", CNY); info != nil || err != nil {
+		t.Errorf("empty: %+v, %v", info, err)
+	}
+	if _, err = ParseInstalTransInfo("{numberOfInstallments=06&installmentAmount=abc}", CNY); err == nil {
+		t.Error("bad amount: want error")
+	}
+}
+
+func TestFrontConsumeInstallment(t *testing.T) {
+	up := newTestPayment(t)
+
+	page, err := up.FrontConsumeInstallment("INS20240102001", Fen(100000), "https://example.com/return", "https://example.com/notify",
+		InstallmentPlan{Periods: 6, FeeBearer: InstallmentFeeByMerchant, IssInsCode: "ICBC"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := htmlForm(t, page)
+	for k, want := range map[string]string{
+		"txnType":         "01",
+		"txnSubType":      "03",
+		"issInsCode":      "ICBC",
+		"instalTransInfo": "{numberOfInstallments=06&mchntFeeSubsidy=1}",
+		"txnAmt":          "100000",
+	} {
+		if got := form.Get(k); got != want {
+			t.Errorf("%s: got %q, want %q", k, got, want)
+		}
+	}
+
+	if _, err = up.FrontConsumeInstallment("INS20240102002", Fen(100000), "", "", InstallmentPlan{}, nil); err != ErrInvalidInstallmentPeriods {
+		t.Errorf("no periods: %v", err)
+	}
+}
+
+func TestFrontConsumeNotifyInstallment(t *testing.T) {
+	up := newTestPayment(t)
+
+	vals := url.Values{}
+	vals.Set("version", "5.0.0")
+	vals.Set("encoding", "UTF-8")
+	vals.Set("signMethod", "01")
+	vals.Set("txnType", "01")
+	vals.Set("txnSubType", "03")
+	vals.Set("bizType", "000201")
+	vals.Set("merId", "700000000000001")
+	vals.Set("orderId", "INS20240102001")
+	vals.Set("txnTime", "20240102140000")
+	vals.Set("txnAmt", "100000")
+	vals.Set("currencyCode", "156")
+	vals.Set("queryId", "202401021400001234567")
+	vals.Set("respCode", "00")
+	vals.Set("respMsg", "success")
+	vals.Set("instalTransInfo", "{numberOfInstallments=06&mchntFeeSubsidy=1&firstInstallmentAmount=16700&installmentAmount=16660}")
+
+	resp, err := up.FrontConsumeNotify(signedNotify(t, up, vals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := resp.Installment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Periods != 6 || info.FirstInstallmentAmount != Fen(16700) || info.InstallmentAmount != Fen(16660) {
+		t.Errorf("got %+v", info)
+	}
+}
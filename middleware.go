@@ -0,0 +1,72 @@
+package unionpay
+
+import (
+	"context"
+	"net/url"
+)
+
+// Request 发往银联网关的请求,Form已签名
+type Request struct {
+	URL     *url.URL
+	Form    url.Values
+	Context context.Context // 为nil时使用context.Background()
+}
+
+func (r *Request) context() context.Context {
+	if r.Context == nil {
+		return context.Background()
+	}
+	return r.Context
+}
+
+// Response 银联网关应答
+type Response struct {
+	Body   []byte            // 原始应答报文
+	Fields map[string]string // 应答域
+}
+
+// RoundTripFunc 发送请求并验签,应答码非00时同时返回应答及*RespError
+type RoundTripFunc func(req *Request) (*Response, error)
+
+// Middleware 包装网关请求,可用于日志,监控,链路追踪等
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// NotifyVerifyFunc 验证通知签名,fields为参与验签的域,为空表示全部域
+type NotifyVerifyFunc func(vals url.Values, fields []string) error
+
+// NotifyMiddleware 包装通知验签
+type NotifyMiddleware func(next NotifyVerifyFunc) NotifyVerifyFunc
+
+// Use 添加网关请求中间件,先添加的在外层,应在初始化时调用
+// WithAccess复制出的UnionPay共享中间件
+func (up *UnionPay) Use(m ...Middleware) *UnionPay {
+	up.client.middlewares = append(up.client.middlewares, m...)
+	return up
+}
+
+// UseNotify 添加通知验签中间件,先添加的在外层,应在初始化时调用
+func (up *UnionPay) UseNotify(m ...NotifyMiddleware) *UnionPay {
+	up.client.notifyMiddlewares = append(up.client.notifyMiddlewares, m...)
+	return up
+}
+
+// VerifyNotify 验证全部域的签名,用于验证已保存的通知报文
+func (up *UnionPay) VerifyNotify(vals url.Values) error {
+	return up.verifyNotify(vals, nil)
+}
+
+// verifyNotify 经过通知中间件验证通知签名
+func (up *UnionPay) verifyNotify(vals url.Values, fields []string) error {
+	fn := func(vals url.Values, fields []string) error {
+		v, _ := up.creds().verifierFor(vals.Get("certId"), up.now())
+		err := verify(v, vals, fields)
+		if aerr := up.auditNotify(vals, fields, err); aerr != nil && err == nil {
+			err = aerr
+		}
+		return err
+	}
+	for i := len(up.client.notifyMiddlewares) - 1; i >= 0; i-- {
+		fn = up.client.notifyMiddlewares[i](fn)
+	}
+	return fn(vals, fields)
+}
@@ -1,11 +1,8 @@
 package unionpay
 
 import (
-	"crypto/rsa"
-	"fmt"
 	"net/http"
 	"net/url"
-	"time"
 )
 
 var mobilePaymentParamMap = map[string]bool{
@@ -31,6 +28,10 @@ var mobilePaymentParamMap = map[string]bool{
 	"accNo":        false, //  	账号	accNo	AN1..512	C	银行卡号。请求时使用加密公钥对交易账号加密，并做Base64编码后上送；应答时如需返回，则使用签名私钥进行解密。前台交易可由银联页面采集，也可由商户上送并返显，如需锁定返显卡号，应通过保留域（reserved）上送卡号锁定标识。	业务运营中心开启了锁卡权限的情况下，送此字段可以指定用户在控件中输入的卡号。
 	"reqReserved":  false, //  	请求方自定义域	reqReserved	ANS1..1024	O	商户自定义保留域，交易应答时会原样返回	商户自定义保留域，交易应答时会原样返回
 	"orderDesc":    false, //  	订单描述	orderDesc	ANS1..32	C	描述订单信息，显示在银联支付控件或客户端支付界面中	上送时可在控件内显示该信息，但仅用于控件显示，不会在商户和用户的对账单中出现。
+	"acqInsCode":   false, //  	收单机构代码	acqInsCode	AN8..11	C	收单机构接入时必须上送
+	"subMerId":     false, //  	二级商户代码	subMerId	AN5..15	C	平台类商户接入时必须上送
+	"subMerName":   false, //  	二级商户全称	subMerName	ANS1..40	C	平台类商户接入时必须上送
+	"subMerAbbr":   false, //  	二级商户简称	subMerAbbr	ANS1..16	C	平台类商户接入时必须上送
 }
 
 type MobilePaymentResponse struct {
@@ -53,15 +54,21 @@ type MobilePaymentResponse struct {
 	TN          string
 }
 
-func (up *UnionPay) MobilePayment(orderID string, amount int64, notifyURL string, extraParams map[string]string) (resp *MobilePaymentResponse, err error) {
-	params := up.initMobilePaymentParams(orderID, amount, notifyURL, extraParams)
+func (up *UnionPay) MobilePayment(orderID string, amount Amount, notifyURL string, extraParams map[string]string) (resp *MobilePaymentResponse, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params := up.initMobilePaymentParams(cred, orderID, amount, notifyURL, extraParams)
 	kvs, err := GenKVpairs(mobilePaymentParamMap, params, "signature")
 	if err != nil {
 		return
 	}
 
 	var sig string
-	sig, err = signature(up.privateKey, kvs)
+	sig, err = up.sign(cred, kvs)
 	if err != nil {
 		return
 	}
@@ -80,7 +87,7 @@ func (up *UnionPay) MobilePayment(orderID string, amount int64, notifyURL string
 	}
 
 	var result MobilePaymentResponse
-	err = up.client.PostForm(u, data, &result)
+	err = up.client.PostForm(up.context(), u, data, &result)
 	if err != nil {
 		return
 	}
@@ -90,33 +97,34 @@ func (up *UnionPay) MobilePayment(orderID string, amount int64, notifyURL string
 	return
 }
 
-func (up *UnionPay) initMobilePaymentParams(orderID string, amount int64, notifyURL string, extraParams map[string]string) (params map[string]string) {
+func (up *UnionPay) initMobilePaymentParams(cred *credentials, orderID string, amount Amount, notifyURL string, extraParams map[string]string) (params map[string]string) {
 	params = make(map[string]string)
 
-	params["version"] = "5.0.0"                             //版本号
-	params["encoding"] = "utf-8"                            //编码方式
-	params["certId"] = up.publicKey.SerialNumber.String()   //证书id
-	params["signMethod"] = "01"                             //签名方法
-	params["txnType"] = "01"                                //交易类型
-	params["txnSubType"] = "01"                             //交易子类
-	params["bizType"] = "000201"                            //业务类型
-	params["channelType"] = "08"                            //渠道类型，07-PC，08-手机
-	params["accessType"] = "0"                              //接入类型
-	params["merId"] = up.mchID                              //商户代码，请改自己的测试商户号
-	params["backUrl"] = notifyURL                           //后台通知地址
-	params["orderId"] = orderID                             //商户订单号
-	params["currencyCode"] = "156"                          //交易币种
-	params["txnTime"] = time.Now().Format("20060102150405") //订单发送时间
-	params["txnAmt"] = fmt.Sprintf("%d", amount)            //交易金额，单位分
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "utf-8"                       //编码方式
+	params["certId"] = cred.certID                     //证书id
+	params["signMethod"] = cred.signMethod()           //签名方法
+	params["txnType"] = "01"                           //交易类型
+	params["txnSubType"] = "01"                        //交易子类
+	params["bizType"] = "000201"                       //业务类型
+	params["channelType"] = "08"                       //渠道类型，07-PC，08-手机
+	params["merId"] = up.mchID                         //商户代码，请改自己的测试商户号
+	params["backUrl"] = notifyURL                      //后台通知地址
+	params["orderId"] = orderID                        //商户订单号
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["txnTime"] = up.txnTime()                   //订单发送时间
+	params["txnAmt"] = amount.txnAmt()                 //交易金额，最小货币单位
 
 	if extraParams != nil {
 		for k, v := range extraParams {
-			_, ok := frontConsumeParamMap[k]
+			_, ok := mobilePaymentParamMap[k]
 			if ok {
 				params[k] = v
 			}
 		}
 	}
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
 	return
 }
 
@@ -136,7 +144,7 @@ type MobilePaymentNotifyResponse struct {
 	//  订单信息
 	OrderID      string //  1	商户订单号	orderId	AN8..32	R	商户订单号，仅能用大小写字母与数字，不能用特殊字符
 	CurrencyCode string //  2	交易币种	currencyCode	AN3	M	币种格式必须为3位代码，境内客户取值：156（人民币）	默认为156
-	TxnAmt       string //  3	交易金额	txnAmt	N1..12	R	单位为分，不能带小数点，样例：1元送100
+	TxnAmt       Amount //  3	交易金额	txnAmt	N1..12	R	单位为分，不能带小数点，样例：1元送100
 	TxnTime      string //  4	订单发送时间	txnTime	YYYYMMDDHHmmss	R	必须使用当前北京时间（年年年年月月日日时时分分秒秒）24小时制，样例：20151123152540，北京时间
 	PayType      string //  5	支付方式	payType	N4	C	默认不返回此域，如需要返此域，需要提交申请，视商户配置返回，可在消费类交易中返回以下中的一种： 0001：认证支付 0002：快捷支付 0004：储值卡支付 0005：IC卡支付 0201：网银支付 1001：牡丹畅通卡支付 1002：中铁银通卡支付 0401：信用卡支付——暂定 0402：小额临时支付 0403：认证支付2.0 0404：互联网订单手机支付 9000：其他无卡支付(如手机客户端支付)	根据商户配置返回
 	AccNo        string //  6	账号	accNo	AN1..512	C	银行卡号。请求时使用加密公钥对交易账号加密，并做Base64编码后上送；应答时如需返回，则使用签名私钥进行解密。前台交易可由银联页面采集，也可由商户上送并返显，如需锁定返显卡号，应通过保留域（reserved）上送卡号锁定标识。	根据商户配置返回
@@ -150,7 +158,7 @@ type MobilePaymentNotifyResponse struct {
 	TraceTime          string //  3	交易传输时间	traceTime	MMDDHHmmss	M	（月月日日时时分分秒秒）24小时制收单机构对账时使用，该域由银联系统产生
 	SettleDate         string //  4	清算日期	settleDate	MMDD	M	为银联和入网机构间的交易结算日期。一般前一日23点至当天23点为一个清算日。也就是23点前的交易，当天23点之后开始结算，23点之后的交易，要第二天23点之后才会结算。测试环境为测试需要，13:30左右日切，所以13:30到13:30为一个清算日，测试环境今天下午为今天的日期，今天上午为昨天的日期。
 	SettleCurrencyCode string //  5	清算币种	settleCurrencyCode	AN3	M	境内返回156
-	SettleAmt          string //  6	清算金额	settleAmt	N1..12	M	取值同交易金额
+	SettleAmt          Amount //  6	清算金额	settleAmt	N1..12	M	取值同交易金额
 	RespCode           string //  7	应答码	respCode	AN2	M	具体参见应答码定义章节
 	RespMsg            string //  8	应答信息	respMsg	ANS1..256	M	填写具体的应答信息
 	PayCardNo          string //  9	支付卡标识	payCardNo	ANS1..19	C	移动支付交易时，根据客户配置返回	业务运营中心开启此字段权时，此字段会返回打码卡号。
@@ -201,7 +209,12 @@ func (up *UnionPay) MobilePaymentNotify(req *http.Request) (resp *MobilePaymentN
 		"tn",
 	}
 
-	if err = verify(up.verifySignCert.PublicKey.(*rsa.PublicKey), vals, fields); err != nil {
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
+	}
+
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
 		return
 	}
 
@@ -218,7 +231,7 @@ func (up *UnionPay) MobilePaymentNotify(req *http.Request) (resp *MobilePaymentN
 		MerID:              vals.Get("merId"),
 		OrderID:            vals.Get("orderId"),
 		CurrencyCode:       vals.Get("currencyCode"),
-		TxnAmt:             vals.Get("txnAmt"),
+		TxnAmt:             txnAmt,
 		TxnTime:            vals.Get("txnTime"),
 		PayType:            vals.Get("payType"),
 		AccNo:              vals.Get("accNo"),
@@ -230,7 +243,7 @@ func (up *UnionPay) MobilePaymentNotify(req *http.Request) (resp *MobilePaymentN
 		TraceTime:          vals.Get("traceTime"),
 		SettleDate:         vals.Get("settleDate"),
 		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
-		SettleAmt:          vals.Get("settleAmt"),
+		SettleAmt:          settleAmt,
 		RespCode:           vals.Get("respCode"),
 		RespMsg:            vals.Get("respMsg"),
 		PayCardNo:          vals.Get("payCardNo"),
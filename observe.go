@@ -0,0 +1,237 @@
+package unionpay
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger 结构化日志,fields中的敏感信息已脱敏
+type Logger interface {
+	Log(event string, fields map[string]string)
+}
+
+// Metrics 监控指标
+type Metrics interface {
+	// ObserveLatency 网关请求耗时,按交易类型统计
+	ObserveLatency(txnType string, d time.Duration)
+	// IncRespCode 应答码计数,网络等错误时respCode为空
+	IncRespCode(txnType, respCode string)
+	// IncSignatureFailure 验签失败计数,source为response或notify
+	IncSignatureFailure(source string)
+}
+
+// Tracer 链路追踪
+type Tracer interface {
+	StartSpan(name string) Span
+}
+
+// Span 追踪片段
+type Span interface {
+	SetAttribute(key, value string)
+	End(err error)
+}
+
+// Observer 日志,监控及追踪,均可为空
+type Observer struct {
+	Logger  Logger
+	Metrics Metrics
+	Tracer  Tracer
+}
+
+// Observe 添加日志,监控及追踪中间件到网关请求及通知验签
+func (up *UnionPay) Observe(o Observer) *UnionPay {
+	return up.Use(o.Middleware()).UseNotify(o.NotifyMiddleware())
+}
+
+// Middleware 网关请求中间件
+func (o Observer) Middleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			txnType := req.Form.Get("txnType")
+
+			var span Span
+			if o.Tracer != nil {
+				span = o.Tracer.StartSpan("unionpay.request")
+				span.SetAttribute("merId", req.Form.Get("merId"))
+				span.SetAttribute("orderId", req.Form.Get("orderId"))
+				span.SetAttribute("txnType", txnType)
+				span.SetAttribute("txnSubType", req.Form.Get("txnSubType"))
+			}
+			if o.Logger != nil {
+				o.Logger.Log("unionpay.request", withEndpoint(MaskValues(req.Form), req.URL))
+			}
+
+			start := time.Now()
+			resp, err := next(req)
+			elapsed := time.Since(start)
+
+			var respCode string
+			fields := map[string]string{}
+			if resp != nil {
+				respCode = resp.Fields["respCode"]
+				fields = MaskFields(resp.Fields)
+			}
+			fields["txnType"] = txnType
+			fields["orderId"] = req.Form.Get("orderId")
+			fields["elapsed"] = elapsed.String()
+			if err != nil {
+				fields["error"] = err.Error()
+			}
+
+			if o.Metrics != nil {
+				o.Metrics.ObserveLatency(txnType, elapsed)
+				o.Metrics.IncRespCode(txnType, respCode)
+				if _, ok := err.(*SignatureError); ok {
+					o.Metrics.IncSignatureFailure("response")
+				}
+			}
+			if o.Logger != nil {
+				o.Logger.Log("unionpay.response", withEndpoint(fields, req.URL))
+			}
+			if span != nil {
+				if resp != nil {
+					span.SetAttribute("queryId", resp.Fields["queryId"])
+				}
+				span.SetAttribute("respCode", respCode)
+				span.End(err)
+			}
+			return resp, err
+		}
+	}
+}
+
+// NotifyMiddleware 通知验签中间件
+func (o Observer) NotifyMiddleware() NotifyMiddleware {
+	return func(next NotifyVerifyFunc) NotifyVerifyFunc {
+		return func(vals url.Values, fields []string) error {
+			var span Span
+			if o.Tracer != nil {
+				span = o.Tracer.StartSpan("unionpay.notify")
+				span.SetAttribute("merId", vals.Get("merId"))
+				span.SetAttribute("orderId", vals.Get("orderId"))
+				span.SetAttribute("queryId", vals.Get("queryId"))
+				span.SetAttribute("txnType", vals.Get("txnType"))
+				span.SetAttribute("respCode", vals.Get("respCode"))
+			}
+
+			err := next(vals, fields)
+
+			if o.Metrics != nil {
+				o.Metrics.IncRespCode(vals.Get("txnType"), vals.Get("respCode"))
+				if _, ok := err.(*SignatureError); ok {
+					o.Metrics.IncSignatureFailure("notify")
+				}
+			}
+			if o.Logger != nil {
+				m := MaskValues(vals)
+				if err != nil {
+					m["error"] = err.Error()
+				}
+				o.Logger.Log("unionpay.notify", m)
+			}
+			if span != nil {
+				span.End(err)
+			}
+			return err
+		}
+	}
+}
+
+func withEndpoint(fields map[string]string, u *url.URL) map[string]string {
+	if u != nil {
+		fields["endpoint"] = u.Path
+	}
+	return fields
+}
+
+// maskKeys 需脱敏的域
+var maskKeys = map[string]func(string) string{
+	"accNo":          MaskPAN,
+	"phoneNo":        maskPhone,
+	"signature":      maskAll,
+	"signPubKeyCert": maskAll,
+	"customerInfo":   maskAll,
+	"encryptedInfo":  maskAll,
+	"pin":            maskAll,
+	"cvn2":           maskAll,
+	"expired":        maskAll,
+	"certifId":       maskAll,
+	"smsCode":        maskAll,
+	"qrNo":           maskAll, // 付款码可直接用于扣款
+	"fileContent":    maskAll,
+	"accName":        maskAll,
+	"billQueryInfo":  maskAll, // 含缴费户号,户名等
+	"billDetailInfo": maskAll,
+}
+
+// MaskFields 复制报文域并对卡号,手机号,签名等敏感信息脱敏
+func MaskFields(fields map[string]string) map[string]string {
+	m := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if mask, ok := maskKeys[k]; ok && v != "" {
+			v = mask(v)
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// MaskValues 同MaskFields
+func MaskValues(vals url.Values) map[string]string {
+	fields := make(map[string]string, len(vals))
+	for k := range vals {
+		fields[k] = vals.Get(k)
+	}
+	return MaskFields(fields)
+}
+
+// MaskPAN 卡号保留前6位及后4位,加密后的卡号全部隐藏
+func MaskPAN(pan string) string {
+	if len(pan) < 13 || len(pan) > 19 || strings.Trim(pan, "0123456789") != "" {
+		return maskAll(pan)
+	}
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+func maskPhone(phone string) string {
+	if len(phone) != 11 || strings.Trim(phone, "0123456789") != "" {
+		return maskAll(phone)
+	}
+	return phone[:3] + "****" + phone[7:]
+}
+
+func maskAll(s string) string {
+	return "***"
+}
+
+// JSONLogger 每个事件输出一行JSON
+type JSONLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w}
+}
+
+func (l *JSONLogger) Log(event string, fields map[string]string) {
+	m := make(map[string]string, len(fields)+2)
+	for k, v := range fields {
+		m[k] = v
+	}
+	m["event"] = event
+	m["time"] = time.Now().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
@@ -0,0 +1,163 @@
+package unionpay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaskFields(t *testing.T) {
+	in := map[string]string{
+		"accNo":          "6216261000000000018",
+		"phoneNo":        "13552535506",
+		"qrNo":           "6225880000000000",
+		"accName":        "全渠道",
+		"billQueryInfo":  `{"usr_num":"123456","usr_nm":"张三"}`,
+		"billDetailInfo": `{"usr_num":"123456"}`,
+		"customerInfo":   "e2NlcnRpZklkPTM0MTEyNjE5NzcwOTIxODM2Nn0=",
+		"fileContent":    "eJzLSM3JyVcozy/KSQEAGgQEXQ==",
+		"signature":      "c2lnbmF0dXJl",
+		"orderId":        "ORDER0001",
+		"respCode":       "",
+	}
+	want := map[string]string{
+		"accNo":          "621626*********0018",
+		"phoneNo":        "135****5506",
+		"qrNo":           "***",
+		"accName":        "***",
+		"billQueryInfo":  "***",
+		"billDetailInfo": "***",
+		"customerInfo":   "***",
+		"fileContent":    "***",
+		"signature":      "***",
+		"orderId":        "ORDER0001",
+		"respCode":       "",
+	}
+
+	got := MaskFields(in)
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if in["accNo"] != "6216261000000000018" {
+		t.Error("MaskFields modified its input")
+	}
+
+	if got := MaskPAN("not-a-card-number"); got != "***" {
+		t.Errorf("MaskPAN(encrypted) = %s", got)
+	}
+	if got := maskPhone("+8613552535506"); got != "***" {
+		t.Errorf("maskPhone(+86...) = %s", got)
+	}
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []string
+	fields []map[string]string
+}
+
+func (l *recordingLogger) Log(event string, fields map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	l.fields = append(l.fields, fields)
+}
+
+type recordingMetrics struct {
+	respCodes []string
+	sigFails  []string
+}
+
+func (m *recordingMetrics) ObserveLatency(string, time.Duration) {}
+
+func (m *recordingMetrics) IncRespCode(txnType, respCode string) {
+	m.respCodes = append(m.respCodes, txnType+":"+respCode)
+}
+
+func (m *recordingMetrics) IncSignatureFailure(source string) {
+	m.sigFails = append(m.sigFails, source)
+}
+
+func TestObserverMiddleware(t *testing.T) {
+	up := newTestPayment(t)
+	logger := &recordingLogger{}
+	metrics := &recordingMetrics{}
+	up.Observe(Observer{Logger: logger, Metrics: metrics})
+	fakeGateway(up, func(form url.Values) map[string]string {
+		return respFields(form, "00", "accNo", "6216261000000000018")
+	})
+
+	if _, err := up.BalanceQuery("BAL20240102001", "6216261000000000018", "123456", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(logger.events, ",") != "unionpay.request,unionpay.response" {
+		t.Fatalf("events = %v", logger.events)
+	}
+	req, resp := logger.fields[0], logger.fields[1]
+	for _, k := range []string{"accNo", "customerInfo", "signature"} {
+		if req[k] != "***" {
+			t.Errorf("request %s logged as %q", k, req[k])
+		}
+	}
+	if resp["accNo"] != "621626*********0018" || resp["txnType"] != "71" || resp["orderId"] != "BAL20240102001" {
+		t.Errorf("response fields = %v", resp)
+	}
+	if strings.Join(metrics.respCodes, ",") != "71:00" {
+		t.Errorf("respCodes = %v", metrics.respCodes)
+	}
+}
+
+func TestObserverNotifyMiddleware(t *testing.T) {
+	up := newTestPayment(t)
+	logger := &recordingLogger{}
+	metrics := &recordingMetrics{}
+	up.Observe(Observer{Logger: logger, Metrics: metrics})
+
+	req := signedNotify(t, up, url.Values{
+		"merId":    {up.MerID()},
+		"orderId":  {"ORDER0001"},
+		"txnType":  {"01"},
+		"qrNo":     {"6225880000000000"},
+		"respCode": {"00"},
+	})
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	req.Form.Set("orderId", "ORDER0002")
+	if err := up.verifyNotify(req.Form, nil); err == nil {
+		t.Fatal("tampered notify verified")
+	}
+
+	if len(logger.fields) != 1 || logger.fields[0]["qrNo"] != "***" || logger.fields[0]["error"] == "" {
+		t.Errorf("notify log = %v", logger.fields)
+	}
+	if strings.Join(metrics.sigFails, ",") != "notify" {
+		t.Errorf("signature failures = %v", metrics.sigFails)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONLogger(&buf)
+	l.Log("unionpay.request", map[string]string{"orderId": "ORDER0001"})
+	l.Log("unionpay.response", map[string]string{"respCode": "00"})
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	var m map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["event"] != "unionpay.request" || m["orderId"] != "ORDER0001" || m["time"] == "" {
+		t.Errorf("line = %v", m)
+	}
+}
@@ -0,0 +1,503 @@
+package unionpay
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+var (
+	ErrPayoutDuplicate = errors.New("payout order has been submitted")
+	ErrPayoutUnknown   = errors.New("payout order status is unknown, query it before resending")
+)
+
+var payoutParamMap = map[string]bool{
+	"version":       true,  // 版本号 固定填写5.0.0
+	"encoding":      true,  // 编码方式 默认值 UTF-8
+	"certId":        true,  // 证书id
+	"signature":     true,  // 签名 填写对报文摘要的签名
+	"signMethod":    true,  // 签名方式 取值：01 表示采用的是RSA
+	"txnType":       true,  // 交易类型 取值：12
+	"txnSubType":    true,  // 交易子类 取值：00
+	"bizType":       true,  // 产品类型 000401
+	"channelType":   true,  // 渠道类型 07:互联网
+	"backUrl":       true,  // 后台通知地址
+	"accessType":    true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
+	"merId":         true,  // 商户代码
+	"acqInsCode":    false, // 收单机构代码 收单机构接入时必须上送
+	"orderId":       true,  // 商户订单号 商户端生成
+	"txnTime":       true,  // 订单发送时间 商户发送交易时间
+	"txnAmt":        true,  // 交易金额 单位为分
+	"currencyCode":  true,  // 交易币种 默认为156
+	"accType":       false, // 账号类型 01:银行卡 02:存折
+	"accNo":         true,  // 账号 使用加密证书公钥加密后Base64编码上送
+	"encryptCertId": true,  // 加密证书id 上送加密信息时必送
+	"customerInfo":  false, // 银行卡验证信息及身份信息 代付收款人姓名等
+	"issInsCode":    false, // 发卡机构代码 账号类型为02-存折时需填写
+	"subMerId":      false, // 二级商户代码 商户类型为平台商户接入时必须上送
+	"subMerName":    false, // 二级商户全称 商户类型为平台商户接入时必须上送
+	"subMerAbbr":    false, // 二级商户简称 商户类型为平台商户接入时必须上送
+	"reqReserved":   false, // 请求方保留域 商户自定义保留域，交易应答时会原样返回
+	"reserved":      false, // 保留域
+	"termId":        false, // 终端号
+}
+
+// PayoutStatus 代付交易状态
+type PayoutStatus int
+
+const (
+	PayoutNotSent    PayoutStatus = iota // 未发送,参数校验或台账预留失败,可修正后重新发起
+	PayoutUnknown                        // 状态未明,需查询确认,不可重发
+	PayoutProcessing                     // 已受理,等待通知或查询结果
+	PayoutSucceeded                      // 代付成功
+	PayoutFailed                         // 代付失败,可使用新的订单号重新发起
+)
+
+func (s PayoutStatus) String() string {
+	switch s {
+	case PayoutNotSent:
+		return "not_sent"
+	case PayoutProcessing:
+		return "processing"
+	case PayoutSucceeded:
+		return "succeeded"
+	case PayoutFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// PayoutRecord 代付台账记录
+type PayoutRecord struct {
+	OrderID string
+	TxnTime string
+	TxnAmt  Amount
+	QueryID string
+	Status  PayoutStatus
+}
+
+// final 成功或失败为最终状态,不会再改变
+func (s PayoutStatus) final() bool {
+	return s == PayoutSucceeded || s == PayoutFailed
+}
+
+// advance 状态只能向前推进,最终状态不可覆盖
+func (s PayoutStatus) advance(next PayoutStatus) bool {
+	return !s.final() && next >= s
+}
+
+// PayoutLedger 代付台账,用于记录每一笔已发出的代付
+// Reserve在代付发送前调用,订单号已存在时必须返回错误
+// CompareAndSwap仅当台账中的状态为old时更新为rec,记录不存在时视为PayoutNotSent,须原子执行
+type PayoutLedger interface {
+	Reserve(rec PayoutRecord) error
+	CompareAndSwap(old PayoutStatus, rec PayoutRecord) (swapped bool, err error)
+	Get(orderID string) (rec PayoutRecord, ok bool, err error)
+}
+
+type memoryPayoutLedger struct {
+	mu      sync.Mutex
+	records map[string]PayoutRecord
+}
+
+// NewMemoryPayoutLedger 基于内存的代付台账,进程重启后记录丢失,仅适用于测试
+func NewMemoryPayoutLedger() PayoutLedger {
+	return &memoryPayoutLedger{records: make(map[string]PayoutRecord)}
+}
+
+func (l *memoryPayoutLedger) Reserve(rec PayoutRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old, ok := l.records[rec.OrderID]; ok {
+		if old.Status == PayoutUnknown || old.Status == PayoutProcessing {
+			return ErrPayoutUnknown
+		}
+		return ErrPayoutDuplicate
+	}
+	l.records[rec.OrderID] = rec
+	return nil
+}
+
+func (l *memoryPayoutLedger) CompareAndSwap(old PayoutStatus, rec PayoutRecord) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.records[rec.OrderID].Status != old {
+		return false, nil
+	}
+	l.records[rec.OrderID] = rec
+	return true, nil
+}
+
+func (l *memoryPayoutLedger) Get(orderID string) (rec PayoutRecord, ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec, ok = l.records[orderID]
+	return
+}
+
+type PayoutResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	OrderID     string
+	TxnTime     string
+	TxnAmt      Amount // 交易金额，以币种的最小货币单位表示
+	ReqReserved string
+	Reserved    string
+	QueryID     string
+	RespCode    string
+	RespMsg     string
+}
+
+// Payout 代付到银行卡或存折,accNo为明文卡号,发送前使用加密证书加密
+// 返回的PayoutStatus为PayoutUnknown时不能重发,需调用PayoutQuery确认结果
+// 参数校验失败或台账预留失败时请求未发出,返回PayoutNotSent
+func (up *UnionPay) Payout(orderID string, amount Amount, accNo, notifyURL string, extraParams map[string]string) (resp *PayoutResponse, status PayoutStatus, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params, err := up.initPayoutParams(cred, orderID, amount, accNo, notifyURL, extraParams)
+	if err != nil {
+		return
+	}
+
+	kvs, err := GenKVpairs(payoutParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	rec := PayoutRecord{
+		OrderID: orderID,
+		TxnTime: params["txnTime"],
+		TxnAmt:  amount,
+		Status:  PayoutUnknown,
+	}
+	if up.payoutLedger != nil {
+		if err = up.payoutLedger.Reserve(rec); err != nil {
+			return
+		}
+	}
+
+	status = PayoutUnknown
+	var result PayoutResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		if e, ok := err.(*RespError); ok && !e.IsUnknown() {
+			status = PayoutFailed
+		}
+	} else {
+		// 同步应答00仅表示银联已受理,代付结果以通知或查询为准
+		status = PayoutProcessing
+		resp = &result
+	}
+
+	// 通知或查询可能已先于同步应答更新台账,以台账中的状态为准
+	stored, lerr := up.updatePayoutLedger(orderID, result.QueryID, status)
+	if lerr != nil {
+		if err == nil {
+			err = lerr
+		}
+		return
+	}
+	status = stored
+	return
+}
+
+func (up *UnionPay) initPayoutParams(cred *credentials, orderID string, amount Amount, accNo, notifyURL string, extraParams map[string]string) (params map[string]string, err error) {
+	params = make(map[string]string)
+
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "UTF-8"                       //编码方式
+	params["certId"] = cred.certID                     //证书id
+	params["signMethod"] = cred.signMethod()           //签名方法
+	params["txnType"] = "12"                           //交易类型
+	params["txnSubType"] = "00"                        //交易子类
+	params["bizType"] = "000401"                       //业务类型
+	params["channelType"] = "07"                       //渠道类型
+	params["merId"] = up.mchID                         //商户代码
+	params["backUrl"] = notifyURL                      //后台通知地址
+	params["orderId"] = orderID                        //商户订单号
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["txnTime"] = up.txnTime()                   //订单发送时间
+	params["txnAmt"] = amount.txnAmt()                 //交易金额，最小货币单位
+	params["accType"] = "01"                           //账号类型
+
+	if extraParams != nil {
+		for k, v := range extraParams {
+			_, ok := payoutParamMap[k]
+			if ok {
+				params[k] = v
+			}
+		}
+	}
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
+
+	params["accNo"], err = up.encryptData(cred, accNo) //账号
+	if err != nil {
+		return
+	}
+	params["encryptCertId"] = up.encryptCertID(cred) //加密证书id
+	return
+}
+
+type PayoutQueryResponse struct {
+	ConsumeQueryResponse
+}
+
+// Status 根据原交易应答码判断代付状态
+func (r *PayoutQueryResponse) Status() PayoutStatus {
+	return payoutStatus(r.OrigRespCode)
+}
+
+func payoutStatus(respCode string) PayoutStatus {
+	switch respCode {
+	case "00", "A6":
+		return PayoutSucceeded
+	case "03", "04", "05":
+		return PayoutProcessing
+	case "":
+		return PayoutUnknown
+	}
+	return PayoutFailed
+}
+
+// PayoutQuery 查询代付交易结果,设置了代付台账时同步更新台账状态
+// 查询应答34(交易不存在)且原交易所在清算日已日切时,银联不会再受理该交易,台账标记为PayoutFailed
+func (up *UnionPay) PayoutQuery(orderID, txnTime string) (resp *PayoutQueryResponse, err error) {
+	cred := up.creds()
+
+	kvs := KVpairs{}
+
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "00"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: "00"})
+	kvs = append(kvs, KVpair{K: "bizType", V: "000401"})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "orderId", V: orderID})
+	kvs = append(kvs, KVpair{K: "txnTime", V: txnTime})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + queryTrans)
+	if err != nil {
+		return
+	}
+
+	var result PayoutQueryResponse
+	err = up.client.PostForm(up.context(), u, data, &result.ConsumeQueryResponse)
+	if e, ok := err.(*RespError); ok && e.Code == "34" && up.pastSettleCutoff(txnTime) {
+		if _, lerr := up.updatePayoutLedger(orderID, "", PayoutFailed); lerr != nil {
+			err = lerr
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	resp = &result
+
+	_, err = up.updatePayoutLedger(orderID, resp.QueryID, resp.Status())
+	return
+}
+
+// pastSettleCutoff 订单发送时间所在清算日是否已日切,日切后查询不到的交易不会再被受理
+func (up *UnionPay) pastSettleCutoff(txnTime string) bool {
+	t, err := ParseTxnTime(txnTime)
+	if err != nil {
+		return false
+	}
+	return up.ExpectedSettleDate(t).Before(up.ExpectedSettleDate(up.now()))
+}
+
+// updatePayoutLedger 推进台账中的代付状态,不会覆盖最终状态,返回更新后台账中的状态
+func (up *UnionPay) updatePayoutLedger(orderID, queryID string, status PayoutStatus) (PayoutStatus, error) {
+	if up.payoutLedger == nil {
+		return status, nil
+	}
+
+	for {
+		rec, ok, err := up.payoutLedger.Get(orderID)
+		if err != nil {
+			return status, err
+		}
+		if !ok {
+			rec = PayoutRecord{OrderID: orderID}
+		}
+		if !rec.Status.advance(status) {
+			return rec.Status, nil
+		}
+
+		old := rec.Status
+		if queryID != "" {
+			rec.QueryID = queryID
+		}
+		rec.Status = status
+		swapped, err := up.payoutLedger.CompareAndSwap(old, rec)
+		if err != nil || swapped {
+			return status, err
+		}
+	}
+}
+
+type PayoutNotifyResponse struct {
+	Version            string
+	Encoding           string
+	CertID             string
+	Signature          string
+	SignMethod         string
+	TxnType            string
+	TxnSubType         string
+	BizType            string
+	AccessType         string
+	MerID              string
+	OrderID            string
+	TxnTime            string
+	CurrencyCode       string
+	TxnAmt             Amount // 交易金额，以币种的最小货币单位表示
+	AccNo              string
+	ReqReserved        string
+	Reserved           string
+	QueryID            string
+	TraceNo            string
+	TraceTime          string
+	SettleDate         string
+	SettleCurrencyCode string
+	SettleAmt          Amount
+	RespCode           string
+	RespMsg            string
+}
+
+// Status 根据通知应答码判断代付状态
+func (r *PayoutNotifyResponse) Status() PayoutStatus {
+	return payoutStatus(r.RespCode)
+}
+
+func (up *UnionPay) PayoutNotify(req *http.Request) (resp *PayoutNotifyResponse, err error) {
+	if err = req.ParseForm(); err != nil {
+		return
+	}
+	vals := req.Form
+
+	if len(vals) == 0 {
+		err = ErrNotifyDataIsEmpty
+		return
+	}
+
+	var fields = []string{
+		"version",
+		"encoding",
+		"certId",
+		"signature",
+		"signMethod",
+		"txnType",
+		"txnSubType",
+		"bizType",
+		"accessType",
+		"merId",
+		"orderId",
+		"txnTime",
+		"currencyCode",
+		"txnAmt",
+		"accNo",
+		"reqReserved",
+		"reserved",
+		"queryId",
+		"traceNo",
+		"traceTime",
+		"settleDate",
+		"settleCurrencyCode",
+		"settleAmt",
+		"respCode",
+		"respMsg",
+	}
+	if err = up.verifyNotify(vals, fields); err != nil {
+		return
+	}
+
+	txnAmt, settleAmt, err := notifyAmounts(vals)
+	if err != nil {
+		return
+	}
+
+	resp = &PayoutNotifyResponse{
+		Version:            vals.Get("version"),
+		Encoding:           vals.Get("encoding"),
+		CertID:             vals.Get("certId"),
+		Signature:          vals.Get("signature"),
+		SignMethod:         vals.Get("signMethod"),
+		TxnType:            vals.Get("txnType"),
+		TxnSubType:         vals.Get("txnSubType"),
+		BizType:            vals.Get("bizType"),
+		AccessType:         vals.Get("accessType"),
+		MerID:              vals.Get("merId"),
+		OrderID:            vals.Get("orderId"),
+		TxnTime:            vals.Get("txnTime"),
+		CurrencyCode:       vals.Get("currencyCode"),
+		TxnAmt:             txnAmt,
+		AccNo:              vals.Get("accNo"),
+		ReqReserved:        vals.Get("reqReserved"),
+		Reserved:           vals.Get("reserved"),
+		QueryID:            vals.Get("queryId"),
+		TraceNo:            vals.Get("traceNo"),
+		TraceTime:          vals.Get("traceTime"),
+		SettleDate:         vals.Get("settleDate"),
+		SettleCurrencyCode: vals.Get("settleCurrencyCode"),
+		SettleAmt:          settleAmt,
+		RespCode:           vals.Get("respCode"),
+		RespMsg:            vals.Get("respMsg"),
+	}
+
+	_, err = up.updatePayoutLedger(resp.OrderID, resp.QueryID, resp.Status())
+	return
+}
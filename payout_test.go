@@ -0,0 +1,171 @@
+package unionpay
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fixedClock 固定为北京时间txnTime YYYYMMDDHHmmss的时钟
+func fixedClock(t *testing.T, txnTime string) Clock {
+	t.Helper()
+
+	now, err := ParseTxnTime(txnTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ClockFunc(func() time.Time { return now })
+}
+
+func TestPayoutNotSent(t *testing.T) {
+	up := newTestPayment(t)
+	ledger := NewMemoryPayoutLedger()
+	up.SetPayoutLedger(ledger)
+
+	sent := 0
+	fakeGateway(up, func(form url.Values) map[string]string {
+		sent++
+		return respFields(form, "00")
+	})
+
+	_, status, err := up.Payout("PAY20240102001", Fen(0), "6216261000000000018", "https://example.com/notify", nil)
+	if err == nil || status != PayoutNotSent {
+		t.Fatalf("zero amount: status %s, err %v", status, err)
+	}
+
+	if err = ledger.Reserve(PayoutRecord{OrderID: "PAY20240102002", Status: PayoutSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+	_, status, err = up.Payout("PAY20240102002", Fen(100), "6216261000000000018", "https://example.com/notify", nil)
+	if err != ErrPayoutDuplicate || status != PayoutNotSent {
+		t.Fatalf("duplicate: status %s, err %v", status, err)
+	}
+	if sent != 0 {
+		t.Fatalf("%d requests sent", sent)
+	}
+}
+
+func TestPayoutStatus(t *testing.T) {
+	for _, c := range []struct {
+		respCode string
+		network  bool
+		want     PayoutStatus
+	}{
+		{respCode: "00", want: PayoutProcessing},
+		{respCode: "03", want: PayoutUnknown},
+		{respCode: "05", want: PayoutUnknown},
+		{respCode: "12", want: PayoutFailed},
+		{network: true, want: PayoutUnknown},
+	} {
+		up := newTestPayment(t)
+		ledger := NewMemoryPayoutLedger()
+		up.SetPayoutLedger(ledger)
+		fakeGateway(up, func(form url.Values) map[string]string {
+			if c.network {
+				return nil
+			}
+			return respFields(form, c.respCode)
+		})
+
+		_, status, _ := up.Payout("PAY20240102001", Fen(100), "6216261000000000018", "https://example.com/notify", nil)
+		if status != c.want {
+			t.Errorf("respCode %q network %v: status %s, want %s", c.respCode, c.network, status, c.want)
+		}
+		rec, ok, _ := ledger.Get("PAY20240102001")
+		if !ok || rec.Status != c.want {
+			t.Errorf("respCode %q network %v: ledger %+v", c.respCode, c.network, rec)
+		}
+	}
+}
+
+func TestPayoutQueryNotFound(t *testing.T) {
+	for _, c := range []struct {
+		now  string
+		want PayoutStatus
+	}{
+		{now: "20240102150000", want: PayoutUnknown}, // 同一清算日
+		{now: "20240103150000", want: PayoutFailed},  // 已日切
+	} {
+		up := newTestPayment(t).SetClock(fixedClock(t, c.now))
+		ledger := NewMemoryPayoutLedger()
+		up.SetPayoutLedger(ledger)
+		ledger.Reserve(PayoutRecord{OrderID: "PAY20240102001", TxnTime: "20240102140000", Status: PayoutUnknown})
+
+		fakeGateway(up, func(form url.Values) map[string]string {
+			return respFields(form, "34")
+		})
+
+		if _, err := up.PayoutQuery("PAY20240102001", "20240102140000"); err == nil {
+			t.Fatalf("now %s: want error", c.now)
+		}
+		rec, _, _ := ledger.Get("PAY20240102001")
+		if rec.Status != c.want {
+			t.Errorf("now %s: ledger status %s, want %s", c.now, rec.Status, c.want)
+		}
+	}
+}
+
+func TestPayoutNotifyBeforeSyncResponse(t *testing.T) {
+	for _, respCode := range []string{"00", "03"} {
+		up := newTestPayment(t)
+		ledger := NewMemoryPayoutLedger()
+		up.SetPayoutLedger(ledger)
+
+		// 同步应答返回前,代付结果通知已在另一个goroutine中处理完毕
+		fakeGateway(up, func(form url.Values) map[string]string {
+			vals := url.Values{}
+			for _, k := range []string{"version", "encoding", "certId", "signMethod", "txnType", "txnSubType", "bizType", "accessType", "merId", "orderId", "txnTime", "currencyCode", "txnAmt"} {
+				vals.Set(k, form.Get(k))
+			}
+			vals.Set("queryId", "202401021400001234567")
+			vals.Set("respCode", "00")
+			vals.Set("respMsg", "success")
+
+			req := signedNotify(t, up, vals)
+			done := make(chan error)
+			go func() {
+				_, err := up.PayoutNotify(req)
+				done <- err
+			}()
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+			return respFields(form, respCode)
+		})
+
+		_, status, _ := up.Payout("PAY20240102001", Fen(100), "6216261000000000018", "https://example.com/notify", nil)
+		if status != PayoutSucceeded {
+			t.Errorf("respCode %s: status %s, want %s", respCode, status, PayoutSucceeded)
+		}
+		rec, _, _ := ledger.Get("PAY20240102001")
+		if rec.Status != PayoutSucceeded || rec.QueryID != "202401021400001234567" {
+			t.Errorf("respCode %s: ledger %+v", respCode, rec)
+		}
+	}
+}
+
+func TestPayoutLedgerNoDowngrade(t *testing.T) {
+	for _, c := range []struct {
+		from, to, want PayoutStatus
+	}{
+		{from: PayoutUnknown, to: PayoutProcessing, want: PayoutProcessing},
+		{from: PayoutProcessing, to: PayoutUnknown, want: PayoutProcessing},
+		{from: PayoutProcessing, to: PayoutFailed, want: PayoutFailed},
+		{from: PayoutSucceeded, to: PayoutFailed, want: PayoutSucceeded},
+		{from: PayoutFailed, to: PayoutProcessing, want: PayoutFailed},
+	} {
+		up := newTestPayment(t)
+		ledger := NewMemoryPayoutLedger()
+		up.SetPayoutLedger(ledger)
+		ledger.Reserve(PayoutRecord{OrderID: "PAY20240102001", Status: c.from})
+
+		got, err := up.updatePayoutLedger("PAY20240102001", "", c.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, _, _ := ledger.Get("PAY20240102001")
+		if got != c.want || rec.Status != c.want {
+			t.Errorf("%s -> %s: got %s, ledger %s, want %s", c.from, c.to, got, rec.Status, c.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package unionpay
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var ErrBadQrCode = errors.New("bad qr code")
+
+var applyQrCodeParamMap = map[string]bool{
+	"version":      true,  // 版本号 固定填写5.0.0
+	"encoding":     true,  // 编码方式 默认值 UTF-8
+	"certId":       true,  // 证书id
+	"signature":    true,  // 签名 填写对报文摘要的签名
+	"signMethod":   true,  // 签名方式 取值：01 表示采用的是RSA
+	"txnType":      true,  // 交易类型 取值：01
+	"txnSubType":   true,  // 交易子类 取值：07 申请消费二维码
+	"bizType":      true,  // 产品类型 000000
+	"channelType":  true,  // 渠道类型 08:移动
+	"backUrl":      true,  // 后台通知地址
+	"accessType":   true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
+	"merId":        true,  // 商户代码
+	"acqInsCode":   false, // 收单机构代码 收单机构接入时必须上送
+	"orderId":      true,  // 商户订单号 商户端生成
+	"txnTime":      true,  // 订单发送时间 商户发送交易时间
+	"txnAmt":       false, // 交易金额 单位为分 不上送时由持卡人输入金额
+	"currencyCode": true,  // 交易币种 默认为156
+	"termId":       false, // 终端号
+	"payTimeout":   false, // 订单支付超时时间
+	"reqReserved":  false, // 请求方保留域 商户自定义保留域，交易应答时会原样返回
+	"reserved":     false, // 保留域
+	"riskRateInfo": false, // 风险信息域
+	"orderDesc":    false, // 订单描述
+	"subMerId":     false, // 二级商户代码 商户类型为平台商户接入时必须上送
+	"subMerName":   false, // 二级商户全称 商户类型为平台商户接入时必须上送
+	"subMerAbbr":   false, // 二级商户简称 商户类型为平台商户接入时必须上送
+}
+
+type ApplyQrCodeResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	OrderID     string
+	TxnTime     string
+	TxnAmt      Amount
+	ReqReserved string
+	Reserved    string
+	QrCode      string // 二维码 银联返回的二维码内容,商户据此生成二维码图片
+	RespCode    string
+	RespMsg     string
+}
+
+// ApplyQrCode 申请主扫(C2B)消费二维码,amount为零值时生成不固定金额的二维码,由持卡人输入金额
+func (up *UnionPay) ApplyQrCode(orderID string, amount Amount, notifyURL string, extraParams map[string]string) (resp *ApplyQrCodeResponse, err error) {
+	cred := up.creds()
+
+	if !amount.IsZero() {
+		if err = amount.Validate(); err != nil {
+			return
+		}
+	}
+
+	params := up.initApplyQrCodeParams(cred, orderID, amount, notifyURL, extraParams)
+	kvs, err := GenKVpairs(applyQrCodeParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	var result ApplyQrCodeResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
+
+func (up *UnionPay) initApplyQrCodeParams(cred *credentials, orderID string, amount Amount, notifyURL string, extraParams map[string]string) (params map[string]string) {
+	params = make(map[string]string)
+
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "UTF-8"                       //编码方式
+	params["certId"] = cred.certID                     //证书id
+	params["signMethod"] = cred.signMethod()           //签名方法
+	params["txnType"] = "01"                           //交易类型
+	params["txnSubType"] = "07"                        //交易子类
+	params["bizType"] = "000000"                       //业务类型
+	params["channelType"] = "08"                       //渠道类型
+	params["merId"] = up.mchID                         //商户代码
+	params["backUrl"] = notifyURL                      //后台通知地址
+	params["orderId"] = orderID                        //商户订单号
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["txnTime"] = up.txnTime()                   //订单发送时间
+	if !amount.IsZero() {
+		params["txnAmt"] = amount.txnAmt() //交易金额，最小货币单位
+	}
+
+	if extraParams != nil {
+		for k, v := range extraParams {
+			_, ok := applyQrCodeParamMap[k]
+			if ok {
+				params[k] = v
+			}
+		}
+	}
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
+	return
+}
+
+// QrCode 银联二维码,形如 https://qr.95516.com/00010000/01xxxxxxxxxxxx
+type QrCode struct {
+	Content string // 二维码原始内容
+	Host    string // 二维码域名
+	ID      string // 二维码标识
+}
+
+// ParseQrCode 解析申请二维码返回的qrCode
+func ParseQrCode(content string) (qr *QrCode, err error) {
+	u, err := url.Parse(content)
+	if err != nil {
+		return
+	}
+
+	path := strings.Trim(u.Path, "/")
+	if u.Host == "" || path == "" {
+		err = ErrBadQrCode
+		return
+	}
+
+	qr = &QrCode{
+		Content: content,
+		Host:    u.Host,
+		ID:      path[strings.LastIndex(path, "/")+1:],
+	}
+	return
+}
+
+// QrCodeNotifyResponse 二维码消费通知,在消费通知的基础上增加二维码相关域
+type QrCodeNotifyResponse struct {
+	FrontConsumeNotifyResponse
+	TermID             string // 终端号
+	CouponInfo         string // 优惠信息
+	IssuerIdentifyMode string // 发卡机构识别模式
+	PayerInfo          string // 付款方信息
+}
+
+// qrCodeNotifyFields 二维码消费通知参与验签的域
+var qrCodeNotifyFields = []string{
+	"version",
+	"encoding",
+	"certId",
+	"signature",
+	"signMethod",
+	"txnType",
+	"txnSubType",
+	"bizType",
+	"accessType",
+	"merId",
+	"orderId",
+	"txnTime",
+	"txnAmt",
+	"currencyCode",
+	"reqReserved",
+	"reserved",
+	"queryId",
+	"respCode",
+	"respMsg",
+	"settleAmt",
+	"settleCurrencyCode",
+	"settleDate",
+	"traceNo",
+	"traceTime",
+	"exchangeDate",
+	"exchangeRate",
+	"accNo",
+	"payCardType",
+	"payType",
+	"payCardNo",
+	"payCardIssueName",
+	"termId",
+	"couponInfo",
+	"issuerIdentifyMode",
+	"payerInfo",
+}
+
+// QrCodeNotify 二维码消费通知
+func (up *UnionPay) QrCodeNotify(req *http.Request) (resp *QrCodeNotifyResponse, err error) {
+	if err = req.ParseForm(); err != nil {
+		return
+	}
+	vals := req.Form
+
+	if len(vals) == 0 {
+		err = ErrNotifyDataIsEmpty
+		return
+	}
+
+	if err = up.verifyNotify(vals, qrCodeNotifyFields); err != nil {
+		return
+	}
+
+	consume, err := newFrontConsumeNotifyResponse(vals)
+	if err != nil {
+		return
+	}
+
+	resp = &QrCodeNotifyResponse{
+		FrontConsumeNotifyResponse: *consume,
+		TermID:                     vals.Get("termId"),
+		CouponInfo:                 vals.Get("couponInfo"),
+		IssuerIdentifyMode:         vals.Get("issuerIdentifyMode"),
+		PayerInfo:                  vals.Get("payerInfo"),
+	}
+	return
+}
+
+// QrCodeQuery 查询二维码消费订单
+func (up *UnionPay) QrCodeQuery(orderID, txnTime string) (resp *ConsumeQueryResponse, err error) {
+	return up.ConsumeQuery(orderID, "", txnTime, "")
+}
+
+// QrCodeRefund 二维码消费退货,bizType为000000
+func (up *UnionPay) QrCodeRefund(orderID, returnURL string, amount Amount, originQueryID, reqReserved, reserved string) (resp *ConsumeRefundResponse, err error) {
+	return up.consumeRefund("000000", orderID, up.txnTime(), returnURL, amount, originQueryID, reqReserved, reserved)
+}
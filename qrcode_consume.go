@@ -0,0 +1,336 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var (
+	// 被扫消费结果未明时查询原交易的次数及间隔,超过次数仍未明则发起冲正
+	qrCodeQueryTimes    = 6
+	qrCodeQueryInterval = 5 * time.Second
+	// 冲正结果未明时重发冲正的次数及间隔,银联要求重复冲正直至获得明确结果
+	qrCodeReversalTimes    = 6
+	qrCodeReversalInterval = 5 * time.Second
+)
+
+var (
+	ErrReversalRejected = errors.New("reversal rejected")
+	ErrReversalUnknown  = errors.New("reversal result is unknown, query the original order before resending")
+)
+
+var qrCodeConsumeParamMap = map[string]bool{
+	"version":      true,  // 版本号 固定填写5.0.0
+	"encoding":     true,  // 编码方式 默认值 UTF-8
+	"certId":       true,  // 证书id
+	"signature":    true,  // 签名 填写对报文摘要的签名
+	"signMethod":   true,  // 签名方式 取值：01 表示采用的是RSA
+	"txnType":      true,  // 交易类型 取值：01
+	"txnSubType":   true,  // 交易子类 取值：06 被扫消费
+	"bizType":      true,  // 产品类型 000000
+	"channelType":  true,  // 渠道类型 08:移动
+	"backUrl":      true,  // 后台通知地址
+	"accessType":   true,  // 接入类型 0:普通商户直接接入 2:平台类商户接入
+	"merId":        true,  // 商户代码
+	"acqInsCode":   false, // 收单机构代码 收单机构接入时必须上送
+	"orderId":      true,  // 商户订单号 商户端生成
+	"txnTime":      true,  // 订单发送时间 商户发送交易时间
+	"txnAmt":       true,  // 交易金额 单位为分
+	"currencyCode": true,  // 交易币种 默认为156
+	"qrNo":         true,  // C2B码 持卡人付款码
+	"termId":       true,  // 终端号
+	"termInfo":     false, // 终端信息
+	"reqReserved":  false, // 请求方保留域 商户自定义保留域，交易应答时会原样返回
+	"reserved":     false, // 保留域
+	"riskRateInfo": false, // 风险信息域
+	"orderDesc":    false, // 订单描述
+	"subMerId":     false, // 二级商户代码 商户类型为平台商户接入时必须上送
+	"subMerName":   false, // 二级商户全称 商户类型为平台商户接入时必须上送
+	"subMerAbbr":   false, // 二级商户简称 商户类型为平台商户接入时必须上送
+}
+
+// QrCodeConsumeStatus 被扫消费最终状态
+type QrCodeConsumeStatus int
+
+const (
+	QrCodeConsumeFailed    QrCodeConsumeStatus = iota // 消费失败,持卡人未扣款
+	QrCodeConsumeSucceeded                            // 消费成功
+	QrCodeConsumeReversed                             // 结果未明,已冲正
+	QrCodeConsumeUnknown                              // 结果未明且冲正未获得明确结果,需继续调用Reversal直至成功
+)
+
+func (s QrCodeConsumeStatus) String() string {
+	switch s {
+	case QrCodeConsumeSucceeded:
+		return "succeeded"
+	case QrCodeConsumeReversed:
+		return "reversed"
+	case QrCodeConsumeUnknown:
+		return "unknown"
+	}
+	return "failed"
+}
+
+type QrCodeConsumeResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	OrderID     string
+	TxnTime     string
+	TxnAmt      Amount
+	ReqReserved string
+	Reserved    string
+	QueryID     string
+	RespCode    string
+	RespMsg     string
+}
+
+// QrCodeConsumeResult 被扫消费结果,Status为最终状态
+type QrCodeConsumeResult struct {
+	Status   QrCodeConsumeStatus
+	OrderID  string
+	TxnTime  string
+	QueryID  string
+	RespCode string
+	RespMsg  string
+
+	Response *QrCodeConsumeResponse // 消费同步应答,结果未明时为nil
+	Query    *ConsumeQueryResponse  // 结果未明时最后一次查询结果
+	Reversal *ReversalResponse      // 冲正应答
+}
+
+// QrCodeConsume 被扫消费,扫描持卡人付款码qrNo发起扣款
+// 应答码为03,04,05或网络异常时轮询查询原交易,仍未明则冲正,冲正结果未明时重复冲正直至获得明确结果
+// 请求未能发出时返回错误且result为nil;冲正被拒绝,重复冲正达到次数上限或WithContext设置的ctx结束时返回错误,
+// 此时Status为QrCodeConsumeUnknown,需以result中的OrderID及TxnTime查询原交易后再决定是否调用Reversal
+func (up *UnionPay) QrCodeConsume(orderID string, amount Amount, qrNo, termID, notifyURL string, extraParams map[string]string) (result *QrCodeConsumeResult, err error) {
+	cred := up.creds()
+
+	if err = amount.Validate(); err != nil {
+		return
+	}
+
+	params := up.initQrCodeConsumeParams(cred, orderID, amount, qrNo, termID, notifyURL, extraParams)
+	kvs, err := GenKVpairs(qrCodeConsumeParamMap, params, "signature")
+	if err != nil {
+		return
+	}
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	result = &QrCodeConsumeResult{
+		OrderID: orderID,
+		TxnTime: params["txnTime"],
+	}
+
+	var resp QrCodeConsumeResponse
+	perr := up.client.PostForm(up.context(), u, data, &resp)
+	if perr == nil {
+		result.Status = QrCodeConsumeSucceeded
+		result.Response = &resp
+		result.QueryID = resp.QueryID
+		result.RespCode = resp.RespCode
+		result.RespMsg = resp.RespMsg
+		return
+	}
+
+	if e, ok := perr.(*RespError); ok && !e.IsUnknown() {
+		result.Status = QrCodeConsumeFailed
+		result.RespCode = e.Code
+		result.RespMsg = e.Msg
+		return
+	}
+
+	err = up.settleUnknownQrCodeConsume(result)
+	return
+}
+
+// settleUnknownQrCodeConsume 查询结果未明的被扫消费,仍未明则冲正
+func (up *UnionPay) settleUnknownQrCodeConsume(result *QrCodeConsumeResult) (err error) {
+	ctx := up.context()
+	result.Status = QrCodeConsumeUnknown
+
+	for i := 0; i < qrCodeQueryTimes; i++ {
+		if err = sleepContext(ctx, qrCodeQueryInterval); err != nil {
+			return fmt.Errorf("[unionpay] order %s is unknown, reverse it: %s", result.OrderID, err)
+		}
+
+		q, qerr := up.ConsumeQuery(result.OrderID, "", result.TxnTime, "")
+		if qerr != nil {
+			continue
+		}
+		result.Query = q
+
+		switch q.OrigRespCode {
+		case "00", "A6":
+			result.Status = QrCodeConsumeSucceeded
+			result.QueryID = q.QueryID
+			result.RespCode = q.OrigRespCode
+			result.RespMsg = q.OrigRespMsg
+			return
+		case "03", "04", "05":
+			continue
+		default:
+			result.Status = QrCodeConsumeFailed
+			result.RespCode = q.OrigRespCode
+			result.RespMsg = q.OrigRespMsg
+			return
+		}
+	}
+
+	return up.reverseUntilSettled(result)
+}
+
+// reverseUntilSettled 重复冲正直至应答为00或明确失败,最多qrCodeReversalTimes次
+func (up *UnionPay) reverseUntilSettled(result *QrCodeConsumeResult) (err error) {
+	ctx := up.context()
+	for i := 0; i < qrCodeReversalTimes; i++ {
+		if i > 0 {
+			if err = sleepContext(ctx, qrCodeReversalInterval); err != nil {
+				return fmt.Errorf("[unionpay] reversal order %s is unknown, resend it: %s", result.OrderID, err)
+			}
+		}
+
+		resp, rerr := up.Reversal(result.OrderID, result.TxnTime)
+		if rerr == nil {
+			result.Reversal = resp
+			result.Status = QrCodeConsumeReversed
+			result.RespCode = resp.RespCode
+			result.RespMsg = resp.RespMsg
+			return nil
+		}
+
+		if e, ok := rerr.(*RespError); ok && !e.IsUnknown() {
+			result.RespCode = e.Code
+			result.RespMsg = e.Msg
+			return fmt.Errorf("[unionpay] %w: order %s %s %s", ErrReversalRejected, result.OrderID, e.Code, e.Msg)
+		}
+	}
+	return fmt.Errorf("[unionpay] %w: order %s txnTime %s", ErrReversalUnknown, result.OrderID, result.TxnTime)
+}
+
+func (up *UnionPay) initQrCodeConsumeParams(cred *credentials, orderID string, amount Amount, qrNo, termID, notifyURL string, extraParams map[string]string) (params map[string]string) {
+	params = make(map[string]string)
+
+	params["version"] = cred.version()                 //版本号
+	params["encoding"] = "UTF-8"                       //编码方式
+	params["certId"] = cred.certID                     //证书id
+	params["signMethod"] = cred.signMethod()           //签名方法
+	params["txnType"] = "01"                           //交易类型
+	params["txnSubType"] = "06"                        //交易子类
+	params["bizType"] = "000000"                       //业务类型
+	params["channelType"] = "08"                       //渠道类型
+	params["merId"] = up.mchID                         //商户代码
+	params["backUrl"] = notifyURL                      //后台通知地址
+	params["orderId"] = orderID                        //商户订单号
+	params["currencyCode"] = up.currencyCodeOf(amount) //交易币种
+	params["txnTime"] = up.txnTime()                   //订单发送时间
+	params["txnAmt"] = amount.txnAmt()                 //交易金额，最小货币单位
+	params["qrNo"] = qrNo                              //C2B码
+	params["termId"] = termID                          //终端号
+
+	if extraParams != nil {
+		for k, v := range extraParams {
+			_, ok := qrCodeConsumeParamMap[k]
+			if ok {
+				params[k] = v
+			}
+		}
+	}
+
+	up.access.setParams(params) //接入类型及二级商户信息,覆盖extraParams中的同名域
+	return
+}
+
+type ReversalResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	OrderID     string
+	TxnTime     string
+	ReqReserved string
+	Reserved    string
+	RespCode    string
+	RespMsg     string
+}
+
+// Reversal 冲正(txnType 99),撤销结果未明的被扫消费,orderID及txnTime为原交易的订单号及订单发送时间
+func (up *UnionPay) Reversal(orderID, txnTime string) (resp *ReversalResponse, err error) {
+	cred := up.creds()
+
+	kvs := KVpairs{}
+
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "99"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: "01"})
+	kvs = append(kvs, KVpair{K: "bizType", V: "000000"})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "channelType", V: "08"})
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "orderId", V: orderID})
+	kvs = append(kvs, KVpair{K: "txnTime", V: txnTime})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getHost() + backTransReq)
+	if err != nil {
+		return
+	}
+
+	var result ReversalResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
@@ -0,0 +1,99 @@
+package unionpay
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func fastQrCodePolling(t *testing.T) {
+	times, query, reversalTimes, reversal := qrCodeQueryTimes, qrCodeQueryInterval, qrCodeReversalTimes, qrCodeReversalInterval
+	qrCodeQueryTimes, qrCodeQueryInterval, qrCodeReversalTimes, qrCodeReversalInterval = 2, time.Millisecond, 4, time.Millisecond
+	t.Cleanup(func() {
+		qrCodeQueryTimes, qrCodeQueryInterval, qrCodeReversalTimes, qrCodeReversalInterval = times, query, reversalTimes, reversal
+	})
+}
+
+// qrCodeGateway 被扫消费应答05,查询原交易始终处理中,冲正按reversals依次应答
+func qrCodeGateway(t *testing.T, up *UnionPay, reversals ...string) *int {
+	sent := 0
+	fakeGateway(up, func(form url.Values) map[string]string {
+		switch form.Get("txnType") {
+		case "01":
+			return respFields(form, "05")
+		case "00":
+			return respFields(form, "00", "origRespCode", "05")
+		case "99":
+			code := reversals[len(reversals)-1]
+			if sent < len(reversals) {
+				code = reversals[sent]
+			}
+			sent++
+			if code == "" {
+				return nil
+			}
+			return respFields(form, code)
+		}
+		t.Fatalf("unexpected txnType %s", form.Get("txnType"))
+		return nil
+	})
+	return &sent
+}
+
+func TestQrCodeConsumeRetriesReversal(t *testing.T) {
+	fastQrCodePolling(t)
+	up := newTestPayment(t)
+	sent := qrCodeGateway(t, up, "", "04", "00")
+
+	result, err := up.QrCodeConsume("QR2024010200001", Fen(100), "6220000000000000000", "T0000001", "https://example.com/notify", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != QrCodeConsumeReversed || *sent != 3 {
+		t.Errorf("status %s after %d reversals", result.Status, *sent)
+	}
+}
+
+func TestQrCodeConsumeReversalRejected(t *testing.T) {
+	fastQrCodePolling(t)
+	up := newTestPayment(t)
+	qrCodeGateway(t, up, "12")
+
+	result, err := up.QrCodeConsume("QR2024010200001", Fen(100), "6220000000000000000", "T0000001", "https://example.com/notify", nil)
+	if !errors.Is(err, ErrReversalRejected) || result.Status != QrCodeConsumeUnknown || result.RespCode != "12" {
+		t.Errorf("status %s respCode %s err %v", result.Status, result.RespCode, err)
+	}
+}
+
+func TestQrCodeConsumeContextDone(t *testing.T) {
+	fastQrCodePolling(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	up := newTestPayment(t)
+	qrCodeGateway(t, up, "")
+
+	result, err := up.WithContext(ctx).QrCodeConsume("QR2024010200001", Fen(100), "6220000000000000000", "T0000001", "https://example.com/notify", nil)
+	if err == nil || result.Status != QrCodeConsumeUnknown {
+		t.Errorf("status %s err %v", result.Status, err)
+	}
+}
+
+func TestQrCodeConsumeReversalAttemptsExhausted(t *testing.T) {
+	fastQrCodePolling(t)
+	up := newTestPayment(t)
+	sent := qrCodeGateway(t, up, "", "04")
+
+	result, err := up.QrCodeConsume("QR2024010200001", Fen(100), "6220000000000000000", "T0000001", "https://example.com/notify", nil)
+	if !errors.Is(err, ErrReversalUnknown) {
+		t.Fatalf("err %v", err)
+	}
+	if result.Status != QrCodeConsumeUnknown || *sent != qrCodeReversalTimes {
+		t.Errorf("status %s after %d reversals", result.Status, *sent)
+	}
+	if result.OrderID != "QR2024010200001" || len(result.TxnTime) != 14 {
+		t.Errorf("result %+v lacks the original order", result)
+	}
+}
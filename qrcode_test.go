@@ -0,0 +1,59 @@
+package unionpay
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestQrCodeNotify(t *testing.T) {
+	up := newTestPayment(t)
+
+	vals := url.Values{}
+	vals.Set("version", "5.0.0")
+	vals.Set("encoding", "UTF-8")
+	vals.Set("certId", up.creds().certID)
+	vals.Set("signMethod", "01")
+	vals.Set("txnType", "01")
+	vals.Set("txnSubType", "07")
+	vals.Set("bizType", "000000")
+	vals.Set("accessType", "0")
+	vals.Set("merId", "700000000000001")
+	vals.Set("orderId", "QR2024010200001")
+	vals.Set("txnTime", "20240102140000")
+	vals.Set("txnAmt", "1000")
+	vals.Set("currencyCode", "156")
+	vals.Set("queryId", "202401021400001234567")
+	vals.Set("respCode", "00")
+	vals.Set("respMsg", "success")
+	vals.Set("termId", "T0000001")
+	vals.Set("couponInfo", "{spnsrId=00010000&type=DD01&offstAmt=100}")
+
+	resp, err := up.QrCodeNotify(signedNotify(t, up, vals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TermID != "T0000001" || resp.CouponInfo == "" || resp.TxnAmt != Fen(1000) || resp.QueryID != "202401021400001234567" {
+		t.Errorf("unexpected notify %+v", resp)
+	}
+
+	// 消费通知的验签域不含二维码相关域,签名覆盖这些域时验签失败
+	if _, err = up.FrontConsumeNotify(signedNotify(t, up, vals)); err == nil {
+		t.Error("FrontConsumeNotify accepted qr fields outside its whitelist")
+	}
+}
+
+func TestParseQrCode(t *testing.T) {
+	qr, err := ParseQrCode("https://qr.95516.com/00010000/01234567890123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qr.Host != "qr.95516.com" || qr.ID != "01234567890123456789" {
+		t.Errorf("got %+v", qr)
+	}
+
+	for _, bad := range []string{"", "qr.95516.com", "https://qr.95516.com/"} {
+		if _, err = ParseQrCode(bad); err == nil {
+			t.Errorf("%q: want error", bad)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Package qrpng 将银联二维码渲染为PNG图片,仅需展示二维码图片时引入
+package qrpng
+
+import (
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/shima-park/unionpay"
+)
+
+// Encode 生成二维码图片,用于收银台展示,size为图片边长(像素)
+func Encode(qr *unionpay.QrCode, size int) ([]byte, error) {
+	return qrcode.Encode(qr.Content, qrcode.Medium, size)
+}
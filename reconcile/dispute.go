@@ -0,0 +1,305 @@
+package reconcile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+// errorFileLayout 差错流水文件(ZME)各域的字节长度,域之间以一个空格分隔
+var errorFileLayout = []int{
+	3,   // 交易代码
+	11,  // 代理机构标识码
+	11,  // 发送机构标识码
+	6,   // 系统跟踪号
+	10,  // 交易传输时间
+	19,  // 帐号
+	12,  // 交易金额
+	4,   // 商户类别
+	2,   // 终端类型
+	2,   // 支付方式
+	6,   // 原始交易的系统跟踪号
+	10,  // 原始交易日期时间
+	4,   // 差错原因
+	12,  // 原交易金额
+	13,  // 商户手续费
+	13,  // 清算净额
+	15,  // 商户代码
+	15,  // 二级商户代码
+	1,   // 交易介质
+	12,  // 差错费用
+	2,   // 保留
+	21,  // 原始交易查询流水号
+	113, // 保留
+}
+
+// disputeFileMarkers 差错流水文件名中的标识,其它差错类文件(如退单)可由PackageDisputes的markers指定
+var disputeFileMarkers = []string{"ZME_"}
+
+// DisputeType 差错交易类型
+type DisputeType string
+
+const (
+	DisputeRetrieval        DisputeType = "retrieval"         // 调单 需提供交易凭证
+	DisputeChargeback       DisputeType = "chargeback"        // 退单 发卡行要求退回资金,可提出再请款
+	DisputeRepresentment    DisputeType = "representment"     // 再请款
+	DisputeSecondChargeback DisputeType = "second_chargeback" // 二次退单 可申请仲裁
+	DisputeCreditAdjustment DisputeType = "credit_adjustment" // 贷记调整
+	DisputeArbitration      DisputeType = "arbitration"       // 仲裁
+	DisputeOther            DisputeType = "other"
+)
+
+// disputeTypes 差错交易代码与差错类型的对应关系
+// 见《中国银联全渠道支付平台商户接入接口规范 第3部分 文件接口》差错交易流水文件的交易代码说明,未列出的代码为DisputeOther
+var disputeTypes = map[string]DisputeType{
+	"E22": DisputeCreditAdjustment,
+	"E23": DisputeChargeback,
+	"E24": DisputeRepresentment,
+	"E25": DisputeSecondChargeback,
+	"E30": DisputeRetrieval,
+	"E33": DisputeArbitration,
+}
+
+// DisputeTypeOf 差错交易代码对应的差错类型
+func DisputeTypeOf(txnCode string) DisputeType {
+	if t, ok := disputeTypes[txnCode]; ok {
+		return t
+	}
+	return DisputeOther
+}
+
+// NeedsResponse 商户是否需要在期限内回复,调单需提供凭证,退单及二次退单需决定是否申诉
+func (t DisputeType) NeedsResponse() bool {
+	switch t {
+	case DisputeRetrieval, DisputeChargeback, DisputeSecondChargeback:
+		return true
+	}
+	return false
+}
+
+// DisputeRecord 差错流水文件中的一笔差错交易
+type DisputeRecord struct {
+	SettleDate    time.Time
+	TxnCode       string // 差错交易代码
+	Type          DisputeType
+	AcqInsCode    string
+	FwdInsCode    string
+	TraceNo       string
+	TraceTime     string
+	AccNo         string          // 帐号 已脱敏
+	TxnAmt        unionpay.Amount // 差错金额
+	OrigTraceNo   string          // 原交易系统跟踪号
+	OrigTraceTime string          // 原交易传输时间 MMDDhhmmss
+	ReasonCode    string          // 差错原因码
+	OrigTxnAmt    unionpay.Amount
+	Fee           unionpay.Amount // 商户手续费 借记商户为正
+	NetAmt        unionpay.Amount // 清算净额 贷记商户为正
+	MerID         string
+	SubMerID      string
+	OrigQueryID   string   // 原交易查询流水号 文件中为空时由Link按关联到的原交易补充
+	Fields        []string // 全部域原文,按errorFileLayout顺序
+
+	Original *SettlementRecord // 关联的原交易对账记录,Link后设置
+	Local    *Txn              // 关联的本地原交易,Link后设置
+}
+
+// NeedsResponse 商户是否需要回复
+func (d *DisputeRecord) NeedsResponse() bool {
+	return d.Type.NeedsResponse()
+}
+
+// OrigOrderID 原交易商户订单号,未关联到原交易时为空
+func (d *DisputeRecord) OrigOrderID() string {
+	if d.Original != nil {
+		return d.Original.OrderID
+	}
+	if d.Local != nil {
+		return d.Local.OrderID
+	}
+	return ""
+}
+
+// PackageDisputes 解析对账文件压缩包中的差错流水文件,markers为其它同格式差错类文件(如退单文件)文件名中的标识
+func PackageDisputes(pkg *unionpay.SettlementPackage, markers ...string) (disputes []DisputeRecord, err error) {
+	markers = append(markers, disputeFileMarkers...)
+	for _, f := range pkg.Files {
+		if !hasMarker(f.Name, markers) {
+			continue
+		}
+
+		var ds []DisputeRecord
+		if ds, err = ParseErrorFile(bytes.NewReader(f.Data), pkg.SettleDate); err != nil {
+			err = fmt.Errorf("%s: %w", f.Name, err)
+			return
+		}
+		disputes = append(disputes, ds...)
+	}
+	return
+}
+
+func hasMarker(name string, markers []string) bool {
+	for _, m := range markers {
+		if m != "" && strings.Contains(name, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseErrorFile 解析差错流水文件(ZME),文件为GBK编码的定长文本
+func ParseErrorFile(r io.Reader, settleDate time.Time) (disputes []DisputeRecord, err error) {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var d DisputeRecord
+		if d, err = parseErrorLine(line); err != nil {
+			err = fmt.Errorf("line %d: %w", n, err)
+			return
+		}
+		d.SettleDate = settleDate
+		disputes = append(disputes, d)
+	}
+	err = sc.Err()
+	return
+}
+
+func parseErrorLine(line string) (d DisputeRecord, err error) {
+	f := splitFixed(line, errorFileLayout)
+
+	d = DisputeRecord{
+		TxnCode:       f[0],
+		AcqInsCode:    f[1],
+		FwdInsCode:    f[2],
+		TraceNo:       f[3],
+		TraceTime:     f[4],
+		AccNo:         f[5],
+		OrigTraceNo:   f[10],
+		OrigTraceTime: f[11],
+		ReasonCode:    f[12],
+		MerID:         f[16],
+		SubMerID:      f[17],
+		OrigQueryID:   f[21],
+		Fields:        f,
+		Type:          DisputeTypeOf(f[0]),
+	}
+
+	if d.TxnAmt, err = parseFileAmount(f[6]); err != nil {
+		err = fmt.Errorf("bad txnAmt: %w", err)
+		return
+	}
+	if d.OrigTxnAmt, err = parseFileAmount(f[13]); err != nil {
+		err = fmt.Errorf("bad origTxnAmt: %w", err)
+		return
+	}
+	var fee int64
+	if fee, err = parseSignedAmount(f[14]); err != nil {
+		err = fmt.Errorf("bad fee: %w", err)
+		return
+	}
+	d.Fee = unionpay.Fen(-fee)
+	if d.NetAmt, err = parseSignedFen(f[15]); err != nil {
+		err = fmt.Errorf("bad netAmt: %w", err)
+		return
+	}
+	return
+}
+
+// NeedingResponse 需要商户回复的差错交易
+func NeedingResponse(disputes []DisputeRecord) []*DisputeRecord {
+	var ds []*DisputeRecord
+	for i := range disputes {
+		if disputes[i].NeedsResponse() {
+			ds = append(ds, &disputes[i])
+		}
+	}
+	return ds
+}
+
+// Linker 关联差错交易与原交易,优先按原交易查询流水号,其次按商户代码,代理机构标识码,系统跟踪号及交易传输时间
+// 原交易可能在此前任一清算日,应加入足够天数的对账记录或本地交易
+type Linker struct {
+	recordsByQuery map[string]*SettlementRecord
+	recordsByTrace map[string]*SettlementRecord
+	localByQuery   map[string]*Txn
+	localByTrace   map[string]*Txn
+}
+
+func NewLinker() *Linker {
+	return &Linker{
+		recordsByQuery: make(map[string]*SettlementRecord),
+		recordsByTrace: make(map[string]*SettlementRecord),
+		localByQuery:   make(map[string]*Txn),
+		localByTrace:   make(map[string]*Txn),
+	}
+}
+
+// traceKey 系统跟踪号及交易传输时间只在同一代理机构内唯一,本地交易没有代理机构标识码时为空
+func traceKey(merID, acqInsCode, traceNo, traceTime string) string {
+	return merID + "|" + acqInsCode + "|" + traceNo + "|" + traceTime
+}
+
+// AddRecords 加入对账记录
+func (l *Linker) AddRecords(records []SettlementRecord) {
+	for i := range records {
+		r := &records[i]
+		if r.IsReversal() {
+			continue
+		}
+		if r.QueryID != "" {
+			l.recordsByQuery[r.QueryID] = r
+		}
+		if r.TraceNo != "" {
+			l.recordsByTrace[traceKey(r.MerID, r.AcqInsCode, r.TraceNo, r.TraceTime)] = r
+		}
+	}
+}
+
+// AddLocal 加入本地交易,未记录查询流水号及系统跟踪号的交易无法关联
+func (l *Linker) AddLocal(t Txn) {
+	if isReversal(t.TxnType) {
+		return
+	}
+	if t.QueryID != "" {
+		l.localByQuery[t.QueryID] = &t
+	}
+	if t.TraceNo != "" {
+		l.localByTrace[traceKey(t.MerID, "", t.TraceNo, t.TraceTime)] = &t
+	}
+}
+
+// Link 关联原交易并补充原交易查询流水号,返回未关联到原交易的差错数
+func (l *Linker) Link(disputes []DisputeRecord) (unlinked int) {
+	for i := range disputes {
+		d := &disputes[i]
+		if d.OrigQueryID != "" {
+			d.Original = l.recordsByQuery[d.OrigQueryID]
+			d.Local = l.localByQuery[d.OrigQueryID]
+		}
+		if d.Original == nil {
+			d.Original = l.recordsByTrace[traceKey(d.MerID, d.AcqInsCode, d.OrigTraceNo, d.OrigTraceTime)]
+		}
+		if d.Local == nil {
+			d.Local = l.localByTrace[traceKey(d.MerID, "", d.OrigTraceNo, d.OrigTraceTime)]
+		}
+
+		switch {
+		case d.Original == nil && d.Local == nil:
+			unlinked++
+		case d.OrigQueryID != "":
+		case d.Original != nil:
+			d.OrigQueryID = d.Original.QueryID
+		default:
+			d.OrigQueryID = d.Local.QueryID
+		}
+	}
+	return
+}
@@ -0,0 +1,167 @@
+package reconcile
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+const fixtureZME = "testdata/INN24010388ZME_700000000000001"
+
+var fixtureDisputeDate = time.Date(2024, 1, 3, 0, 0, 0, 0, unionpay.Beijing)
+
+func fixtureDisputes(t *testing.T) []DisputeRecord {
+	t.Helper()
+
+	f, err := os.Open(fixtureZME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	disputes, err := ParseErrorFile(f, fixtureDisputeDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return disputes
+}
+
+func TestParseErrorFile(t *testing.T) {
+	disputes := fixtureDisputes(t)
+	if len(disputes) != 4 {
+		t.Fatalf("got %d disputes, want 4", len(disputes))
+	}
+
+	cb := disputes[0]
+	if cb.TxnCode != "E23" || cb.Type != DisputeChargeback || cb.AcqInsCode != "00000000001" || cb.TraceNo != "200001" {
+		t.Errorf("chargeback header fields = %+v", cb)
+	}
+	if cb.OrigTraceNo != "100001" || cb.OrigTraceTime != "0102100000" || cb.ReasonCode != "4837" || cb.MerID != "700000000000001" {
+		t.Errorf("chargeback original fields = %+v", cb)
+	}
+	if cb.TxnAmt.Value != 10000 || cb.OrigTxnAmt.Value != 10000 || cb.Fee.Value != -50 || cb.NetAmt.Value != -9950 {
+		t.Errorf("chargeback amounts txnAmt=%s origTxnAmt=%s fee=%s netAmt=%s", cb.TxnAmt, cb.OrigTxnAmt, cb.Fee, cb.NetAmt)
+	}
+	if !cb.SettleDate.Equal(fixtureDisputeDate) || cb.OrigQueryID != "" || len(cb.Fields) != len(errorFileLayout) {
+		t.Errorf("chargeback = %+v", cb)
+	}
+
+	if r := disputes[1]; r.Type != DisputeRetrieval || r.OrigQueryID != "012401021000000000003" {
+		t.Errorf("retrieval type %s origQueryId %q", r.Type, r.OrigQueryID)
+	}
+	if d := disputes[2]; d.Type != DisputeCreditAdjustment || d.NetAmt.Value != 1000 {
+		t.Errorf("credit adjustment type %s netAmt %s", d.Type, d.NetAmt)
+	}
+	if d := disputes[3]; d.Type != DisputeOther {
+		t.Errorf("unknown code %s type %s, want %s", d.TxnCode, d.Type, DisputeOther)
+	}
+}
+
+func TestErrorFileLayoutWidth(t *testing.T) {
+	b, err := os.ReadFile(fixtureZME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width := len(errorFileLayout) - 1
+	for _, w := range errorFileLayout {
+		width += w
+	}
+	for i, line := range strings.Split(strings.TrimRight(string(b), "\r\n"), "\r\n") {
+		if len(line) > width {
+			t.Errorf("line %d is %d bytes, layout allows %d", i+1, len(line), width)
+		}
+	}
+}
+
+func TestNeedingResponse(t *testing.T) {
+	ds := NeedingResponse(fixtureDisputes(t))
+	if len(ds) != 2 || ds[0].Type != DisputeChargeback || ds[1].Type != DisputeRetrieval {
+		t.Errorf("needing response = %+v", ds)
+	}
+}
+
+func TestLink(t *testing.T) {
+	disputes := fixtureDisputes(t)
+	l := NewLinker()
+	l.AddRecords(fixtureRecords(t))
+
+	if unlinked := l.Link(disputes); unlinked != 2 {
+		t.Errorf("unlinked = %d, want 2", unlinked)
+	}
+
+	// 按原交易系统跟踪号关联,补充原交易查询流水号
+	if cb := disputes[0]; cb.Original == nil || cb.OrigOrderID() != "ORDER0001" || cb.OrigQueryID != "012401021000000000001" {
+		t.Errorf("chargeback linked to %+v, origQueryId %q", cb.Original, cb.OrigQueryID)
+	}
+	// 按原交易查询流水号关联
+	if r := disputes[1]; r.Original == nil || r.OrigOrderID() != "ORDER0003" {
+		t.Errorf("retrieval linked to %+v", r.Original)
+	}
+	// 系统跟踪号相同但代理机构不同
+	if d := disputes[2]; d.Original != nil || d.OrigQueryID != "" {
+		t.Errorf("dispute from another acquirer linked to %+v", d.Original)
+	}
+}
+
+func TestLinkTraceKeyIncludesMerID(t *testing.T) {
+	disputes := fixtureDisputes(t)[:1]
+	disputes[0].MerID = "700000000000002"
+
+	l := NewLinker()
+	l.AddRecords(fixtureRecords(t))
+	l.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", TraceNo: "100001", TraceTime: "0102100000"})
+	if unlinked := l.Link(disputes); unlinked != 1 {
+		t.Errorf("dispute of another merchant linked to %+v, %+v", disputes[0].Original, disputes[0].Local)
+	}
+}
+
+func TestLinkLocal(t *testing.T) {
+	disputes := fixtureDisputes(t)
+	l := NewLinker()
+	l.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", QueryID: "012401021000000000001", TraceNo: "100001", TraceTime: "0102100000"})
+	l.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0003", QueryID: "012401021000000000003"})
+	l.AddLocal(Txn{TxnType: "04", MerID: "700000000000001", OrderID: "REFUND0001", TraceNo: "100009", TraceTime: "0102140000"})
+
+	if unlinked := l.Link(disputes); unlinked != 1 {
+		t.Errorf("unlinked = %d, want 1", unlinked)
+	}
+	if cb := disputes[0]; cb.Local == nil || cb.OrigOrderID() != "ORDER0001" || cb.OrigQueryID != "012401021000000000001" {
+		t.Errorf("chargeback linked to %+v, origQueryId %q", cb.Local, cb.OrigQueryID)
+	}
+	if r := disputes[1]; r.Local == nil || r.OrigOrderID() != "ORDER0003" {
+		t.Errorf("retrieval linked to %+v", r.Local)
+	}
+	if d := disputes[3]; d.Local != nil {
+		t.Errorf("dispute linked to a refund %+v", d.Local)
+	}
+}
+
+func TestPackageDisputes(t *testing.T) {
+	b, err := os.ReadFile(fixtureZME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zm, err := os.ReadFile(fixtureZM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &unionpay.SettlementPackage{
+		SettleDate: fixtureDisputeDate,
+		Files: []unionpay.SettlementFile{
+			{Name: "INN24010388ZM_700000000000001", Data: zm},
+			{Name: "INN24010388ZME_700000000000001", Data: b},
+			{Name: "INN24010388ZMC_700000000000001", Data: b},
+		},
+	}
+
+	if ds, err := PackageDisputes(pkg); err != nil || len(ds) != 4 {
+		t.Errorf("got %d disputes, %v", len(ds), err)
+	}
+	if ds, err := PackageDisputes(pkg, "ZMC_"); err != nil || len(ds) != 8 {
+		t.Errorf("with chargeback files got %d disputes, %v", len(ds), err)
+	}
+}
@@ -0,0 +1,136 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/shima-park/unionpay"
+)
+
+const dateLayout = "2006-01-02"
+
+var itemHeader = []string{
+	"settleDate", "status", "merId", "orderId", "queryId", "txnType",
+	"localAmt", "settledAmt", "fee", "netAmt",
+}
+
+var summaryHeader = []string{
+	"settleDate", "records", "matched", "missingAtUnionPay", "missingLocally", "amountMismatch",
+	"txnAmt", "reversalAmt", "fee", "netAmt",
+}
+
+// WriteCSV 输出差异明细,金额以元为单位
+func (rep *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(itemHeader); err != nil {
+		return err
+	}
+	for _, it := range rep.Items {
+		if err := cw.Write(it.row()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteSummaryCSV 输出每个清算日的汇总
+func (rep *Report) WriteSummaryCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(summaryHeader); err != nil {
+		return err
+	}
+	for _, s := range rep.Summaries {
+		if err := cw.Write(s.row()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type summaryJSON struct {
+	SettleDate        string `json:"settleDate"`
+	Records           int    `json:"records"`
+	Matched           int    `json:"matched"`
+	MissingAtUnionPay int    `json:"missingAtUnionPay"`
+	MissingLocally    int    `json:"missingLocally"`
+	AmountMismatch    int    `json:"amountMismatch"`
+	TxnAmt            string `json:"txnAmt"`
+	ReversalAmt       string `json:"reversalAmt"`
+	Fee               string `json:"fee"`
+	NetAmt            string `json:"netAmt"`
+}
+
+// WriteJSON 输出汇总及差异明细,金额以元为单位
+func (rep *Report) WriteJSON(w io.Writer) error {
+	out := struct {
+		Summaries []summaryJSON       `json:"summaries"`
+		Items     []map[string]string `json:"items"`
+		Pending   int                 `json:"pending"`
+	}{
+		Summaries: make([]summaryJSON, 0, len(rep.Summaries)),
+		Items:     make([]map[string]string, 0, len(rep.Items)),
+		Pending:   len(rep.Pending),
+	}
+	for _, s := range rep.Summaries {
+		out.Summaries = append(out.Summaries, summaryJSON{
+			SettleDate:        s.SettleDate.Format(dateLayout),
+			Records:           s.Records,
+			Matched:           s.Matched,
+			MissingAtUnionPay: s.MissingAtUnionPay,
+			MissingLocally:    s.MissingLocally,
+			AmountMismatch:    s.AmountMismatch,
+			TxnAmt:            yuan(s.TxnAmt),
+			ReversalAmt:       yuan(s.ReversalAmt),
+			Fee:               yuan(s.Fee),
+			NetAmt:            yuan(s.NetAmt),
+		})
+	}
+	for _, it := range rep.Items {
+		m := make(map[string]string, len(itemHeader))
+		for i, v := range it.row() {
+			m[itemHeader[i]] = v
+		}
+		out.Items = append(out.Items, m)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func (it *Item) row() []string {
+	var merID, queryID, txnType, localAmt, settledAmt, fee, netAmt string
+	if t := it.Local; t != nil {
+		merID, queryID, txnType = t.MerID, t.QueryID, t.TxnType
+		localAmt = yuan(t.TxnAmt)
+	}
+	if r := it.Settled; r != nil {
+		merID, queryID, txnType = r.MerID, r.QueryID, r.TxnType
+		settledAmt, fee, netAmt = yuan(r.TxnAmt), yuan(r.Fee), yuan(r.NetAmt)
+	}
+	return []string{
+		it.SettleDate.Format(dateLayout), string(it.Status), merID, it.OrderID(), queryID, txnType,
+		localAmt, settledAmt, fee, netAmt,
+	}
+}
+
+func (s *Summary) row() []string {
+	return []string{
+		s.SettleDate.Format(dateLayout),
+		strconv.Itoa(s.Records),
+		strconv.Itoa(s.Matched),
+		strconv.Itoa(s.MissingAtUnionPay),
+		strconv.Itoa(s.MissingLocally),
+		strconv.Itoa(s.AmountMismatch),
+		yuan(s.TxnAmt), yuan(s.ReversalAmt), yuan(s.Fee), yuan(s.NetAmt),
+	}
+}
+
+// yuan 以主货币单位表示的金额,不含币种
+func yuan(a unionpay.Amount) string {
+	return a.Decimal().String()
+}
@@ -0,0 +1,80 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	rep := fixtureReconciler(t).Report()
+
+	var buf bytes.Buffer
+	if err := rep.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+len(rep.Items) || strings.Join(rows[0], ",") != strings.Join(itemHeader, ",") {
+		t.Fatalf("rows = %v", rows)
+	}
+
+	want := [][]string{
+		{"2024-01-02", "amount_mismatch", "700000000000001", "ORDER0003", "012401021200000000003", "01", "50.01", "50.00", "0.25", "49.75"},
+		{"2024-01-02", "missing_at_unionpay", "700000000000001", "ORDER0005", "", "01", "1.00", "", "", ""},
+		{"2024-01-02", "missing_locally", "700000000000001", "ORDER0004", "012401021300000000004", "01", "", "1.00", "0.01", "0.99"},
+	}
+	for i, w := range want {
+		if got := strings.Join(rows[i+1], ","); got != strings.Join(w, ",") {
+			t.Errorf("row %d = %s, want %s", i+1, got, strings.Join(w, ","))
+		}
+	}
+}
+
+func TestWriteSummaryCSV(t *testing.T) {
+	rep := fixtureReconciler(t).Report()
+
+	var buf bytes.Buffer
+	if err := rep.WriteSummaryCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2024-01-02,4,2,1,1,1,151.00,30.00,0.61,120.39"
+	if len(rows) != 2 || strings.Join(rows[1], ",") != want {
+		t.Errorf("rows = %v, want %s", rows, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	rep := fixtureReconciler(t).Report()
+
+	var buf bytes.Buffer
+	if err := rep.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Summaries []summaryJSON       `json:"summaries"`
+		Items     []map[string]string `json:"items"`
+		Pending   int                 `json:"pending"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Summaries) != 1 || out.Summaries[0].Fee != "0.61" || out.Summaries[0].NetAmt != "120.39" || out.Summaries[0].Matched != 2 {
+		t.Errorf("summaries = %+v", out.Summaries)
+	}
+	if len(out.Items) != 3 || out.Items[0]["status"] != "amount_mismatch" || out.Items[0]["localAmt"] != "50.01" {
+		t.Errorf("items = %v", out.Items)
+	}
+	if out.Pending != 1 {
+		t.Errorf("pending = %d", out.Pending)
+	}
+}
@@ -0,0 +1,210 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+var ErrTxnNotSucceeded = errors.New("transaction is not succeeded")
+
+// Txn 本地记录的一笔成功交易
+type Txn struct {
+	TxnType     string // 01:消费 04:退货 31:消费撤销
+	MerID       string
+	OrderID     string
+	TxnTime     string // 订单发送时间 YYYYMMDDHHmmss
+	QueryID     string // 银联查询流水号,为空时按merId,orderId及txnType匹配
+	OrigQueryID string // 退货及撤销的原交易查询流水号
+	TxnAmt      unionpay.Amount
+	SettleDate  time.Time // 清算日期,零值时按订单发送时间推算
+	TraceNo     string    // 系统跟踪号,用于关联差错记录
+	TraceTime   string    // 交易传输时间 MMDDhhmmss
+}
+
+// key 匹配对账记录的键,优先使用查询流水号
+func (t *Txn) key() string {
+	if t.QueryID != "" {
+		return queryKey(t.QueryID)
+	}
+	return orderKey(t.MerID, t.OrderID, t.TxnType)
+}
+
+func queryKey(queryID string) string {
+	return "q:" + queryID
+}
+
+func orderKey(merID, orderID, txnType string) string {
+	return "o:" + merID + "|" + orderID + "|" + txnType
+}
+
+// FromConsumeNotify 消费通知
+func FromConsumeNotify(r *unionpay.FrontConsumeNotifyResponse) (t Txn, err error) {
+	if r.RespCode != "00" && r.RespCode != "A6" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.RespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:   r.TxnType,
+		MerID:     r.MerID,
+		OrderID:   r.OrderID,
+		TxnTime:   r.TxnTime,
+		QueryID:   r.QueryID,
+		TxnAmt:    r.TxnAmt,
+		TraceNo:   r.TraceNo,
+		TraceTime: r.TraceTime,
+	}
+	t.SettleDate, _, err = r.SettleTimes()
+	return
+}
+
+// FromMobilePaymentNotify 手机控件支付通知
+func FromMobilePaymentNotify(r *unionpay.MobilePaymentNotifyResponse) (t Txn, err error) {
+	if r.RespCode != "00" && r.RespCode != "A6" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.RespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:   r.TxnType,
+		MerID:     r.MerID,
+		OrderID:   r.OrderID,
+		TxnTime:   r.TxnTime,
+		QueryID:   r.QueryID,
+		TxnAmt:    r.TxnAmt,
+		TraceNo:   r.TraceNO,
+		TraceTime: r.TraceTime,
+	}
+	t.SettleDate, _, err = r.SettleTimes()
+	return
+}
+
+// FromConsumeQuery 交易状态查询结果,适用于消费,退货及撤销
+func FromConsumeQuery(r *unionpay.ConsumeQueryResponse) (t Txn, err error) {
+	if r.OrigRespCode != "00" && r.OrigRespCode != "A6" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.OrigRespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:   r.TxnType,
+		MerID:     r.MerID,
+		OrderID:   r.OrderID,
+		TxnTime:   r.TxnTime,
+		QueryID:   r.QueryID,
+		TxnAmt:    r.TxnAmt,
+		TraceNo:   r.TraceNo,
+		TraceTime: r.TraceTime,
+	}
+	t.SettleDate, _, err = r.SettleTimes()
+	return
+}
+
+// FromRefund 退货应答,清算日期按订单发送时间推算
+func FromRefund(r *unionpay.ConsumeRefundResponse) (t Txn, err error) {
+	if r.RespCode != "00" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.RespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:     "04",
+		MerID:       r.MerID,
+		OrderID:     r.OrderID,
+		TxnTime:     r.TxnTime,
+		QueryID:     r.QueryID,
+		OrigQueryID: r.OrigQryID,
+		TxnAmt:      r.TxnAmt,
+	}
+	return
+}
+
+// FromRefundNotify 退货通知
+func FromRefundNotify(r *unionpay.ConsumeRefundNotifyResponse) (t Txn, err error) {
+	if r.RespCode != "00" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.RespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:     "04",
+		MerID:       r.MerID,
+		OrderID:     r.OrderID,
+		TxnTime:     r.TxnTime,
+		QueryID:     r.QueryID,
+		OrigQueryID: r.OrigQryID,
+		TxnAmt:      r.TxnAmt,
+		TraceNo:     r.TraceNo,
+		TraceTime:   r.TraceTime,
+	}
+	t.SettleDate, _, err = r.SettleTimes()
+	return
+}
+
+// FromUndo 消费撤销应答,清算日期按订单发送时间推算
+func FromUndo(r *unionpay.ConsumeUndoResponse) (t Txn, err error) {
+	if r.RespCode != "00" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.RespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:     "31",
+		MerID:       r.MerID,
+		OrderID:     r.OrderID,
+		TxnTime:     r.TxnTime,
+		QueryID:     r.QueryID,
+		OrigQueryID: r.OrigQryID,
+		TxnAmt:      r.TxnAmt,
+	}
+	return
+}
+
+// FromUndoNotify 消费撤销通知
+func FromUndoNotify(r *unionpay.ConsumeUndoNotifyResponse) (t Txn, err error) {
+	if r.RespCode != "00" {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.RespCode)
+		return
+	}
+
+	t = Txn{
+		TxnType:     "31",
+		MerID:       r.MerID,
+		OrderID:     r.OrderID,
+		TxnTime:     r.TxnTime,
+		QueryID:     r.QueryID,
+		OrigQueryID: r.OrigQryID,
+		TxnAmt:      r.TxnAmt,
+		TraceNo:     r.TraceNo,
+		TraceTime:   r.TraceTime,
+	}
+	t.SettleDate, _, err = r.SettleTimes()
+	return
+}
+
+// FromReverseResult Reverse的结果,仅ReverseAccepted及ReverseSucceeded可加入对账
+func FromReverseResult(merID string, r *unionpay.ReverseResult) (t Txn, err error) {
+	if r.Status != unionpay.ReverseAccepted && r.Status != unionpay.ReverseSucceeded {
+		err = fmt.Errorf("%w: %s %s", ErrTxnNotSucceeded, r.OrderID, r.Status)
+		return
+	}
+
+	t = Txn{
+		TxnType: "04",
+		MerID:   merID,
+		OrderID: r.OrderID,
+		TxnTime: r.TxnTime,
+		QueryID: r.QueryID,
+		TxnAmt:  r.TxnAmt,
+	}
+	if r.Kind == unionpay.ReverseByUndo {
+		t.TxnType = "31"
+	}
+	if r.Original != nil {
+		t.OrigQueryID = r.Original.QueryID
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shima-park/unionpay"
+)
+
+func TestFromRefundAndUndo(t *testing.T) {
+	for _, code := range []string{"00", "03", "12"} {
+		txn, err := FromRefund(&unionpay.ConsumeRefundResponse{MerID: "700000000000001", OrderID: "REFUND0001", TxnAmt: unionpay.Fen(3000), RespCode: code})
+		switch {
+		case code == "00" && (err != nil || txn.TxnType != "04" || txn.OrderID != "REFUND0001"):
+			t.Errorf("refund %s: %+v, %v", code, txn, err)
+		case code != "00" && !errors.Is(err, ErrTxnNotSucceeded):
+			t.Errorf("refund %s: err = %v, want %v", code, err, ErrTxnNotSucceeded)
+		}
+
+		txn, err = FromUndo(&unionpay.ConsumeUndoResponse{MerID: "700000000000001", OrderID: "UNDO0001", TxnAmt: unionpay.Fen(3000), RespCode: code})
+		switch {
+		case code == "00" && (err != nil || txn.TxnType != "31" || txn.OrderID != "UNDO0001"):
+			t.Errorf("undo %s: %+v, %v", code, txn, err)
+		case code != "00" && !errors.Is(err, ErrTxnNotSucceeded):
+			t.Errorf("undo %s: err = %v, want %v", code, err, ErrTxnNotSucceeded)
+		}
+	}
+}
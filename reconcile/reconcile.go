@@ -0,0 +1,255 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+var ErrNoSettleDate = errors.New("cannot determine settle date")
+
+// Status 核对结果
+type Status string
+
+const (
+	StatusMatched           Status = "matched"             // 一致
+	StatusMissingAtUnionPay Status = "missing_at_unionpay" // 本地有,对账文件中没有
+	StatusMissingLocally    Status = "missing_locally"     // 对账文件中有,本地没有
+	StatusAmountMismatch    Status = "amount_mismatch"     // 金额或币种不一致
+)
+
+// Item 一笔差异
+type Item struct {
+	SettleDate time.Time
+	Status     Status
+	Local      *Txn              // MissingLocally时为空
+	Settled    *SettlementRecord // MissingAtUnionPay时为空
+}
+
+// Summary 一个清算日的核对汇总,金额均来自对账文件
+type Summary struct {
+	SettleDate        time.Time
+	Records           int // 对账文件中的交易笔数
+	Matched           int
+	MissingAtUnionPay int
+	MissingLocally    int
+	AmountMismatch    int
+	TxnAmt            unionpay.Amount // 消费等正向交易金额
+	ReversalAmt       unionpay.Amount // 退货及撤销金额
+	Fee               unionpay.Amount // 商户手续费
+	NetAmt            unionpay.Amount // 清算净额
+}
+
+// Report 核对报告
+type Report struct {
+	Summaries []*Summary // 按清算日期排序
+	Items     []*Item    // 差异明细,按清算日期,状态及订单号排序
+	Pending   []Txn      // 清算日期没有对应对账文件的本地交易,未参与核对
+}
+
+// Reconciler 核对本地交易与对账文件,非并发安全
+//
+//	rc := reconcile.New(up.ExpectedSettleDate)
+//	for each local txn { rc.AddLocal(txn) }
+//	rc.AddPackage(pkg)
+//	report := rc.Report()
+type Reconciler struct {
+	settleDateOf func(txnTime time.Time) time.Time
+
+	local   map[string]Txn
+	records []SettlementRecord
+	dates   map[time.Time]bool
+}
+
+// New settleDateOf用于推算没有清算日期的本地交易的清算日期,一般为up.ExpectedSettleDate
+func New(settleDateOf func(txnTime time.Time) time.Time) *Reconciler {
+	return &Reconciler{
+		settleDateOf: settleDateOf,
+		local:        make(map[string]Txn),
+		dates:        make(map[time.Time]bool),
+	}
+}
+
+// AddLocal 加入一笔本地成功交易,同一交易多次加入时以最后一次为准
+func (rc *Reconciler) AddLocal(t Txn) error {
+	if t.SettleDate.IsZero() {
+		txnTime, err := unionpay.ParseTxnTime(t.TxnTime)
+		if err != nil || rc.settleDateOf == nil {
+			return fmt.Errorf("%w: %s %s", ErrNoSettleDate, t.OrderID, t.TxnTime)
+		}
+		t.SettleDate = rc.settleDateOf(txnTime)
+	}
+	t.SettleDate = day(t.SettleDate)
+
+	rc.local[t.key()] = t
+	return nil
+}
+
+// AddSettlement 加入一个清算日的对账记录,records为空表示该清算日没有交易
+func (rc *Reconciler) AddSettlement(settleDate time.Time, records []SettlementRecord) {
+	settleDate = day(settleDate)
+	rc.dates[settleDate] = true
+	for _, r := range records {
+		r.SettleDate = settleDate
+		rc.records = append(rc.records, r)
+	}
+}
+
+// AddPackage 解析并加入对账文件压缩包
+func (rc *Reconciler) AddPackage(pkg *unionpay.SettlementPackage) error {
+	records, err := PackageRecords(pkg)
+	if err != nil {
+		return err
+	}
+	rc.AddSettlement(pkg.SettleDate, records)
+	return nil
+}
+
+// Report 生成核对报告
+// 先按查询流水号匹配,剩余的本地交易再按商户代码,订单号及交易类型匹配,每条对账记录只匹配一笔本地交易
+// 对账文件金额均为人民币,本地交易币种不同时视为金额不一致
+func (rc *Reconciler) Report() *Report {
+	byQuery := make(map[string][]int)
+	byOrder := make(map[string][]int)
+	for i := range rc.records {
+		r := &rc.records[i]
+		if r.QueryID != "" {
+			byQuery[queryKey(r.QueryID)] = append(byQuery[queryKey(r.QueryID)], i)
+		}
+		k := orderKey(r.MerID, r.OrderID, r.TxnType)
+		byOrder[k] = append(byOrder[k], i)
+	}
+
+	rep := &Report{}
+	summaries := make(map[time.Time]*Summary)
+	summary := func(d time.Time) *Summary {
+		s, ok := summaries[d]
+		if !ok {
+			s = &Summary{SettleDate: d}
+			summaries[d] = s
+		}
+		return s
+	}
+	for d := range rc.dates {
+		summary(d)
+	}
+
+	used := make(map[int]bool)
+	take := func(candidates []int) (int, bool) {
+		for _, i := range candidates {
+			if !used[i] {
+				used[i] = true
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	locals := rc.sortedLocal()
+	matched := make(map[string]int, len(locals))
+	for _, t := range locals {
+		if t.QueryID == "" {
+			continue
+		}
+		if i, ok := take(byQuery[queryKey(t.QueryID)]); ok {
+			matched[t.key()] = i
+		}
+	}
+	for _, t := range locals {
+		if _, ok := matched[t.key()]; ok {
+			continue
+		}
+		if i, ok := take(byOrder[orderKey(t.MerID, t.OrderID, t.TxnType)]); ok {
+			matched[t.key()] = i
+		}
+	}
+
+	for _, t := range locals {
+		t := t
+
+		if i, ok := matched[t.key()]; ok {
+			r := &rc.records[i]
+			if c, err := t.TxnAmt.Cmp(r.TxnAmt); err == nil && c == 0 {
+				summary(r.SettleDate).Matched++
+				continue
+			}
+			summary(r.SettleDate).AmountMismatch++
+			rep.Items = append(rep.Items, &Item{SettleDate: r.SettleDate, Status: StatusAmountMismatch, Local: &t, Settled: r})
+			continue
+		}
+
+		if !rc.dates[t.SettleDate] {
+			rep.Pending = append(rep.Pending, t)
+			continue
+		}
+		summary(t.SettleDate).MissingAtUnionPay++
+		rep.Items = append(rep.Items, &Item{SettleDate: t.SettleDate, Status: StatusMissingAtUnionPay, Local: &t})
+	}
+
+	for i := range rc.records {
+		r := &rc.records[i]
+		s := summary(r.SettleDate)
+		s.Records++
+		if r.IsReversal() {
+			s.ReversalAmt.Value += r.TxnAmt.Value
+		} else {
+			s.TxnAmt.Value += r.TxnAmt.Value
+		}
+		s.Fee.Value += r.Fee.Value
+		s.NetAmt.Value += r.NetAmt.Value
+
+		if !used[i] {
+			s.MissingLocally++
+			rep.Items = append(rep.Items, &Item{SettleDate: r.SettleDate, Status: StatusMissingLocally, Settled: r})
+		}
+	}
+
+	for _, s := range summaries {
+		s.TxnAmt.Currency = unionpay.CNY
+		s.ReversalAmt.Currency = unionpay.CNY
+		s.Fee.Currency = unionpay.CNY
+		s.NetAmt.Currency = unionpay.CNY
+		rep.Summaries = append(rep.Summaries, s)
+	}
+	sort.Slice(rep.Summaries, func(i, j int) bool {
+		return rep.Summaries[i].SettleDate.Before(rep.Summaries[j].SettleDate)
+	})
+	sort.SliceStable(rep.Items, func(i, j int) bool {
+		a, b := rep.Items[i], rep.Items[j]
+		if !a.SettleDate.Equal(b.SettleDate) {
+			return a.SettleDate.Before(b.SettleDate)
+		}
+		if a.Status != b.Status {
+			return a.Status < b.Status
+		}
+		return a.OrderID() < b.OrderID()
+	})
+	return rep
+}
+
+// OrderID 差异对应的商户订单号
+func (it *Item) OrderID() string {
+	if it.Local != nil {
+		return it.Local.OrderID
+	}
+	return it.Settled.OrderID
+}
+
+func (rc *Reconciler) sortedLocal() []Txn {
+	txns := make([]Txn, 0, len(rc.local))
+	for _, t := range rc.local {
+		txns = append(txns, t)
+	}
+	sort.Slice(txns, func(i, j int) bool {
+		return txns[i].key() < txns[j].key()
+	})
+	return txns
+}
+
+func day(t time.Time) time.Time {
+	t = t.In(unionpay.Beijing)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, unionpay.Beijing)
+}
@@ -0,0 +1,106 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+// fixtureReconciler 对账文件中: ORDER0001匹配,REFUND0001按订单号匹配,ORDER0003金额不一致,ORDER0004本地没有
+func fixtureReconciler(t *testing.T) *Reconciler {
+	t.Helper()
+
+	rc := New(func(txnTime time.Time) time.Time { return txnTime })
+	rc.AddSettlement(fixtureSettleDate, fixtureRecords(t))
+
+	for _, txn := range []Txn{
+		{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", QueryID: "012401021000000000001", TxnAmt: unionpay.Fen(10000), SettleDate: fixtureSettleDate},
+		{TxnType: "04", MerID: "700000000000001", OrderID: "REFUND0001", TxnTime: "20240102110000", TxnAmt: unionpay.Fen(3000)},
+		{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0003", QueryID: "012401021200000000003", TxnAmt: unionpay.Fen(5001), SettleDate: fixtureSettleDate},
+		{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0005", TxnTime: "20240102140000", TxnAmt: unionpay.Fen(100)},
+		{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0006", TxnTime: "20240103140000", TxnAmt: unionpay.Fen(100)},
+	} {
+		if err := rc.AddLocal(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rc
+}
+
+func TestReport(t *testing.T) {
+	rep := fixtureReconciler(t).Report()
+
+	if len(rep.Summaries) != 1 {
+		t.Fatalf("got %d summaries", len(rep.Summaries))
+	}
+	s := rep.Summaries[0]
+	if s.Records != 4 || s.Matched != 2 || s.AmountMismatch != 1 || s.MissingLocally != 1 || s.MissingAtUnionPay != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.TxnAmt.Value != 15100 || s.ReversalAmt.Value != 3000 || s.Fee.Value != 61 || s.NetAmt.Value != 9950-2985+4975+99 {
+		t.Errorf("summary amounts = %d %d %d %d", s.TxnAmt.Value, s.ReversalAmt.Value, s.Fee.Value, s.NetAmt.Value)
+	}
+
+	want := []struct {
+		status  Status
+		orderID string
+	}{
+		{StatusAmountMismatch, "ORDER0003"},
+		{StatusMissingAtUnionPay, "ORDER0005"},
+		{StatusMissingLocally, "ORDER0004"},
+	}
+	if len(rep.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(rep.Items), len(want))
+	}
+	for i, w := range want {
+		if it := rep.Items[i]; it.Status != w.status || it.OrderID() != w.orderID {
+			t.Errorf("item %d = %s %s, want %s %s", i, it.Status, it.OrderID(), w.status, w.orderID)
+		}
+	}
+	if len(rep.Pending) != 1 || rep.Pending[0].OrderID != "ORDER0006" {
+		t.Errorf("pending = %+v", rep.Pending)
+	}
+}
+
+func TestReportCurrencyMismatch(t *testing.T) {
+	rc := New(nil)
+	rc.AddSettlement(fixtureSettleDate, fixtureRecords(t)[:1])
+	c, err := unionpay.LookupCurrency("840")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usd := unionpay.NewAmount(10000, c)
+	rc.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", QueryID: "012401021000000000001", TxnAmt: usd, SettleDate: fixtureSettleDate})
+
+	rep := rc.Report()
+	if len(rep.Items) != 1 || rep.Items[0].Status != StatusAmountMismatch {
+		t.Errorf("USD 100.00 matched CNY 100.00: %+v", rep.Items)
+	}
+}
+
+func TestReportQueryIDBeforeOrderKey(t *testing.T) {
+	records := fixtureRecords(t)[:1]
+	// 同一订单号的两条记录,本地两笔交易分别按查询流水号及订单号匹配
+	second := records[0]
+	second.QueryID = "012401021000000000009"
+	records = append(records, second)
+
+	rc := New(nil)
+	rc.AddSettlement(fixtureSettleDate, records)
+	rc.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", TxnAmt: unionpay.Fen(10000), SettleDate: fixtureSettleDate})
+	rc.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", QueryID: "012401021000000000009", TxnAmt: unionpay.Fen(10000), SettleDate: fixtureSettleDate})
+
+	rep := rc.Report()
+	if len(rep.Items) != 0 || rep.Summaries[0].Matched != 2 {
+		t.Errorf("items = %+v, summary = %+v", rep.Items, rep.Summaries[0])
+	}
+}
+
+func TestAddLocalWithoutSettleDate(t *testing.T) {
+	rc := New(nil)
+	err := rc.AddLocal(Txn{TxnType: "01", MerID: "700000000000001", OrderID: "ORDER0001", TxnTime: "20240102100000"})
+	if err == nil {
+		t.Error("no error without settleDateOf")
+	}
+}
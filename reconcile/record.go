@@ -0,0 +1,248 @@
+// Package reconcile 本地交易与银联对账文件的核对
+package reconcile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+// txnFileLayout 一般交易流水文件(ZM)各域的字节长度,域之间以一个空格分隔
+var txnFileLayout = []int{
+	3,  // 交易代码
+	11, // 代理机构标识码
+	11, // 发送机构标识码
+	6,  // 系统跟踪号
+	10, // 交易传输时间
+	19, // 帐号
+	12, // 交易金额
+	4,  // 商户类别
+	2,  // 终端类型
+	21, // 查询流水号
+	2,  // 支付方式(旧)
+	32, // 商户订单号
+	2,  // 支付卡类型
+	6,  // 原始交易的系统跟踪号
+	10, // 原始交易日期时间
+	13, // 商户手续费
+	13, // 结算金额
+	4,  // 支付方式
+	15, // 集团商户代码
+	2,  // 交易类型
+	2,  // 交易子类
+	6,  // 业务类型
+	2,  // 帐号类型
+	4,  // 账单类型
+	32, // 账单号码
+	1,  // 交互方式
+	21, // 原交易查询流水号
+	15, // 商户代码
+	1,  // 分账入账方式
+	15, // 二级商户代码
+	32, // 二级商户简称
+	13, // 二级商户分账入账金额
+	13, // 清算净额
+	8,  // 终端号
+	32, // 商户自定义域
+	13, // 优惠金额
+	13, // 发票金额
+	12, // 分期付款附加手续费
+	2,  // 分期付款期数
+	1,  // 交易介质
+	32, // 原始交易订单号
+}
+
+// SettlementRecord 一般交易流水文件中的一笔交易,金额均为人民币
+type SettlementRecord struct {
+	SettleDate    time.Time
+	TxnCode       string // 交易代码
+	AcqInsCode    string // 代理机构标识码
+	FwdInsCode    string // 发送机构标识码
+	TraceNo       string // 系统跟踪号
+	TraceTime     string // 交易传输时间 MMDDhhmmss
+	AccNo         string // 帐号 已脱敏
+	TxnAmt        unionpay.Amount
+	QueryID       string
+	OrderID       string
+	PayCardType   string
+	OrigTraceNo   string
+	OrigTraceTime string
+	Fee           unionpay.Amount // 商户手续费 借记商户为正,退还手续费为负
+	SettleAmt     unionpay.Amount // 结算金额 贷记商户为正
+	TxnType       string
+	TxnSubType    string
+	BizType       string
+	OrigQueryID   string
+	MerID         string
+	SubMerID      string
+	SubMerAbbr    string          // 二级商户简称 GBK编码原文
+	NetAmt        unionpay.Amount // 清算净额 贷记商户为正
+	TermID        string
+	MerReserved   string // 商户自定义域
+	DiscountAmt   unionpay.Amount
+	OrigOrderID   string
+}
+
+// IsReversal 是否为退货,撤销等与原交易方向相反的交易
+func (r *SettlementRecord) IsReversal() bool {
+	return isReversal(r.TxnType)
+}
+
+func isReversal(txnType string) bool {
+	switch txnType {
+	case "04", "31", "32", "33":
+		return true
+	}
+	return false
+}
+
+// PackageRecords 解析对账文件压缩包中的全部一般交易流水文件
+func PackageRecords(pkg *unionpay.SettlementPackage) (records []SettlementRecord, err error) {
+	for _, f := range pkg.Files {
+		if !f.IsTxnFile() {
+			continue
+		}
+
+		var rs []SettlementRecord
+		if rs, err = ParseTxnFile(bytes.NewReader(f.Data), pkg.SettleDate); err != nil {
+			err = fmt.Errorf("%s: %w", f.Name, err)
+			return
+		}
+		records = append(records, rs...)
+	}
+	return
+}
+
+// ParseTxnFile 解析一般交易流水文件(ZM),文件为GBK编码的定长文本
+func ParseTxnFile(r io.Reader, settleDate time.Time) (records []SettlementRecord, err error) {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var rec SettlementRecord
+		if rec, err = parseTxnLine(line); err != nil {
+			err = fmt.Errorf("line %d: %w", n, err)
+			return
+		}
+		rec.SettleDate = settleDate
+		records = append(records, rec)
+	}
+	err = sc.Err()
+	return
+}
+
+func parseTxnLine(line string) (rec SettlementRecord, err error) {
+	f := splitFixed(line, txnFileLayout)
+
+	rec = SettlementRecord{
+		TxnCode:       f[0],
+		AcqInsCode:    f[1],
+		FwdInsCode:    f[2],
+		TraceNo:       f[3],
+		TraceTime:     f[4],
+		AccNo:         f[5],
+		QueryID:       f[9],
+		OrderID:       f[11],
+		PayCardType:   f[12],
+		OrigTraceNo:   f[13],
+		OrigTraceTime: f[14],
+		TxnType:       f[19],
+		TxnSubType:    f[20],
+		BizType:       f[21],
+		OrigQueryID:   f[26],
+		MerID:         f[27],
+		SubMerID:      f[29],
+		SubMerAbbr:    f[30],
+		TermID:        f[33],
+		MerReserved:   f[34],
+		OrigOrderID:   f[40],
+	}
+
+	if rec.TxnAmt, err = parseFileAmount(f[6]); err != nil {
+		err = fmt.Errorf("bad txnAmt: %w", err)
+		return
+	}
+	var fee int64
+	if fee, err = parseSignedAmount(f[15]); err != nil {
+		err = fmt.Errorf("bad fee: %w", err)
+		return
+	}
+	rec.Fee = unionpay.Fen(-fee)
+	if rec.SettleAmt, err = parseSignedFen(f[16]); err != nil {
+		err = fmt.Errorf("bad settleAmt: %w", err)
+		return
+	}
+	if rec.NetAmt, err = parseSignedFen(f[32]); err != nil {
+		err = fmt.Errorf("bad netAmt: %w", err)
+		return
+	}
+	if rec.DiscountAmt, err = parseFileAmount(f[35]); err != nil {
+		err = fmt.Errorf("bad discountAmt: %w", err)
+		return
+	}
+	return
+}
+
+// splitFixed 按字节长度切分定长行,行尾缺少的域为空
+func splitFixed(line string, layout []int) []string {
+	fields := make([]string, len(layout))
+	pos := 0
+	for i, w := range layout {
+		if pos >= len(line) {
+			break
+		}
+		end := pos + w
+		if end > len(line) {
+			end = len(line)
+		}
+		fields[i] = strings.TrimSpace(line[pos:end])
+		pos = end + 1
+	}
+	return fields
+}
+
+// parseFileAmount 无符号金额,单位为分
+func parseFileAmount(s string) (unionpay.Amount, error) {
+	if s == "" {
+		return unionpay.Fen(0), nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return unionpay.Amount{}, fmt.Errorf("%q", s)
+	}
+	return unionpay.Fen(v), nil
+}
+
+func parseSignedFen(s string) (unionpay.Amount, error) {
+	v, err := parseSignedAmount(s)
+	return unionpay.Fen(v), err
+}
+
+// parseSignedAmount 首位C表示贷记商户,D表示借记商户,返回值贷记为正
+func parseSignedAmount(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	sign := int64(1)
+	switch s[0] {
+	case 'C':
+		s = s[1:]
+	case 'D':
+		sign, s = -1, s[1:]
+	}
+	v, err := strconv.ParseUint(s, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("%q", s)
+	}
+	return sign * int64(v), nil
+}
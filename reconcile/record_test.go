@@ -0,0 +1,145 @@
+package reconcile
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shima-park/unionpay"
+)
+
+const fixtureZM = "testdata/INN24010288ZM_700000000000001"
+
+var fixtureSettleDate = time.Date(2024, 1, 2, 0, 0, 0, 0, unionpay.Beijing)
+
+func fixtureRecords(t *testing.T) []SettlementRecord {
+	t.Helper()
+
+	f, err := os.Open(fixtureZM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records, err := ParseTxnFile(f, fixtureSettleDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestParseTxnFile(t *testing.T) {
+	records := fixtureRecords(t)
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+
+	consume := records[0]
+	if consume.TxnCode != "S22" || consume.TraceNo != "100001" || consume.TraceTime != "0102100000" || consume.AccNo != "621626******0018" {
+		t.Errorf("consume header fields = %+v", consume)
+	}
+	if consume.QueryID != "012401021000000000001" || consume.OrderID != "ORDER0001" || consume.MerID != "700000000000001" {
+		t.Errorf("consume ids = %s %s %s", consume.QueryID, consume.OrderID, consume.MerID)
+	}
+	if consume.TxnType != "01" || consume.TxnSubType != "01" || consume.BizType != "000201" || consume.IsReversal() {
+		t.Errorf("consume type = %s %s %s", consume.TxnType, consume.TxnSubType, consume.BizType)
+	}
+	// 借记商户的手续费为正,贷记商户的结算金额及清算净额为正
+	if consume.TxnAmt.Value != 10000 || consume.Fee.Value != 50 || consume.SettleAmt.Value != 9950 || consume.NetAmt.Value != 9950 {
+		t.Errorf("consume amounts = %d %d %d %d", consume.TxnAmt.Value, consume.Fee.Value, consume.SettleAmt.Value, consume.NetAmt.Value)
+	}
+	if !consume.SettleDate.Equal(fixtureSettleDate) {
+		t.Errorf("settleDate = %s", consume.SettleDate)
+	}
+
+	refund := records[1]
+	if !refund.IsReversal() || refund.OrigQueryID != consume.QueryID || refund.OrigOrderID != "ORDER0001" || refund.OrigTraceNo != "100001" {
+		t.Errorf("refund = %+v", refund)
+	}
+	// 退货退还手续费
+	if refund.TxnAmt.Value != 3000 || refund.Fee.Value != -15 || refund.SettleAmt.Value != -2985 || refund.NetAmt.Value != -2985 {
+		t.Errorf("refund amounts = %d %d %d %d", refund.TxnAmt.Value, refund.Fee.Value, refund.SettleAmt.Value, refund.NetAmt.Value)
+	}
+
+	sub := records[3]
+	if sub.SubMerID != "700000000000002" || sub.SubMerAbbr != "SUBMER" || sub.DiscountAmt.Value != 10 {
+		t.Errorf("sub merchant fields = %s %s %d", sub.SubMerID, sub.SubMerAbbr, sub.DiscountAmt.Value)
+	}
+}
+
+func TestTxnFileLayoutWidth(t *testing.T) {
+	b, err := os.ReadFile(fixtureZM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width := len(txnFileLayout) - 1
+	for _, w := range txnFileLayout {
+		width += w
+	}
+	for i, line := range strings.Split(strings.TrimRight(string(b), "\r\n"), "\r\n") {
+		if len(line) > width {
+			t.Errorf("line %d is %d bytes, layout allows %d", i+1, len(line), width)
+		}
+	}
+}
+
+func TestParseTxnFileErrors(t *testing.T) {
+	b, err := os.ReadFile(fixtureZM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+
+	bad := lines[0] + strings.Replace(lines[1], "000000003000", "0000000030x0", 1)
+	_, err = ParseTxnFile(strings.NewReader(bad), fixtureSettleDate)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: bad txnAmt") {
+		t.Errorf("err = %v", err)
+	}
+
+	// 空行跳过
+	records, err := ParseTxnFile(strings.NewReader(lines[0]+"\r\n\r\n"+lines[2]), fixtureSettleDate)
+	if err != nil || len(records) != 2 {
+		t.Errorf("got %d records, %v", len(records), err)
+	}
+}
+
+func TestParseSignedAmount(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"C000000000100", 100, false},
+		{"D000000000100", -100, false},
+		{"000000000100", 100, false},
+		{"", 0, false},
+		{"X000000000100", 0, true},
+		{"D-00000000100", 0, true},
+	} {
+		got, err := parseSignedAmount(c.in)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("parseSignedAmount(%q) = %d, %v", c.in, got, err)
+		}
+	}
+}
+
+func TestPackageRecords(t *testing.T) {
+	b, err := os.ReadFile(fixtureZM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &unionpay.SettlementPackage{
+		SettleDate: fixtureSettleDate,
+		Files: []unionpay.SettlementFile{
+			{Name: "INN24010288ZM_700000000000001", Data: b},
+			{Name: "INN24010288ZME_700000000000001", Data: []byte("not a txn file")},
+		},
+	}
+
+	records, err := PackageRecords(pkg)
+	if err != nil || len(records) != 4 {
+		t.Errorf("got %d records, %v", len(records), err)
+	}
+}
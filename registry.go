@@ -0,0 +1,259 @@
+package unionpay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrMerchantNotFound = errors.New("merchant not found")
+	ErrUnknownCertID    = errors.New("unknown certId for merchant")
+)
+
+// MerchantConfig 商户配置
+type MerchantConfig struct {
+	MerID       string `json:"merId"`       // 商户代码
+	SignMethod  string `json:"signMethod"`  // 签名方法 01:RSA(默认) 12:国密
+	SignCert    string `json:"signCert"`    // 商户签名证书路径
+	PrivateKey  string `json:"privateKey"`  // 商户签名私钥路径
+	VerifyCert  string `json:"verifyCert"`  // 银联验签证书路径
+	EncryptCert string `json:"encryptCert"` // 银联敏感信息加密证书路径 可选
+	TestEnv     bool   `json:"testEnv"`     // 是否测试环境
+	Currency    string `json:"currency"`    // 交易币种 默认156
+	Access      Access `json:"access"`      // 接入方式 默认商户直连接入
+}
+
+// NewPaymentFromConfig 按配置创建,证书加载失败时返回错误
+func NewPaymentFromConfig(cfg MerchantConfig) (up *UnionPay, err error) {
+	if cfg.MerID == "" {
+		err = errors.New("must param is empty:merId")
+		return
+	}
+
+	switch cfg.SignMethod {
+	case "", SignMethodRSA:
+		up, err = newPayment(cfg.MerID, cfg.SignCert, cfg.PrivateKey, cfg.VerifyCert)
+	case SignMethodSM3:
+		up, err = newSMPayment(cfg.MerID, cfg.SignCert, cfg.PrivateKey, cfg.VerifyCert)
+	default:
+		err = fmt.Errorf("unknown signMethod: %s", cfg.SignMethod)
+	}
+	if err != nil {
+		return
+	}
+
+	if cfg.EncryptCert != "" {
+		if err = up.setEncryptCert(cfg.EncryptCert); err != nil {
+			return
+		}
+	}
+	if cfg.Currency != "" {
+		if up.currency, err = LookupCurrency(cfg.Currency); err != nil {
+			return
+		}
+	}
+	if err = cfg.Access.Validate(); err != nil {
+		return
+	}
+	up.access = cfg.Access
+	up.testEnv = cfg.TestEnv
+	return
+}
+
+// ConfigSource 商户配置来源
+type ConfigSource interface {
+	Configs() ([]MerchantConfig, error)
+}
+
+// DirSource 目录中的每个*.json文件为一个商户配置,相对证书路径以该目录为基准
+type DirSource string
+
+func (d DirSource) Configs() (cfgs []MerchantConfig, err error) {
+	files, err := filepath.Glob(filepath.Join(string(d), "*.json"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		var cfg MerchantConfig
+		if cfg, err = ReadMerchantConfig(file); err != nil {
+			return
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return
+}
+
+// ReadMerchantConfig 读取JSON格式的商户配置,相对证书路径以配置文件所在目录为基准
+func ReadMerchantConfig(path string) (cfg MerchantConfig, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+		return
+	}
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&cfg.SignCert, &cfg.PrivateKey, &cfg.VerifyCert, &cfg.EncryptCert} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return
+}
+
+// Registry 多商户注册表,并发安全,可在运行时增删商户
+// 同一商户可同时持有RSA及国密证书,通知按merId+验签证书certId路由
+type Registry struct {
+	mu        sync.RWMutex
+	merchants map[string][]*UnionPay // merId 最后加入的用于发起交易
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		merchants: make(map[string][]*UnionPay),
+	}
+}
+
+// Add 加入商户,merId及验签证书相同的商户将被替换
+func (r *Registry) Add(up *UnionPay) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(up)
+}
+
+func (r *Registry) add(up *UnionPay) {
+	certID := up.creds().verifyCertID
+	ups := r.merchants[up.mchID][:0:0]
+	for _, u := range r.merchants[up.mchID] {
+		if u.creds().verifyCertID != certID {
+			ups = append(ups, u)
+		}
+	}
+	r.merchants[up.mchID] = append(ups, up)
+}
+
+// Remove 移除商户代码下的全部商户
+func (r *Registry) Remove(merID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.merchants, merID)
+}
+
+// Get 获取商户,用于发起交易
+func (r *Registry) Get(merID string) (*UnionPay, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ups := r.merchants[merID]
+	if len(ups) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMerchantNotFound, merID)
+	}
+	return ups[len(ups)-1], nil
+}
+
+// MerIDs 全部商户代码
+func (r *Registry) MerIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.merchants))
+	for id := range r.merchants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Load 从配置来源加载商户并加入注册表,已存在的商户被替换
+// 全部配置加载成功后才更新注册表
+func (r *Registry) Load(src ConfigSource) error {
+	ups, err := loadMerchants(src)
+	if err != nil {
+		return err
+	}
+
+	for _, up := range ups {
+		r.Add(up)
+	}
+	return nil
+}
+
+// Sync 使注册表与配置来源一致,配置中不存在的商户被移除
+func (r *Registry) Sync(src ConfigSource) error {
+	ups, err := loadMerchants(src)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.merchants = make(map[string][]*UnionPay, len(ups))
+	for _, up := range ups {
+		r.add(up)
+	}
+	return nil
+}
+
+func loadMerchants(src ConfigSource) (ups []*UnionPay, err error) {
+	cfgs, err := src.Configs()
+	if err != nil {
+		return
+	}
+
+	var errs []string
+	for _, cfg := range cfgs {
+		up, err := NewPaymentFromConfig(cfg)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", cfg.MerID, err))
+			continue
+		}
+		ups = append(ups, up)
+	}
+	if len(errs) > 0 {
+		err = fmt.Errorf("load merchants: %s", strings.Join(errs, "; "))
+	}
+	return
+}
+
+// Route 按通知中的merId及certId查找对应商户,再调用该商户的通知解析方法
+// 重新加载证书后,替换前的验签证书在宽限期内仍可路由
+//
+//	up, err := registry.Route(req)
+//	resp, err := up.FrontConsumeNotify(req)
+func (r *Registry) Route(req *http.Request) (*UnionPay, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	if len(req.Form) == 0 {
+		return nil, ErrNotifyDataIsEmpty
+	}
+	merID, certID := req.Form.Get("merId"), req.Form.Get("certId")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ups, ok := r.merchants[merID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMerchantNotFound, merID)
+	}
+	for i := len(ups) - 1; i >= 0; i-- {
+		if _, ok := ups[i].creds().verifierFor(certID, ups[i].now()); ok {
+			return ups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrUnknownCertID, merID, certID)
+}
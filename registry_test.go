@@ -0,0 +1,43 @@
+package unionpay
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func routeRequest(t *testing.T, merID, certID string) *http.Request {
+	t.Helper()
+
+	vals := url.Values{"merId": {merID}, "certId": {certID}}
+	req, err := http.NewRequest("POST", "/notify", strings.NewReader(vals.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestRegistryRoute(t *testing.T) {
+	up := newTestPayment(t)
+	r := NewRegistry()
+	r.Add(up)
+
+	certID := up.creds().verifyCertID
+	if got, err := r.Route(routeRequest(t, up.MerID(), certID)); err != nil || got != up {
+		t.Errorf("Route = %p, %v, want %p", got, err, up)
+	}
+	if _, err := r.Route(routeRequest(t, "700000000000002", certID)); !errors.Is(err, ErrMerchantNotFound) {
+		t.Errorf("unknown merId err = %v, want %v", err, ErrMerchantNotFound)
+	}
+	if _, err := r.Route(routeRequest(t, up.MerID(), "1")); !errors.Is(err, ErrUnknownCertID) {
+		t.Errorf("unknown certId err = %v, want %v", err, ErrUnknownCertID)
+	}
+
+	r.Remove(up.MerID())
+	if _, err := r.Get(up.MerID()); !errors.Is(err, ErrMerchantNotFound) {
+		t.Errorf("Get after Remove err = %v, want %v", err, ErrMerchantNotFound)
+	}
+}
@@ -0,0 +1,384 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCircuitOpen   = errors.New("unionpay gateway circuit open")
+	ErrRateLimited   = errors.New("unionpay merchant rate limited")
+	ErrResultUnknown = errors.New("unionpay transaction result unknown, query before resending")
+)
+
+// idempotentTxnTypes 可原样重发的交易类型
+var idempotentTxnTypes = map[string]bool{
+	"00": true, // 交易状态查询
+	"22": true, // 批量查询
+	"71": true, // 余额查询
+	"73": true, // 账单查询
+	"76": true, // 文件传输
+	"99": true, // 冲正 银联要求结果未明时重复发起
+}
+
+// queryableTxnTypes 可按orderId及txnTime查询结果的后台交易
+var queryableTxnTypes = map[string]bool{
+	"01": true, // 消费
+	"02": true, // 预授权
+	"03": true, // 预授权完成
+	"04": true, // 退货
+	"12": true, // 代付
+	"13": true, // 账单支付
+	"31": true, // 消费撤销
+	"32": true, // 预授权撤销
+	"33": true, // 预授权完成撤销
+}
+
+// Resilience 网关请求的重试,熔断及限流策略,零值可用,可由多个UnionPay共享
+//
+// 幂等交易(查询,冲正等)在网络异常或应答码为03,04,05时按指数退避加随机抖动重试
+// 消费,退货,撤销等交易从不自动重发,网络异常或应答码为03,04,05时查询原交易:
+// 查询到结果时以查询结果作为应答返回,查询次数用尽仍未确定(含原交易不存在)时返回ErrResultUnknown,由调用方查询后决定是否重发
+// 其余交易(如实名认证)不重试
+//
+// 同一网关连续失败达到阈值后熔断,熔断期间请求直接返回ErrCircuitOpen,到期后放行一个探测请求
+// 每个商户代码的请求速率超过限制时返回ErrRateLimited,两种情况请求均未发出,重试及查询同样受限
+// 退避等待随请求的context取消
+type Resilience struct {
+	Retries          int           // 最大重试次数 默认2,小于0时不重试,非幂等交易仍查询一次
+	BaseDelay        time.Duration // 退避基准 默认200毫秒,第n次重试前等待[0, BaseDelay*2^n)内的随机时长
+	MaxDelay         time.Duration // 单次退避上限 默认5秒
+	QueryDelay       time.Duration // 非幂等交易结果未明后首次查询前等待 默认1秒
+	FailureThreshold int           // 连续失败次数达到后熔断 默认5
+	OpenTimeout      time.Duration // 熔断持续时间 默认30秒
+	RateLimit        float64       // 每个商户代码每秒请求数 0不限制
+	Burst            int           // 限流时允许的突发请求数 默认1
+
+	mu       sync.Mutex
+	breakers map[string]*breaker // 网关地址
+	buckets  map[string]*bucket  // merId
+}
+
+// UseResilience 添加重试,熔断及限流中间件,最后添加时外层的日志及监控中间件记录最终结果,审计仍记录每次实际请求
+func (up *UnionPay) UseResilience(r *Resilience) *UnionPay {
+	return up.Use(r.Middleware(up))
+}
+
+// Middleware 网关请求中间件,up用于签名非幂等交易结果未明后的查询请求
+func (r *Resilience) Middleware(up *UnionPay) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			txnType := req.Form.Get("txnType")
+			switch {
+			case idempotentTxnTypes[txnType]:
+				return r.retry(next, req)
+			case queryableTxnTypes[txnType] && req.URL.Path == backTransReq:
+				return r.queryThenDecide(up, next, req)
+			}
+			return r.send(next, req)
+		}
+	}
+}
+
+// notSent 请求被熔断或限流,未发出
+func notSent(err error) bool {
+	return err == ErrCircuitOpen || err == ErrRateLimited
+}
+
+// retry 重发幂等交易,重发被熔断或限流时返回上一次的结果
+func (r *Resilience) retry(next RoundTripFunc, req *Request) (resp *Response, err error) {
+	resp, err = r.send(next, req)
+	for i := 0; i < r.retries() && isGatewayFailure(resp, err) && !notSent(err); i++ {
+		if sleepContext(req.context(), r.backoff(i)) != nil {
+			return
+		}
+
+		rresp, rerr := r.send(next, req)
+		if notSent(rerr) {
+			return
+		}
+		resp, err = rresp, rerr
+	}
+	return
+}
+
+// queryThenDecide 发送非幂等交易,结果未明时查询原交易,查询到结果则以查询结果作为应答,否则返回ErrResultUnknown
+func (r *Resilience) queryThenDecide(up *UnionPay, next RoundTripFunc, req *Request) (*Response, error) {
+	resp, err := r.send(next, req)
+	if !isGatewayFailure(resp, err) || notSent(err) {
+		return resp, err
+	}
+
+	unknown := func(reason error) (*Response, error) {
+		return resp, fmt.Errorf("%w: orderId %s txnTime %s: %s", ErrResultUnknown, req.Form.Get("orderId"), req.Form.Get("txnTime"), reason)
+	}
+
+	query, qerr := up.queryRequest(req)
+	if qerr != nil {
+		return unknown(qerr)
+	}
+
+	reason := err
+	for i := 0; i <= r.retries(); i++ {
+		delay := r.queryDelay()
+		if i > 0 {
+			delay = r.backoff(i - 1)
+		}
+		if serr := sleepContext(req.context(), delay); serr != nil {
+			return unknown(serr)
+		}
+
+		qresp, qerr := r.send(next, query)
+		if qerr != nil {
+			// 应答码34为原交易不存在,可能尚未入库,不重发原交易
+			reason = qerr
+			continue
+		}
+
+		switch code := qresp.Fields["origRespCode"]; code {
+		case "03", "04", "05", "":
+			// 原交易处理中
+			reason = fmt.Errorf("origRespCode %q", code)
+			continue
+		default:
+			return decidedResponse(req, qresp, code)
+		}
+	}
+	return unknown(reason)
+}
+
+// decidedResponse 以原交易查询结果作为应答,交易类型恢复为原交易的交易类型
+func decidedResponse(req *Request, qresp *Response, code string) (*Response, error) {
+	fields := make(map[string]string, len(qresp.Fields))
+	for k, v := range qresp.Fields {
+		fields[k] = v
+	}
+	for _, k := range []string{"txnType", "txnSubType", "bizType"} {
+		fields[k] = req.Form.Get(k)
+	}
+	fields["respCode"] = code
+	fields["respMsg"] = qresp.Fields["origRespMsg"]
+
+	resp := &Response{Body: qresp.Body, Fields: fields}
+	if code != "00" && code != "A6" {
+		return resp, &RespError{Code: code, Msg: fields["respMsg"]}
+	}
+	return resp, nil
+}
+
+// queryRequest 按原交易的bizType,orderId及txnTime构造签名后的查询请求
+func (up *UnionPay) queryRequest(req *Request) (*Request, error) {
+	cred := up.creds()
+
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "00"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: "00"})
+	kvs = append(kvs, KVpair{K: "bizType", V: req.Form.Get("bizType")})
+	for _, k := range accessKeys {
+		kvs = append(kvs, KVpair{K: k, V: req.Form.Get(k)})
+	}
+	kvs = append(kvs, KVpair{K: "channelType", V: "07"})
+	kvs = append(kvs, KVpair{K: "merId", V: req.Form.Get("merId")})
+	kvs = append(kvs, KVpair{K: "orderId", V: req.Form.Get("orderId")})
+	kvs = append(kvs, KVpair{K: "txnTime", V: req.Form.Get("txnTime")})
+	kvs = kvs.RemoveEmpty()
+
+	sig, err := up.sign(cred, kvs)
+	if err != nil {
+		return nil, err
+	}
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	u := *req.URL
+	u.Path = queryTrans
+	return &Request{URL: &u, Form: data, Context: req.Context}, nil
+}
+
+// send 经限流及熔断器发送一次请求
+func (r *Resilience) send(next RoundTripFunc, req *Request) (*Response, error) {
+	if !r.allow(req.Form.Get("merId")) {
+		return nil, ErrRateLimited
+	}
+
+	b := r.breaker(req.URL.Host)
+	if !b.allow(time.Now()) {
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := next(req)
+	b.record(time.Now(), isGatewayFailure(resp, err), r.failureThreshold(), r.openTimeout())
+	return resp, err
+}
+
+// isGatewayFailure 网络异常,HTTP状态码异常或应答码为03,04,05
+func isGatewayFailure(resp *Response, err error) bool {
+	switch e := err.(type) {
+	case nil, *SignatureError:
+		return false
+	case *RespError:
+		return e.IsUnknown()
+	}
+	return resp == nil
+}
+
+func (r *Resilience) retries() int {
+	switch {
+	case r.Retries < 0:
+		return 0
+	case r.Retries == 0:
+		return 2
+	}
+	return r.Retries
+}
+
+func (r *Resilience) queryDelay() time.Duration {
+	if r.QueryDelay <= 0 {
+		return time.Second
+	}
+	return r.QueryDelay
+}
+
+func (r *Resilience) failureThreshold() int {
+	if r.FailureThreshold <= 0 {
+		return 5
+	}
+	return r.FailureThreshold
+}
+
+func (r *Resilience) openTimeout() time.Duration {
+	if r.OpenTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return r.OpenTimeout
+}
+
+// backoff 第n次重试前的等待时长
+func (r *Resilience) backoff(n int) time.Duration {
+	base, max := r.BaseDelay, r.MaxDelay
+	if base <= 0 {
+		base = 200 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+
+	d := base << uint(n)
+	if d <= 0 || d > max {
+		d = max
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func (r *Resilience) breaker(host string) *breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.breakers == nil {
+		r.breakers = make(map[string]*breaker)
+	}
+	b, ok := r.breakers[host]
+	if !ok {
+		b = &breaker{}
+		r.breakers[host] = b
+	}
+	return b
+}
+
+// allow 按商户代码限流
+func (r *Resilience) allow(merID string) bool {
+	if r.RateLimit <= 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.buckets == nil {
+		r.buckets = make(map[string]*bucket)
+	}
+	burst := float64(r.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := time.Now()
+	b, ok := r.buckets[merID]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		r.buckets[merID] = b
+	}
+	return b.take(now, r.RateLimit, burst)
+}
+
+// bucket 令牌桶
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take 按速率补充令牌后取出一个,令牌不足时返回false
+func (b *bucket) take(now time.Time, rate, burst float64) bool {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		b.last = now
+	}
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// breaker 熔断器,熔断到期后只放行一个探测请求,探测成功则恢复,失败则再次熔断
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) record(now time.Time, failed bool, threshold int, timeout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures, b.openUntil, b.probing = 0, time.Time{}, false
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= threshold {
+		b.openUntil, b.probing = now.Add(timeout), false
+	}
+}
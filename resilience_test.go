@@ -0,0 +1,300 @@
+package unionpay
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, Beijing)
+	b := &breaker{}
+
+	for i := 0; i < 2; i++ {
+		if !b.allow(now) {
+			t.Fatalf("closed breaker rejected request %d", i)
+		}
+		b.record(now, true, 3, time.Minute)
+	}
+	b.record(now, false, 3, time.Minute)
+	b.record(now, true, 3, time.Minute)
+	b.record(now, true, 3, time.Minute)
+	if !b.allow(now) {
+		t.Fatal("success did not reset the failure count")
+	}
+
+	b.record(now, true, 3, time.Minute)
+	if b.allow(now.Add(59 * time.Second)) {
+		t.Error("open breaker allowed a request")
+	}
+
+	// 到期后只放行一个探测请求
+	later := now.Add(time.Minute)
+	if !b.allow(later) {
+		t.Fatal("probe rejected after timeout")
+	}
+	if b.allow(later) {
+		t.Error("second request allowed while probing")
+	}
+
+	// 探测失败再次熔断
+	b.record(later, true, 3, time.Minute)
+	if b.allow(later.Add(time.Second)) {
+		t.Error("breaker not reopened after failed probe")
+	}
+
+	// 探测成功恢复
+	later = later.Add(time.Minute)
+	b.allow(later)
+	b.record(later, false, 3, time.Minute)
+	if !b.allow(later) || !b.allow(later) {
+		t.Error("breaker not closed after successful probe")
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, Beijing)
+	b := &bucket{tokens: 2, last: now}
+
+	if !b.take(now, 1, 2) || !b.take(now, 1, 2) {
+		t.Fatal("burst not allowed")
+	}
+	if b.take(now, 1, 2) {
+		t.Error("took a token from an empty bucket")
+	}
+	if b.take(now.Add(500*time.Millisecond), 1, 2) {
+		t.Error("took a token after half a refill interval")
+	}
+	if !b.take(now.Add(time.Second), 1, 2) {
+		t.Error("token not refilled after one second")
+	}
+
+	// 长时间空闲后不超过突发数
+	later := now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if !b.take(later, 1, 2) {
+			t.Fatalf("take %d after idle", i)
+		}
+	}
+	if b.take(later, 1, 2) {
+		t.Error("bucket refilled beyond burst")
+	}
+
+	// 时钟回拨不补充令牌
+	if b.take(now, 1, 2) {
+		t.Error("token refilled when the clock went backwards")
+	}
+}
+
+// scriptedGateway 按交易类型依次返回预设应答,nil表示网络异常
+type scriptedGateway struct {
+	t       *testing.T
+	scripts map[string][]map[string]string
+	sent    map[string]int
+	forms   map[string]url.Values // 各交易类型最后一次请求的表单
+}
+
+func (g *scriptedGateway) roundTrip(req *Request) (*Response, error) {
+	txnType := req.Form.Get("txnType")
+	n := g.sent[txnType]
+	g.sent[txnType]++
+	if g.forms != nil {
+		g.forms[txnType] = req.Form
+	}
+
+	script := g.scripts[txnType]
+	if len(script) == 0 {
+		g.t.Fatalf("unexpected txnType %s", txnType)
+	}
+	if n >= len(script) {
+		n = len(script) - 1
+	}
+	fields := script[n]
+	if fields == nil {
+		return nil, errNetwork
+	}
+	if fields["respCode"] != "00" {
+		return &Response{Fields: fields}, &RespError{Code: fields["respCode"]}
+	}
+	return &Response{Fields: fields}, nil
+}
+
+func gatewayRequest(t *testing.T, path, txnType string) *Request {
+	t.Helper()
+
+	u, err := url.Parse("https://gateway.test.95516.com" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Request{URL: u, Form: url.Values{
+		"merId":      {"700000000000001"},
+		"orderId":    {"REFUND20240102001"},
+		"txnTime":    {"20240102100000"},
+		"txnType":    {txnType},
+		"txnSubType": {"00"},
+		"bizType":    {"000201"},
+	}}
+}
+
+func gwFields(respCode string, extra ...string) map[string]string {
+	m := map[string]string{"respCode": respCode}
+	for i := 0; i+1 < len(extra); i += 2 {
+		m[extra[i]] = extra[i+1]
+	}
+	return m
+}
+
+func TestQueryThenDecide(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		orig      []map[string]string
+		query     []map[string]string
+		wantCode  string // 应答码,为空时要求返回ErrResultUnknown
+		wantOrig  int
+		wantQuery int
+	}{
+		{name: "success", orig: []map[string]string{gwFields("00")}, wantCode: "00", wantOrig: 1},
+		{name: "rejected", orig: []map[string]string{gwFields("12")}, wantCode: "12", wantOrig: 1},
+		{name: "network then succeeded", orig: []map[string]string{nil}, query: []map[string]string{gwFields("00", "origRespCode", "00")}, wantCode: "00", wantOrig: 1, wantQuery: 1},
+		{name: "03 then failed", orig: []map[string]string{gwFields("03")}, query: []map[string]string{gwFields("00", "origRespCode", "11")}, wantCode: "11", wantOrig: 1, wantQuery: 1},
+		{name: "05 then processing then succeeded", orig: []map[string]string{gwFields("05")}, query: []map[string]string{gwFields("00", "origRespCode", "05"), gwFields("00", "origRespCode", "00")}, wantCode: "00", wantOrig: 1, wantQuery: 2},
+		{name: "not found is never resent", orig: []map[string]string{nil, gwFields("00")}, query: []map[string]string{gwFields("34")}, wantOrig: 1, wantQuery: 3},
+		{name: "query unreachable", orig: []map[string]string{gwFields("04")}, query: []map[string]string{nil}, wantOrig: 1, wantQuery: 3},
+	} {
+		up := newTestPayment(t)
+		g := &scriptedGateway{t: t, scripts: map[string][]map[string]string{"04": c.orig, "00": c.query}, sent: map[string]int{}}
+		r := &Resilience{BaseDelay: time.Microsecond, QueryDelay: time.Microsecond}
+
+		resp, err := r.Middleware(up)(g.roundTrip)(gatewayRequest(t, backTransReq, "04"))
+		switch {
+		case c.wantCode == "":
+			if !errors.Is(err, ErrResultUnknown) {
+				t.Errorf("%s: err = %v, want %v", c.name, err, ErrResultUnknown)
+			}
+		case c.wantCode == "00":
+			if err != nil || resp.Fields["respCode"] != "00" {
+				t.Errorf("%s: got %v, %v", c.name, resp, err)
+			}
+		default:
+			if e, ok := err.(*RespError); !ok || e.Code != c.wantCode {
+				t.Errorf("%s: err = %v, want respCode %s", c.name, err, c.wantCode)
+			}
+		}
+		if g.sent["04"] != c.wantOrig || g.sent["00"] != c.wantQuery {
+			t.Errorf("%s: sent %d refunds and %d queries, want %d and %d", c.name, g.sent["04"], g.sent["00"], c.wantOrig, c.wantQuery)
+		}
+	}
+}
+
+func TestQueryThenDecideOrigTxn(t *testing.T) {
+	up := newTestPayment(t)
+	g := &scriptedGateway{t: t, scripts: map[string][]map[string]string{
+		"04": {nil},
+		"00": {gwFields("00", "origRespCode", "00", "txnType", "00", "txnSubType", "00", "bizType", "000201")},
+	}, sent: map[string]int{}, forms: map[string]url.Values{}}
+	r := &Resilience{BaseDelay: time.Microsecond, QueryDelay: time.Microsecond}
+
+	req := gatewayRequest(t, backTransReq, "04")
+	req.Form.Set("bizType", "000301")
+	resp, err := r.Middleware(up)(g.roundTrip)(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.forms["00"].Get("bizType"); got != "000301" {
+		t.Errorf("query bizType = %s, want 000301", got)
+	}
+	if resp.Fields["txnType"] != "04" || resp.Fields["txnSubType"] != "00" || resp.Fields["bizType"] != "000301" {
+		t.Errorf("decided response txnType/txnSubType/bizType = %s/%s/%s, want 04/00/000301",
+			resp.Fields["txnType"], resp.Fields["txnSubType"], resp.Fields["bizType"])
+	}
+}
+
+func TestQueryThenDecideHonoursContext(t *testing.T) {
+	up := newTestPayment(t)
+	g := &scriptedGateway{t: t, scripts: map[string][]map[string]string{"04": {nil}, "00": {gwFields("34")}}, sent: map[string]int{}}
+	r := &Resilience{QueryDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req := gatewayRequest(t, backTransReq, "04")
+	req.Context = ctx
+
+	start := time.Now()
+	_, err := r.Middleware(up)(g.roundTrip)(req)
+	if !errors.Is(err, ErrResultUnknown) {
+		t.Errorf("err = %v, want %v", err, ErrResultUnknown)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("query delay ignored the context")
+	}
+	if g.sent["00"] != 0 {
+		t.Errorf("sent %d queries after cancel", g.sent["00"])
+	}
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		txnType  string
+		retries  int
+		script   []map[string]string
+		wantSent int
+		wantErr  bool
+	}{
+		{name: "query retried", txnType: "00", script: []map[string]string{nil, gwFields("03"), gwFields("00")}, wantSent: 3},
+		{name: "query gives up", txnType: "00", script: []map[string]string{nil}, wantSent: 3, wantErr: true},
+		{name: "retries disabled", txnType: "00", retries: -1, script: []map[string]string{nil}, wantSent: 1, wantErr: true},
+		{name: "one retry", txnType: "71", retries: 1, script: []map[string]string{nil}, wantSent: 2, wantErr: true},
+		{name: "decisive code not retried", txnType: "00", script: []map[string]string{gwFields("34")}, wantSent: 1, wantErr: true},
+		{name: "real-name auth not retried", txnType: "72", script: []map[string]string{nil}, wantSent: 1, wantErr: true},
+	} {
+		up := newTestPayment(t)
+		g := &scriptedGateway{t: t, scripts: map[string][]map[string]string{c.txnType: c.script}, sent: map[string]int{}}
+		r := &Resilience{Retries: c.retries, BaseDelay: time.Microsecond}
+
+		_, err := r.Middleware(up)(g.roundTrip)(gatewayRequest(t, backTransReq, c.txnType))
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: err = %v", c.name, err)
+		}
+		if g.sent[c.txnType] != c.wantSent {
+			t.Errorf("%s: sent %d, want %d", c.name, g.sent[c.txnType], c.wantSent)
+		}
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	up := newTestPayment(t)
+	g := &scriptedGateway{t: t, scripts: map[string][]map[string]string{"00": {nil, gwFields("00")}}, sent: map[string]int{}}
+	r := &Resilience{BaseDelay: time.Microsecond, RateLimit: 0.001}
+	rt := r.Middleware(up)(g.roundTrip)
+
+	// 重试消耗令牌,被限流时返回上一次的结果
+	if _, err := rt(gatewayRequest(t, backTransReq, "00")); err != errNetwork {
+		t.Errorf("err = %v, want %v", err, errNetwork)
+	}
+	if g.sent["00"] != 1 {
+		t.Errorf("sent %d, want 1", g.sent["00"])
+	}
+	if _, err := rt(gatewayRequest(t, backTransReq, "00")); err != ErrRateLimited {
+		t.Errorf("err = %v, want %v", err, ErrRateLimited)
+	}
+}
+
+func TestCircuitOpen(t *testing.T) {
+	up := newTestPayment(t)
+	g := &scriptedGateway{t: t, scripts: map[string][]map[string]string{"00": {nil}}, sent: map[string]int{}}
+	r := &Resilience{Retries: -1, FailureThreshold: 2}
+	rt := r.Middleware(up)(g.roundTrip)
+
+	for i := 0; i < 2; i++ {
+		rt(gatewayRequest(t, backTransReq, "00"))
+	}
+	if _, err := rt(gatewayRequest(t, backTransReq, "00")); err != ErrCircuitOpen {
+		t.Errorf("err = %v, want %v", err, ErrCircuitOpen)
+	}
+	if g.sent["00"] != 2 {
+		t.Errorf("sent %d, want 2", g.sent["00"])
+	}
+}
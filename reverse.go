@@ -0,0 +1,261 @@
+package unionpay
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrOriginalNotSucceeded = errors.New("original consume is not succeeded")
+	ErrReverseAmountExceeds = errors.New("reverse amount exceeds original amount")
+)
+
+var (
+	// 撤销或退货结果未明时查询该交易的次数及间隔
+	reverseQueryTimes    = 6
+	reverseQueryInterval = 5 * time.Second
+
+	// undoCutoffMargin 日切前该时间内被拒绝的撤销改为退货,银联日切时间与本地时钟可能存在偏差
+	undoCutoffMargin = 10 * time.Minute
+)
+
+// ReverseKind 实际发起的交易类型
+type ReverseKind int
+
+const (
+	ReverseByUndo   ReverseKind = iota // 消费撤销 当日全额
+	ReverseByRefund                    // 退货 隔日或部分金额
+)
+
+func (k ReverseKind) String() string {
+	if k == ReverseByUndo {
+		return "undo"
+	}
+	return "refund"
+}
+
+// ReverseStatus 撤销或退货的状态
+type ReverseStatus int
+
+const (
+	ReverseFailed    ReverseStatus = iota // 交易失败
+	ReverseAccepted                       // 银联已受理,最终结果以后台通知为准
+	ReverseSucceeded                      // 查询确认交易成功
+	ReverseUnknown                        // 多次查询仍未明,需稍后再次查询
+)
+
+func (s ReverseStatus) String() string {
+	switch s {
+	case ReverseAccepted:
+		return "accepted"
+	case ReverseSucceeded:
+		return "succeeded"
+	case ReverseUnknown:
+		return "unknown"
+	}
+	return "failed"
+}
+
+// OriginalTxn 原消费交易
+type OriginalTxn struct {
+	OrderID string // 原交易商户订单号
+	TxnTime string // 原交易订单发送时间
+	// Refunded 原交易已发起且未失败的退货金额合计,银联查询结果不包含该金额,由商户按自身退货记录传入
+	Refunded Amount
+}
+
+// ReverseOptions 撤销或退货交易本身的参数
+type ReverseOptions struct {
+	OrderID       string // 撤销或退货的商户订单号
+	RefundOrderID string // 撤销被拒绝改为退货时使用的商户订单号,为空时使用OrderID
+	BackURL       string // 后台通知地址
+	ReqReserved   string
+	Reserved      string
+}
+
+// ReverseResult 撤销或退货的统一结果
+type ReverseResult struct {
+	Kind     ReverseKind
+	Status   ReverseStatus
+	OrderID  string // 撤销或退货的商户订单号
+	TxnTime  string // 撤销或退货的订单发送时间,用于查询
+	TxnAmt   Amount
+	QueryID  string
+	RespCode string
+	RespMsg  string
+
+	Original *ConsumeQueryResponse // 原交易查询结果
+	Query    *ConsumeQueryResponse // 结果未明时最后一次查询撤销或退货的结果
+	Undo     *RespError            // 日切前撤销被拒绝而改为退货时撤销的应答
+}
+
+// Reverse 撤销或退货原消费交易,amount为零值时退回剩余全部金额
+// 原交易与当前时间处于同一清算日,未退过货且全额退回时发起消费撤销,否则发起退货
+// 撤销在日切前undoCutoffMargin内被拒绝时改为退货
+// 应答码为03,04,05或网络异常时查询该撤销或退货交易确认结果
+func (up *UnionPay) Reverse(original OriginalTxn, amount Amount, opts ReverseOptions) (result *ReverseResult, err error) {
+	orig, err := up.ConsumeQuery(original.OrderID, "", original.TxnTime, "")
+	if err != nil {
+		return
+	}
+	if orig.OrigRespCode != "00" && orig.OrigRespCode != "A6" {
+		err = fmt.Errorf("%w: %s %s", ErrOriginalNotSucceeded, orig.OrigRespCode, orig.OrigRespMsg)
+		return
+	}
+
+	remaining, err := remainingAmount(orig.TxnAmt, original.Refunded)
+	if err != nil {
+		return
+	}
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if err = amount.Validate(); err != nil {
+		return
+	}
+	cmp, err := amount.Cmp(remaining)
+	if err != nil {
+		return
+	}
+	if cmp > 0 {
+		err = ErrReverseAmountExceeds
+		return
+	}
+
+	kind := ReverseByRefund
+	if cmp == 0 && original.Refunded.IsZero() {
+		var sameDay bool
+		if sameDay, err = up.inSettleDay(orig, up.now()); err != nil {
+			return
+		}
+		if sameDay {
+			kind = ReverseByUndo
+		}
+	}
+
+	result = &ReverseResult{
+		Kind:     kind,
+		OrderID:  opts.OrderID,
+		TxnTime:  up.txnTime(),
+		TxnAmt:   amount,
+		Original: orig,
+	}
+
+	perr := up.sendReverse(result, opts)
+	if e, ok := perr.(*RespError); ok && !e.IsUnknown() && kind == ReverseByUndo {
+		var sameDay bool
+		if sameDay, err = up.inSettleDay(orig, up.now().Add(undoCutoffMargin)); err != nil {
+			return
+		}
+		if !sameDay {
+			result.Kind = ReverseByRefund
+			result.Undo = e
+			result.TxnTime = up.txnTime()
+			if opts.RefundOrderID != "" {
+				result.OrderID = opts.RefundOrderID
+			}
+			perr = up.sendReverse(result, opts)
+		}
+	}
+
+	if perr == nil {
+		result.Status = ReverseAccepted
+		return
+	}
+
+	if e, ok := perr.(*RespError); ok && !e.IsUnknown() {
+		result.Status = ReverseFailed
+		result.RespCode = e.Code
+		result.RespMsg = e.Msg
+		return
+	}
+
+	up.settleUnknownReverse(result)
+	return
+}
+
+// sendReverse 按result.Kind发起撤销或退货,产品类型与原交易一致
+func (up *UnionPay) sendReverse(result *ReverseResult, opts ReverseOptions) (err error) {
+	orig := result.Original
+	bizType := orig.BizType
+	if bizType == "" {
+		bizType = "000201"
+	}
+
+	switch result.Kind {
+	case ReverseByUndo:
+		var resp *ConsumeUndoResponse
+		resp, err = up.consumeUndo(bizType, result.OrderID, result.TxnTime, opts.BackURL, result.TxnAmt, orig.QueryID, opts.ReqReserved, opts.Reserved)
+		if err == nil {
+			result.QueryID, result.RespCode, result.RespMsg = resp.QueryID, resp.RespCode, resp.RespMsg
+		}
+	default:
+		var resp *ConsumeRefundResponse
+		resp, err = up.consumeRefund(bizType, result.OrderID, result.TxnTime, opts.BackURL, result.TxnAmt, orig.QueryID, opts.ReqReserved, opts.Reserved)
+		if err == nil {
+			result.QueryID, result.RespCode, result.RespMsg = resp.QueryID, resp.RespCode, resp.RespMsg
+		}
+	}
+	return
+}
+
+// remainingAmount 原交易金额扣除已退货金额后的可退金额
+func remainingAmount(txnAmt, refunded Amount) (remaining Amount, err error) {
+	cmp, err := refunded.Cmp(txnAmt)
+	if err != nil {
+		return
+	}
+	if cmp > 0 {
+		err = ErrReverseAmountExceeds
+		return
+	}
+	remaining = txnAmt
+	remaining.Value -= refunded.Value
+	return
+}
+
+// inSettleDay 原交易是否与at处于同一清算日,原交易未返回清算日期时按订单发送时间计算
+func (up *UnionPay) inSettleDay(orig *ConsumeQueryResponse, at time.Time) (bool, error) {
+	settleDate, _, err := orig.SettleTimes()
+	if err != nil {
+		return false, err
+	}
+	if settleDate.IsZero() {
+		txnTime, err := ParseTxnTime(orig.TxnTime)
+		if err != nil {
+			return false, err
+		}
+		settleDate = up.ExpectedSettleDate(txnTime)
+	}
+	return settleDate.Equal(up.ExpectedSettleDate(at)), nil
+}
+
+// settleUnknownReverse 查询结果未明的撤销或退货,ctx结束时保持ReverseUnknown
+func (up *UnionPay) settleUnknownReverse(result *ReverseResult) {
+	result.Status = ReverseUnknown
+	for i := 0; i < reverseQueryTimes; i++ {
+		if sleepContext(up.context(), reverseQueryInterval) != nil {
+			return
+		}
+
+		q, qerr := up.ConsumeQuery(result.OrderID, "", result.TxnTime, "")
+		if qerr != nil {
+			continue
+		}
+		result.Query = q
+
+		switch q.OrigRespCode {
+		case "00", "A6":
+			result.Status = ReverseSucceeded
+		case "03", "04", "05":
+			continue
+		default:
+			result.Status = ReverseFailed
+		}
+		result.QueryID = q.QueryID
+		result.RespCode = q.OrigRespCode
+		result.RespMsg = q.OrigRespMsg
+		return
+	}
+}
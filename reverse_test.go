@@ -0,0 +1,188 @@
+package unionpay
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 查询流水号 AN21
+const (
+	testOrigQueryID    = "202401021000000000001"
+	testUndoQueryID    = "202401021500000000002"
+	testRefundQueryID  = "202401021500000000003"
+	testReverseQueryID = "202401021500000000004"
+)
+
+// reverseGateway 原交易为1000分的消费,undo及refund为撤销及退货的应答码
+type reverseGateway struct {
+	undo   string
+	refund string
+	query  string // 查询撤销或退货时的origRespCode
+
+	sent []url.Values
+}
+
+func (g *reverseGateway) serve(form url.Values) map[string]string {
+	switch form.Get("txnType") {
+	case "00":
+		if form.Get("orderId") == "CONSUME20240102" {
+			return respFields(form, "00", "origRespCode", "00", "queryId", testOrigQueryID, "txnAmt", "1000", "bizType", "000301")
+		}
+		if g.query == "" {
+			return nil
+		}
+		return respFields(form, "00", "origRespCode", g.query, "queryId", testReverseQueryID)
+	case "31":
+		g.sent = append(g.sent, form)
+		return respFields(form, g.undo, "queryId", testUndoQueryID)
+	case "04":
+		g.sent = append(g.sent, form)
+		return respFields(form, g.refund, "queryId", testRefundQueryID)
+	}
+	return nil
+}
+
+func newReversePayment(t *testing.T, now string, g *reverseGateway) *UnionPay {
+	up := newTestPayment(t).SetTestEnv(false)
+	up.SetClock(fixedClock(t, now))
+	fakeGateway(up, g.serve)
+	return up
+}
+
+func TestReverseUndoSameDay(t *testing.T) {
+	g := &reverseGateway{undo: "00"}
+	up := newReversePayment(t, "20240102150000", g)
+
+	result, err := up.Reverse(OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000"}, Amount{}, ReverseOptions{OrderID: "UNDO20240102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != ReverseByUndo || result.Status != ReverseAccepted || result.QueryID != testUndoQueryID {
+		t.Errorf("got %s %s %s, want undo accepted", result.Kind, result.Status, result.QueryID)
+	}
+	if len(g.sent) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(g.sent))
+	}
+	form := g.sent[0]
+	if form.Get("bizType") != "000301" || form.Get("origQryId") != testOrigQueryID || form.Get("txnAmt") != "1000" {
+		t.Errorf("undo form bizType=%s origQryId=%s txnAmt=%s", form.Get("bizType"), form.Get("origQryId"), form.Get("txnAmt"))
+	}
+}
+
+func TestReverseRefundNextDay(t *testing.T) {
+	g := &reverseGateway{refund: "00"}
+	up := newReversePayment(t, "20240103090000", g)
+
+	result, err := up.Reverse(OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000"}, Amount{}, ReverseOptions{OrderID: "REFUND20240103"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != ReverseByRefund || result.Status != ReverseAccepted {
+		t.Errorf("got %s %s, want refund accepted", result.Kind, result.Status)
+	}
+	if got := g.sent[0].Get("bizType"); got != "000301" {
+		t.Errorf("refund bizType = %s, want original 000301", got)
+	}
+}
+
+func TestReverseEarlierRefunds(t *testing.T) {
+	g := &reverseGateway{refund: "00"}
+	up := newReversePayment(t, "20240102150000", g)
+	orig := OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000", Refunded: Fen(600)}
+
+	if _, err := up.Reverse(orig, Fen(500), ReverseOptions{OrderID: "REFUND20240102"}); err != ErrReverseAmountExceeds {
+		t.Errorf("refund over remaining err = %v, want %v", err, ErrReverseAmountExceeds)
+	}
+
+	result, err := up.Reverse(orig, Amount{}, ReverseOptions{OrderID: "REFUND20240102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一清算日剩余全额也只能退货
+	if result.Kind != ReverseByRefund || result.TxnAmt.Value != 400 || g.sent[0].Get("txnAmt") != "400" {
+		t.Errorf("got %s %d, want refund of remaining 400", result.Kind, result.TxnAmt.Value)
+	}
+
+	orig.Refunded = Fen(1001)
+	if _, err = up.Reverse(orig, Amount{}, ReverseOptions{OrderID: "REFUND20240102"}); err != ErrReverseAmountExceeds {
+		t.Errorf("refunded over original err = %v, want %v", err, ErrReverseAmountExceeds)
+	}
+}
+
+func TestReverseUndoRejectedNearCutoff(t *testing.T) {
+	g := &reverseGateway{undo: "12", refund: "00"}
+	up := newReversePayment(t, "20240102225500", g)
+
+	result, err := up.Reverse(OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000"}, Amount{}, ReverseOptions{OrderID: "UNDO20240102", RefundOrderID: "REFUND20240102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != ReverseByRefund || result.Status != ReverseAccepted || result.OrderID != "REFUND20240102" {
+		t.Errorf("got %s %s %s, want refund accepted REFUND20240102", result.Kind, result.Status, result.OrderID)
+	}
+	if result.Undo == nil || result.Undo.Code != "12" {
+		t.Errorf("Undo = %v, want rejected undo 12", result.Undo)
+	}
+	if len(g.sent) != 2 || g.sent[1].Get("txnType") != "04" || g.sent[1].Get("orderId") != "REFUND20240102" {
+		t.Errorf("sent %v, want undo then refund", g.sent)
+	}
+}
+
+func TestReverseUndoRejected(t *testing.T) {
+	g := &reverseGateway{undo: "12", refund: "00"}
+	up := newReversePayment(t, "20240102150000", g)
+
+	result, err := up.Reverse(OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000"}, Amount{}, ReverseOptions{OrderID: "UNDO20240102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != ReverseByUndo || result.Status != ReverseFailed || result.RespCode != "12" || len(g.sent) != 1 {
+		t.Errorf("got %s %s %s after %d requests, want undo failed 12", result.Kind, result.Status, result.RespCode, len(g.sent))
+	}
+}
+
+func TestReverseUnknownQueried(t *testing.T) {
+	defer func(d time.Duration) { reverseQueryInterval = d }(reverseQueryInterval)
+	reverseQueryInterval = time.Millisecond
+
+	g := &reverseGateway{undo: "03", query: "00"}
+	up := newReversePayment(t, "20240102150000", g)
+
+	result, err := up.Reverse(OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000"}, Amount{}, ReverseOptions{OrderID: "UNDO20240102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != ReverseSucceeded || result.QueryID != testReverseQueryID || result.Query == nil {
+		t.Errorf("got %s %s, want succeeded", result.Status, result.QueryID)
+	}
+}
+
+func TestReverseUnknownContext(t *testing.T) {
+	g := &reverseGateway{undo: "03"}
+	up := newReversePayment(t, "20240102150000", g)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	up = up.WithContext(ctx)
+
+	done := make(chan *ReverseResult)
+	go func() {
+		result, err := up.Reverse(OriginalTxn{OrderID: "CONSUME20240102", TxnTime: "20240102100000"}, Amount{}, ReverseOptions{OrderID: "UNDO20240102"})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case result := <-done:
+		if result != nil && result.Status != ReverseUnknown {
+			t.Errorf("status = %s, want unknown", result.Status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reverse did not return after ctx was canceled")
+	}
+}
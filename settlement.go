@@ -0,0 +1,184 @@
+package unionpay
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FileTypeSettlement 全渠道对账文件
+const FileTypeSettlement = "00"
+
+var ErrEmptyFileContent = errors.New("file content is empty")
+
+func (up *UnionPay) getFileHost() string {
+	if up.testEnv {
+		return "https://filedownload.test.95516.com"
+	}
+	return "https://filedownload.95516.com"
+}
+
+type FileTransferResponse struct {
+	Version     string
+	Encoding    string
+	CertID      string
+	Signature   string
+	SignMethod  string
+	TxnType     string
+	TxnSubType  string
+	BizType     string
+	AccessType  string
+	MerID       string
+	SettleDate  string
+	TxnTime     string
+	FileType    string
+	FileName    string // 压缩包文件名
+	FileContent string // 压缩包,先zlib压缩再base64编码
+	Reserved    string
+	RespCode    string
+	RespMsg     string
+}
+
+// Zip 解码fileContent,返回对账文件压缩包
+func (r *FileTransferResponse) Zip() ([]byte, error) {
+	if r.FileContent == "" {
+		return nil, ErrEmptyFileContent
+	}
+
+	b, err := base64.StdEncoding.DecodeString(r.FileContent)
+	if err != nil {
+		return nil, fmt.Errorf("bad fileContent: %w", err)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("bad fileContent: %w", err)
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// FileTransfer 文件传输(txnType 76),settleDate为清算日期MMDD,对账文件一般在清算日次日9点后可下载
+func (up *UnionPay) FileTransfer(settleDate, fileType string) (resp *FileTransferResponse, err error) {
+	cred := up.creds()
+
+	kvs := KVpairs{}
+	kvs = append(kvs, KVpair{K: "version", V: cred.version()})
+	kvs = append(kvs, KVpair{K: "encoding", V: "UTF-8"})
+	kvs = append(kvs, KVpair{K: "certId", V: cred.certID})
+	kvs = append(kvs, KVpair{K: "signMethod", V: cred.signMethod()})
+	kvs = append(kvs, KVpair{K: "txnType", V: "76"})
+	kvs = append(kvs, KVpair{K: "txnSubType", V: "01"})
+	kvs = append(kvs, KVpair{K: "bizType", V: "000000"})
+	kvs = append(kvs, up.access.kvpairs()...)
+	kvs = append(kvs, KVpair{K: "merId", V: up.mchID})
+	kvs = append(kvs, KVpair{K: "settleDate", V: settleDate})
+	kvs = append(kvs, KVpair{K: "txnTime", V: up.txnTime()})
+	kvs = append(kvs, KVpair{K: "fileType", V: fileType})
+
+	var sig string
+	sig, err = up.sign(cred, kvs)
+	if err != nil {
+		return
+	}
+
+	kvs = append(kvs, KVpair{K: "signature", V: sig})
+
+	data := url.Values{}
+	for _, v := range kvs {
+		data.Set(v.K, v.V)
+	}
+
+	var u *url.URL
+	u, err = url.Parse(up.getFileHost() + "/")
+	if err != nil {
+		return
+	}
+
+	var result FileTransferResponse
+	err = up.client.PostForm(up.context(), u, data, &result)
+	if err != nil {
+		return
+	}
+
+	resp = &result
+	return
+}
+
+// SettlementFile 对账文件压缩包中的文件
+type SettlementFile struct {
+	Name string
+	Data []byte
+}
+
+// IsTxnFile 是否为一般交易流水文件(文件名含ZM_)
+func (f SettlementFile) IsTxnFile() bool {
+	return strings.Contains(f.Name, "ZM_")
+}
+
+// IsErrorFile 是否为差错流水文件(文件名含ZME_)
+func (f SettlementFile) IsErrorFile() bool {
+	return strings.Contains(f.Name, "ZME_")
+}
+
+// SettlementPackage 清算日的对账文件
+type SettlementPackage struct {
+	SettleDate time.Time
+	FileName   string // 压缩包文件名
+	Zip        []byte // 压缩包原文,可直接保存
+	Files      []SettlementFile
+}
+
+// DownloadSettlement 下载并解压清算日的对账文件
+func (up *UnionPay) DownloadSettlement(settleDate time.Time) (pkg *SettlementPackage, err error) {
+	settleDate = settleDate.In(Beijing)
+	resp, err := up.FileTransfer(settleDate.Format("0102"), FileTypeSettlement)
+	if err != nil {
+		return
+	}
+
+	pkg = &SettlementPackage{
+		SettleDate: time.Date(settleDate.Year(), settleDate.Month(), settleDate.Day(), 0, 0, 0, 0, Beijing),
+		FileName:   resp.FileName,
+	}
+	if pkg.Zip, err = resp.Zip(); err != nil {
+		return
+	}
+	pkg.Files, err = OpenSettlementZip(pkg.Zip)
+	return
+}
+
+// OpenSettlementZip 解压对账文件压缩包,可用于本地保存的压缩包
+func OpenSettlementZip(b []byte) (files []SettlementFile, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return
+	}
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+
+		var rc io.ReadCloser
+		if rc, err = zf.Open(); err != nil {
+			return
+		}
+		f := SettlementFile{Name: zf.Name}
+		f.Data, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return
+		}
+		files = append(files, f)
+	}
+	return
+}
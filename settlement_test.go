@@ -0,0 +1,80 @@
+package unionpay
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// settlementZip 打包对账文件并按fileContent的格式编码
+func settlementZip(t *testing.T, files map[string]string) (zipData []byte, fileContent string) {
+	t.Helper()
+
+	var zb bytes.Buffer
+	zw := zip.NewWriter(&zb)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var cb bytes.Buffer
+	cw := zlib.NewWriter(&cb)
+	cw.Write(zb.Bytes())
+	cw.Close()
+	return zb.Bytes(), base64.StdEncoding.EncodeToString(cb.Bytes())
+}
+
+func TestDownloadSettlement(t *testing.T) {
+	zm, err := os.ReadFile("reconcile/testdata/INN24010288ZM_700000000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipData, fileContent := settlementZip(t, map[string]string{"INN24010288ZM_700000000000001": string(zm)})
+
+	up := newTestPayment(t)
+	sink := &memoryAuditSink{}
+	up.SetAuditSink(sink)
+	fakeGateway(up, func(form url.Values) map[string]string {
+		if form.Get("txnType") != "76" || form.Get("settleDate") != "0102" || form.Get("fileType") != FileTypeSettlement {
+			t.Errorf("request = %v", form)
+		}
+		return respFields(form, "00", "fileName", "700000000000001_20240102.zip", "fileContent", fileContent)
+	})
+
+	pkg, err := up.DownloadSettlement(date(t, "20240102"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkg.Zip, zipData) || pkg.FileName != "700000000000001_20240102.zip" {
+		t.Errorf("package = %s, %d bytes", pkg.FileName, len(pkg.Zip))
+	}
+	if len(pkg.Files) != 1 || !pkg.Files[0].IsTxnFile() || pkg.Files[0].IsErrorFile() || !bytes.Equal(pkg.Files[0].Data, zm) {
+		t.Errorf("files = %+v", pkg.Files)
+	}
+
+	if got := sink.kinds(); got != "request,response" {
+		t.Errorf("records = %s", got)
+	}
+}
+
+func TestFileTransferResponseZip(t *testing.T) {
+	if _, err := (&FileTransferResponse{}).Zip(); err != ErrEmptyFileContent {
+		t.Errorf("err = %v, want %v", err, ErrEmptyFileContent)
+	}
+	if _, err := (&FileTransferResponse{FileContent: "not base64!"}).Zip(); err == nil {
+		t.Error("bad base64 accepted")
+	}
+	if _, err := (&FileTransferResponse{FileContent: base64.StdEncoding.EncodeToString([]byte("not zlib"))}).Zip(); err == nil {
+		t.Error("bad zlib accepted")
+	}
+}
@@ -90,3 +90,21 @@ func Contains(strs []string, key string) bool {
 	}
 	return false
 }
+
+// BuildComposite 生成组合域,如 {k1=v1&k2=v2},子域按上送顺序拼接,空值忽略
+func BuildComposite(kvs KVpairs) string {
+	return "{" + kvs.RemoveEmpty().Join("&") + "}"
+}
+
+// ParseComposite 解析组合域,如 reserved, instalTransInfo, customerInfo
+func ParseComposite(s string) map[string]string {
+	m := make(map[string]string)
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "{"), "}")
+	for _, field := range strings.Split(s, "&") {
+		f := strings.SplitN(field, "=", 2)
+		if len(f) == 2 && f[0] != "" {
+			m[f[0]] = f[1]
+		}
+	}
+	return m
+}
@@ -0,0 +1,174 @@
+package unionpay
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 签名方法
+const (
+	SignMethodRSA = "01" // RSA-SHA1
+)
+
+var ErrSignerMismatch = errors.New("signer does not match sign cert")
+
+// Signer 报文签名器,私钥可以保存在本地,HSM或远程签名服务中
+type Signer interface {
+	// SignMethod 签名方法,上送signMethod域
+	SignMethod() string
+	// Sign 对待签名串签名,canonical为按域名排序并以&拼接的 k=v 串,返回签名的原始字节
+	Sign(canonical []byte) ([]byte, error)
+}
+
+// CryptoSigner 使用crypto.Signer签名,PKCS#11等HSM驱动一般均实现了该接口
+// 签名方式为 RSA(SHA1(hex(SHA1(canonical))))
+type CryptoSigner struct {
+	signer crypto.Signer
+}
+
+// NewCryptoSigner 使用RSA私钥的crypto.Signer创建签名器
+func NewCryptoSigner(s crypto.Signer) *CryptoSigner {
+	return &CryptoSigner{signer: s}
+}
+
+func (s *CryptoSigner) SignMethod() string {
+	return SignMethodRSA
+}
+
+// Public 签名私钥对应的公钥,用于校验与签名证书是否一致
+func (s *CryptoSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *CryptoSigner) Sign(canonical []byte) ([]byte, error) {
+	if _, ok := s.signer.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported public key type %T, want RSA", s.signer.Public())
+	}
+	hashed := SHA1([]byte(fmt.Sprintf("%x", SHA1(canonical))))
+	return s.signer.Sign(rand.Reader, hashed, crypto.SHA1)
+}
+
+// Verifier 应答及通知验签
+type Verifier interface {
+	// Verify 验证canonical的签名,sig为Base64解码后的签名
+	Verify(canonical, sig []byte) error
+}
+
+// RSAVerifier 使用银联验签证书公钥验证RSA签名
+type RSAVerifier struct {
+	pub *rsa.PublicKey
+}
+
+func NewRSAVerifier(pub *rsa.PublicKey) *RSAVerifier {
+	return &RSAVerifier{pub: pub}
+}
+
+func (v *RSAVerifier) Verify(canonical, sig []byte) error {
+	hashed := SHA1([]byte(fmt.Sprintf("%x", SHA1(canonical))))
+	return rsa.VerifyPKCS1v15(v.pub, crypto.SHA1, hashed, sig)
+}
+
+// SetSigner 设置签名器,替换证书文件中的私钥,certId不变
+// 签名器与签名证书不一致时退出,更换证书请使用SetSignerWithCert
+func (up *UnionPay) SetSigner(s Signer) *UnionPay {
+	up.cred.update(func(c *credentials) {
+		if err := checkSigner(s, c.signPub); err != nil {
+			log.Fatal(err)
+		}
+		c.signer = s
+	})
+	return up
+}
+
+// SetSignerWithCert 设置签名器及其RSA或SM2签名证书,certId取自证书,签名器与证书不一致时返回错误
+func (up *UnionPay) SetSignerWithCert(s Signer, certPath string) error {
+	pub, certID, err := loadSignCert(certPath)
+	if err != nil {
+		return err
+	}
+	if err = checkSigner(s, pub); err != nil {
+		return err
+	}
+
+	up.cred.update(func(c *credentials) {
+		c.signer = s
+		c.certID, c.signPub = certID, pub
+	})
+	return nil
+}
+
+// loadSignCert 读取RSA或SM2签名证书
+func loadSignCert(path string) (pub crypto.PublicKey, certID string, err error) {
+	cert, err := newPublicKey(path)
+	if err == nil {
+		return cert.PublicKey, cert.SerialNumber.String(), nil
+	}
+
+	smCert, smErr := newSM2Certificate(path)
+	if smErr != nil {
+		return
+	}
+	return smCert.PublicKey, smCert.SerialNumber.String(), nil
+}
+
+// checkSigner 签名方法须与签名证书的密钥类型一致,签名器实现了Public时公钥须与证书一致
+func checkSigner(s Signer, pub crypto.PublicKey) error {
+	var method string
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		method = SignMethodRSA
+	case *ecdsa.PublicKey:
+		method = SignMethodSM3
+	default:
+		return fmt.Errorf("unsupported sign cert key type %T", pub)
+	}
+	if s.SignMethod() != method {
+		return fmt.Errorf("%w: signMethod %s, want %s", ErrSignerMismatch, s.SignMethod(), method)
+	}
+
+	ps, ok := s.(interface{ Public() crypto.PublicKey })
+	if !ok {
+		return nil
+	}
+	if k, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); ok && !k.Equal(ps.Public()) {
+		return fmt.Errorf("%w: public key differs from sign cert", ErrSignerMismatch)
+	}
+	return nil
+}
+
+// sign 使用交易开始时取得的cred签名,审计记录在实际发送时写入
+func (up *UnionPay) sign(cred *credentials, kvs KVpairs) (string, error) {
+	return signature(cred.signer, kvs)
+}
+
+// Sign 使用当前证书签名,kvs中的signature域不参与签名,用于排查签名问题或自行组装报文
+func (up *UnionPay) Sign(kvs KVpairs) (sig string, err error) {
+	signed := make(KVpairs, 0, len(kvs))
+	for _, kv := range kvs {
+		if kv.K != "signature" {
+			signed = append(signed, kv)
+		}
+	}
+	return up.sign(up.creds(), signed)
+}
+
+// signature 签名前按数据元字典校验全部域,所有请求均经过此处
+func signature(signer Signer, kvs KVpairs) (sig string, err error) {
+	if err = ValidateKVpairs(kvs); err != nil {
+		return
+	}
+
+	b, err := signer.Sign([]byte(kvs.RemoveEmpty().Sort().Join("&")))
+	if err != nil {
+		return
+	}
+
+	sig = base64.StdEncoding.EncodeToString(b)
+	return
+}
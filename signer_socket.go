@@ -0,0 +1,137 @@
+package unionpay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// 签名服务协议,每个连接处理一次签名
+// 请求: 4字节大端长度 + 待签名串
+// 应答: 1字节状态(0成功,1失败) + 4字节大端长度 + 签名或错误信息
+const (
+	signStatusOK    = 0
+	signStatusError = 1
+
+	maxSignFrame = 1 << 20
+)
+
+var ErrSignFrameTooLarge = errors.New("sign frame too large")
+
+// SocketSigner 通过本地Unix socket调用签名服务,参考实现,可配合ServeSigner在无硬件时测试
+type SocketSigner struct {
+	Path    string        // socket路径
+	Method  string        // 签名方法 默认01
+	Timeout time.Duration // 单次签名超时 默认5秒
+}
+
+func NewSocketSigner(path string) *SocketSigner {
+	return &SocketSigner{Path: path}
+}
+
+func (s *SocketSigner) SignMethod() string {
+	if s.Method == "" {
+		return SignMethodRSA
+	}
+	return s.Method
+}
+
+func (s *SocketSigner) Sign(canonical []byte) (sig []byte, err error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	conn, err := net.DialTimeout("unix", s.Path, timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+	if err = writeSignFrame(conn, canonical); err != nil {
+		return
+	}
+
+	var status [1]byte
+	if _, err = io.ReadFull(conn, status[:]); err != nil {
+		return
+	}
+	payload, err := readSignFrame(conn)
+	if err != nil {
+		return
+	}
+	if status[0] != signStatusOK {
+		err = fmt.Errorf("[unionpay] remote signer: %s", payload)
+		return
+	}
+	sig = payload
+	return
+}
+
+// ServeSigner 在l上提供签名服务,直到l关闭
+func ServeSigner(l net.Listener, signer Signer) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSignConn(conn, signer)
+	}
+}
+
+func serveSignConn(conn net.Conn, signer Signer) {
+	defer conn.Close()
+
+	canonical, err := readSignFrame(conn)
+	if err != nil {
+		return
+	}
+
+	status, payload := byte(signStatusOK), []byte(nil)
+	sig, err := signer.Sign(canonical)
+	if err != nil {
+		status, payload = signStatusError, []byte(err.Error())
+	} else {
+		payload = sig
+	}
+
+	if _, err = conn.Write([]byte{status}); err != nil {
+		return
+	}
+	writeSignFrame(conn, payload)
+}
+
+func writeSignFrame(w io.Writer, b []byte) error {
+	if len(b) > maxSignFrame {
+		return ErrSignFrameTooLarge
+	}
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	if _, err := w.Write(n[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func readSignFrame(r io.Reader) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size > maxSignFrame {
+		return nil, ErrSignFrameTooLarge
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
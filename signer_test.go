@@ -0,0 +1,145 @@
+package unionpay
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writeTestCert 生成自签名证书并写入临时目录
+func writeTestCert(t *testing.T, key *rsa.PrivateKey, serial int64) string {
+	t.Helper()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test sign cert"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sign.cert")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// verifyRSA 按 RSA(SHA1(hex(SHA1(canonical)))) 验签
+func verifyRSA(pub *rsa.PublicKey, canonical, sig []byte) error {
+	hashed := SHA1([]byte(fmt.Sprintf("%x", SHA1(canonical))))
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA1, hashed, sig)
+}
+
+func TestSetSignerSameKey(t *testing.T) {
+	up := newTestPayment(t)
+	key, err := newPrivateKey("key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certID := up.creds().certID
+
+	if up.SetSigner(NewCryptoSigner(key)); up.creds().certID != certID {
+		t.Errorf("certId changed to %s", up.creds().certID)
+	}
+}
+
+func TestSetSignerMismatch(t *testing.T) {
+	up := newTestPayment(t)
+
+	err := checkSigner(NewCryptoSigner(testKey(t)), up.creds().signPub)
+	if !errors.Is(err, ErrSignerMismatch) {
+		t.Errorf("other key err = %v, want %v", err, ErrSignerMismatch)
+	}
+
+	err = checkSigner(&SocketSigner{Path: "/nonexistent", Method: SignMethodSM3}, up.creds().signPub)
+	if !errors.Is(err, ErrSignerMismatch) {
+		t.Errorf("SM3 signer with RSA cert err = %v, want %v", err, ErrSignerMismatch)
+	}
+
+	// 签名器不提供公钥时只校验签名方法
+	if err = checkSigner(NewSocketSigner("/nonexistent"), up.creds().signPub); err != nil {
+		t.Errorf("socket signer: %v", err)
+	}
+}
+
+func TestSetSignerWithCert(t *testing.T) {
+	up := newTestPayment(t)
+	key := testKey(t)
+	path := writeTestCert(t, key, 20240102)
+
+	if err := up.SetSignerWithCert(NewCryptoSigner(testKey(t)), path); err == nil {
+		t.Error("signer not matching the new cert accepted")
+	}
+	if err := up.SetSignerWithCert(NewCryptoSigner(key), path); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := up.creds().certID; got != "20240102" {
+		t.Errorf("certId = %s, want 20240102", got)
+	}
+
+	sig, err := signature(up.creds().signer, KVpairs{{K: "merId", V: up.mchID}, {K: "orderId", V: "ORDER0001"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := base64.StdEncoding.DecodeString(sig)
+	if err = verifyRSA(&key.PublicKey, []byte("merId=700000000000001&orderId=ORDER0001"), b); err != nil {
+		t.Errorf("signature does not verify with the new cert: %v", err)
+	}
+}
+
+func TestNewPaymentWithSignerMismatch(t *testing.T) {
+	if _, err := newPaymentWithSigner("700000000000001", "key.cert", NewCryptoSigner(testKey(t)), "key.cert"); err == nil {
+		t.Error("signer not matching the sign cert accepted")
+	}
+}
+
+func TestSocketSigner(t *testing.T) {
+	key, err := newPrivateKey("key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go ServeSigner(l, NewCryptoSigner(key))
+
+	canonical := []byte("merId=700000000000001&orderId=ORDER0001")
+	sig, err := NewSocketSigner(path).Sign(canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyRSA(&key.PublicKey, canonical, sig); err != nil {
+		t.Error(err)
+	}
+}
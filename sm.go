@@ -0,0 +1,192 @@
+package unionpay
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/shima-park/unionpay/gm"
+)
+
+// SignMethodSM3 国密签名 SM2/SM3,使用5.1.0版本报文
+const SignMethodSM3 = "12"
+
+// SM3Signer 国密签名 SM2(hex(SM3(canonical))),SM2签名时使用默认用户标识计算Z值
+type SM3Signer struct {
+	signer crypto.Signer
+}
+
+// NewSM3Signer s的Sign方法需对原文做SM2签名,如gm.SM2Signer或支持国密的密码机
+func NewSM3Signer(s crypto.Signer) *SM3Signer {
+	return &SM3Signer{signer: s}
+}
+
+func (s *SM3Signer) SignMethod() string {
+	return SignMethodSM3
+}
+
+// Public SM2私钥对应的公钥,用于校验与签名证书是否一致
+func (s *SM3Signer) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *SM3Signer) Sign(canonical []byte) ([]byte, error) {
+	return s.signer.Sign(rand.Reader, sm3Hex(canonical), crypto.Hash(0))
+}
+
+// SM2Verifier 使用银联国密验签证书公钥验签
+type SM2Verifier struct {
+	pub *ecdsa.PublicKey
+}
+
+func NewSM2Verifier(pub *ecdsa.PublicKey) *SM2Verifier {
+	return &SM2Verifier{pub: pub}
+}
+
+func (v *SM2Verifier) Verify(canonical, sig []byte) error {
+	return gm.VerifySM2(v.pub, nil, sm3Hex(canonical), sig)
+}
+
+func sm3Hex(b []byte) []byte {
+	sum := gm.SM3(b)
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// SM4Encrypter 使用SM4对敏感信息加密,CBC模式PKCS#7填充,每次加密使用随机IV
+// 密文为 IV || 密文 的Base64编码
+type SM4Encrypter struct {
+	block cipher.Block
+	keyID string
+}
+
+// NewSM4Encrypter keyID为银联分配的密钥编号,作为encryptCertId上送
+func NewSM4Encrypter(keyID string, key []byte) (*SM4Encrypter, error) {
+	block, err := gm.NewSM4(key)
+	if err != nil {
+		return nil, err
+	}
+	return &SM4Encrypter{block: block, keyID: keyID}, nil
+}
+
+func (e *SM4Encrypter) Encrypt(data []byte) (string, error) {
+	bs := e.block.BlockSize()
+	pad := bs - len(data)%bs
+	b := make([]byte, bs+len(data)+pad)
+	iv := b[:bs]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	copy(b[bs:], data)
+	copy(b[bs+len(data):], bytes.Repeat([]byte{byte(pad)}, pad))
+
+	cipher.NewCBCEncrypter(e.block, iv).CryptBlocks(b[bs:], b[bs:])
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (e *SM4Encrypter) CertID() string {
+	return e.keyID
+}
+
+// NewSMPayment 使用国密证书创建,signCertPath为商户SM2签名证书,priPath为SM2私钥(PKCS#8或SEC1),
+// certPath为银联SM2验签证书
+func NewSMPayment(mchID, signCertPath, priPath, certPath string) (up *UnionPay) {
+	up, err := newSMPayment(mchID, signCertPath, priPath, certPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return
+}
+
+func newSMPayment(mchID, signCertPath, priPath, certPath string) (up *UnionPay, err error) {
+	signCert, err := newSM2Certificate(signCertPath)
+	if err != nil {
+		return
+	}
+
+	priKey, err := newSM2PrivateKey(priPath)
+	if err != nil {
+		return
+	}
+
+	cert, err := newSM2Certificate(certPath)
+	if err != nil {
+		return
+	}
+
+	client, err := newHTTPSClient()
+	if err != nil {
+		return
+	}
+
+	signer := NewSM3Signer(&gm.SM2Signer{Key: priKey})
+	if err = checkSigner(signer, signCert.PublicKey); err != nil {
+		return
+	}
+
+	cred := newCredentialStore(&credentials{
+		signer:       signer,
+		certID:       signCert.SerialNumber.String(),
+		signPub:      signCert.PublicKey,
+		verifier:     NewSM2Verifier(cert.PublicKey),
+		verifyCertID: cert.SerialNumber.String(),
+		certs:        []CertInfo{sm2CertInfo(CertSign, signCert), sm2CertInfo(CertVerify, cert)},
+	})
+
+	up = &UnionPay{
+		mchID: mchID,
+		cred:  cred,
+
+		expiryWarningDays: DefaultExpiryWarningDays,
+		verifyCertGrace:   DefaultVerifyCertGracePeriod,
+
+		client: &unionPayClient{
+			client: client,
+			cred:   cred,
+		},
+	}
+
+	return
+}
+
+func readPEM(path string, types ...string) (block *pem.Block, err error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	block, _ = pem.Decode(pemData)
+	if block == nil {
+		err = fmt.Errorf("bad key data: %s", "not PEM-encoded")
+		return
+	}
+	if !Contains(types, block.Type) {
+		err = fmt.Errorf("unknown key type %q, want %q", block.Type, types)
+		return
+	}
+	return
+}
+
+func newSM2Certificate(path string) (*gm.Certificate, error) {
+	block, err := readPEM(path, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	return gm.ParseCertificate(block.Bytes)
+}
+
+func newSM2PrivateKey(path string) (*ecdsa.PrivateKey, error) {
+	block, err := readPEM(path, "PRIVATE KEY", "EC PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	return gm.ParsePrivateKey(block.Bytes)
+}
@@ -0,0 +1,127 @@
+package unionpay
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shima-park/unionpay/gm"
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+// writeSM2Cert 生成自签名SM2证书及SEC1格式私钥
+func writeSM2Cert(t *testing.T, serial int64) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &smx509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test sm2 cert"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	der, err := smx509.CreateCertificate(tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sec1, err := asn1.Marshal(struct {
+		Version       int
+		PrivateKey    []byte
+		NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	}{1, key.D.FillBytes(make([]byte, 32)), asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath = filepath.Join(dir, "sm2.cert"), filepath.Join(dir, "sm2.pem")
+	if err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestSMPaymentSignVerify(t *testing.T) {
+	certPath, keyPath := writeSM2Cert(t, 20240102)
+	up, err := newSMPayment("700000000000001", certPath, keyPath, certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if up.creds().certID != "20240102" || up.creds().signMethod() != SignMethodSM3 || up.creds().version() != "5.1.0" {
+		t.Errorf("certId=%s signMethod=%s version=%s", up.creds().certID, up.creds().signMethod(), up.creds().version())
+	}
+
+	kvs := KVpairs{{K: "merId", V: up.mchID}, {K: "orderId", V: "ORDER0001"}}
+	sig, err := signature(up.creds().signer, kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := base64.StdEncoding.DecodeString(sig)
+	if err = up.creds().verifier.Verify([]byte("merId=700000000000001&orderId=ORDER0001"), b); err != nil {
+		t.Errorf("verify own signature: %v", err)
+	}
+	if err = up.creds().verifier.Verify([]byte("merId=700000000000001&orderId=ORDER0002"), b); err == nil {
+		t.Error("signature verified for another message")
+	}
+
+	// RSA签名器不能用于SM2证书
+	key, _ := newPrivateKey("key.pem")
+	if err = checkSigner(NewCryptoSigner(key), up.creds().signPub); err == nil {
+		t.Error("RSA signer accepted for SM2 sign cert")
+	}
+	other, _ := gm.GenerateSM2Key(rand.Reader)
+	if err = checkSigner(NewSM3Signer(&gm.SM2Signer{Key: other}), up.creds().signPub); err == nil {
+		t.Error("SM2 signer with another key accepted")
+	}
+}
+
+func TestSM4EncrypterCBC(t *testing.T) {
+	key := bytes.Repeat([]byte{0x11}, 16)
+	e, err := NewSM4Encrypter("0001", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("6216261000000000018")
+	c1, err := e.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _ := e.Encrypt(plain)
+	if c1 == c2 {
+		t.Error("same plaintext encrypted to the same ciphertext")
+	}
+
+	b, _ := base64.StdEncoding.DecodeString(c1)
+	if len(b) != 16+32 {
+		t.Fatalf("ciphertext length %d, want IV plus 2 blocks", len(b))
+	}
+	block, _ := gm.NewSM4(key)
+	out := make([]byte, len(b)-16)
+	cipher.NewCBCDecrypter(block, b[:16]).CryptBlocks(out, b[16:])
+	pad := int(out[len(out)-1])
+	if !bytes.Equal(out[:len(out)-pad], plain) {
+		t.Errorf("decrypted %q, want %q", out[:len(out)-pad], plain)
+	}
+	if e.CertID() != "0001" {
+		t.Errorf("CertID = %s", e.CertID())
+	}
+}
@@ -1,7 +1,7 @@
 package unionpay
 
 import (
-	"crypto"
+	"context"
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
@@ -19,6 +19,8 @@ import (
 	"io/ioutil"
 
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -30,6 +32,34 @@ const (
 
 var ErrNotifyDataIsEmpty = errors.New("notify data is empty")
 
+// RespError 银联应答码非00时返回的错误
+type RespError struct {
+	Code string // 应答码
+	Msg  string // 应答信息
+}
+
+func (e *RespError) Error() string {
+	return "response error:" + e.Msg
+}
+
+// IsUnknown 应答码为03,04,05时交易状态未明,需要通过查询交易确认结果
+func (e *RespError) IsUnknown() bool {
+	switch e.Code {
+	case "03", "04", "05":
+		return true
+	}
+	return false
+}
+
+// SignatureError 应答或通知验签失败
+type SignatureError struct {
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	return "signature verify failed:" + e.Err.Error()
+}
+
 type UnionPay struct {
 	testEnv bool
 
@@ -41,9 +71,19 @@ type UnionPay struct {
 	   短信验证码	111111
 
 	*/
-	verifySignCert *x509.Certificate //verify_sign_acp.cer
-	publicKey      *x509.Certificate //加密密钥路径(openssl pkcs12 -in PM_700000000000001_acp.pfx -clcerts -nokeys -out key.cert)
-	privateKey     *rsa.PrivateKey   //加密证书路径(openssl pkcs12 -in PM_700000000000001_acp.pfx -nocerts -nodes -out key.pem)
+	// 签名证书 加密密钥路径(openssl pkcs12 -in PM_700000000000001_acp.pfx -clcerts -nokeys -out key.cert)
+	// 签名私钥 加密证书路径(openssl pkcs12 -in PM_700000000000001_acp.pfx -nocerts -nodes -out key.pem)
+	// 验签证书 verify_sign_acp.cer
+	// 加密证书 acp_test_enc.cer
+	cred *credentialStore
+
+	access       Access   // 接入方式 默认商户直连接入
+	currency     Currency // 交易币种 默认人民币
+	payoutLedger PayoutLedger
+
+	expiryWarningDays int             // 证书剩余有效天数告警阈值 默认DefaultExpiryWarningDays
+	verifyCertGrace   time.Duration   // 替换前的验签证书保留时长 默认DefaultVerifyCertGracePeriod
+	ctx               context.Context // 请求及轮询等待使用的context 默认context.Background()
 
 	client *unionPayClient
 }
@@ -60,30 +100,85 @@ func (up *UnionPay) SetTestEnv(b bool) *UnionPay {
 	return up
 }
 
+// SetEncryptCert 设置敏感信息加密证书,代付等需要上送加密卡号的交易必须设置
+func (up *UnionPay) SetEncryptCert(certPath string) *UnionPay {
+	if err := up.setEncryptCert(certPath); err != nil {
+		log.Fatal(err)
+	}
+	return up
+}
+
+func (up *UnionPay) setEncryptCert(certPath string) error {
+	cert, err := newCertificate(certPath)
+	if err != nil {
+		return err
+	}
+	e, err := NewRSAEncrypter(cert)
+	if err != nil {
+		return err
+	}
+	up.cred.update(func(c *credentials) {
+		c.encrypter = e
+		c.certs = c.withCert(x509CertInfo(CertEncrypt, cert))
+	})
+	return nil
+}
+
+// SetPayoutLedger 设置代付台账,状态未明的代付不会被重复发送
+func (up *UnionPay) SetPayoutLedger(l PayoutLedger) *UnionPay {
+	up.payoutLedger = l
+	return up
+}
+
 type unionPayClient struct {
-	client         *http.Client
-	verifySignCert *x509.Certificate
+	client *http.Client
+	cred   *credentialStore
+	clock  atomic.Value // clockBox 默认系统时间,统一转换为北京时间
+
+	middlewares       []Middleware
+	notifyMiddlewares []NotifyMiddleware
+	audit             AuditSink
 }
 
-func (c *unionPayClient) PostForm(u *url.URL, form map[string][]string, ret interface{}) error {
-	msg := url.Values(form).Encode()
+func (c *unionPayClient) PostForm(ctx context.Context, u *url.URL, form map[string][]string, ret interface{}) error {
+	rt := c.auditRoundTrip
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		rt = c.middlewares[i](rt)
+	}
+
+	resp, err := rt(&Request{URL: u, Form: url.Values(form), Context: ctx})
+	if err != nil {
+		return err
+	}
 
-	req, err := http.NewRequest("POST", u.String(), strings.NewReader(msg))
+	m, err := decodeData(resp.Fields)
 	if err != nil {
 		return err
 	}
+	return mapstructure.Decode(m, ret)
+}
+
+func (c *unionPayClient) roundTrip(r *Request) (*Response, error) {
+	msg := r.Form.Encode()
 
+	req, err := http.NewRequest("POST", r.URL.String(), strings.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(r.context())
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.ContentLength = int64(len(msg))
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return c.Parse(ret, resp)
+	return c.Parse(resp)
 }
 
-func (upp *unionPayClient) Parse(ret interface{}, resp *http.Response) (err error) {
+// Parse 读取应答并验签,应答码非00时同时返回应答及RespError
+func (upp *unionPayClient) Parse(resp *http.Response) (ret *Response, err error) {
 	defer resp.Body.Close()
 
 	var body []byte
@@ -97,8 +192,7 @@ func (upp *unionPayClient) Parse(ret interface{}, resp *http.Response) (err erro
 		return
 	}
 
-	var fields []string
-	fields = strings.Split(string(body), "&")
+	fields := splitResponse(string(body))
 
 	vals := url.Values{}
 	data := map[string]string{}
@@ -111,63 +205,152 @@ func (upp *unionPayClient) Parse(ret interface{}, resp *http.Response) (err erro
 		}
 	}
 
-	if err = verify(upp.verifySignCert.PublicKey.(*rsa.PublicKey), vals, nil); err != nil {
+	ret = &Response{Body: body, Fields: data}
+	v, _ := upp.cred.load().verifierFor(data["certId"], upp.now())
+	if err = verify(v, vals, nil); err != nil {
 		return
 	}
 
 	if data["respCode"] != "00" {
-		err = fmt.Errorf("response error:%s", data["respMsg"])
+		err = &RespError{Code: data["respCode"], Msg: data["respMsg"]}
 		return
 	}
+	return
+}
 
-	err = mapstructure.Decode(data, ret)
-	return err
+// splitResponse 按&拆分应答报文,组合域如 billDetailInfo={k1=v1&k2=v2} 中的&不拆分
+func splitResponse(body string) (fields []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '&':
+			if depth == 0 {
+				fields = append(fields, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, body[start:])
 }
 
 func NewPayment(mchID, pubPath, priPath, certPath string) (up *UnionPay) {
-	var (
-		err        error
-		cert       *x509.Certificate
-		publicKey  *x509.Certificate
-		privateKey *rsa.PrivateKey
-	)
-
-	publicKey, err = newPublicKey(pubPath)
+	up, err := newPayment(mchID, pubPath, priPath, certPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return
+}
 
-	privateKey, err = newPrivateKey(priPath)
+func newPayment(mchID, pubPath, priPath, certPath string) (up *UnionPay, err error) {
+	privateKey, err := newPrivateKey(priPath)
 	if err != nil {
-		log.Fatal(err)
+		return
+	}
+
+	up, err = newPaymentWithSigner(mchID, pubPath, NewCryptoSigner(privateKey), certPath)
+	if err != nil {
+		return
 	}
+	up.cred.update(func(c *credentials) {
+		c.privateKey = privateKey
+	})
+	return
+}
 
-	cert, err = newCertificate(certPath)
+// NewPaymentWithSigner 使用指定签名器创建,私钥不落地,pubPath为签名证书,用于上送certId
+// 未设置私钥时无法解密应答中的敏感信息,签名器与签名证书不一致时退出
+func NewPaymentWithSigner(mchID, pubPath string, signer Signer, certPath string) (up *UnionPay) {
+	up, err := newPaymentWithSigner(mchID, pubPath, signer, certPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return
+}
+
+func newPaymentWithSigner(mchID, pubPath string, signer Signer, certPath string) (up *UnionPay, err error) {
+	publicKey, err := newPublicKey(pubPath)
+	if err != nil {
+		return
+	}
+
+	cert, err := newCertificate(certPath)
+	if err != nil {
+		return
+	}
+
+	if err = checkSigner(signer, publicKey.PublicKey); err != nil {
+		return
+	}
 
 	client, err := newHTTPSClient()
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
 
+	cred := newCredentialStore(&credentials{
+		signer:       signer,
+		certID:       publicKey.SerialNumber.String(),
+		signPub:      publicKey.PublicKey,
+		verifier:     NewRSAVerifier(cert.PublicKey.(*rsa.PublicKey)),
+		verifyCertID: cert.SerialNumber.String(),
+		certs:        []CertInfo{x509CertInfo(CertSign, publicKey), x509CertInfo(CertVerify, cert)},
+	})
+
 	up = &UnionPay{
 		mchID: mchID,
+		cred:  cred,
 
-		verifySignCert: cert,
-		publicKey:      publicKey,
-		privateKey:     privateKey,
+		expiryWarningDays: DefaultExpiryWarningDays,
+		verifyCertGrace:   DefaultVerifyCertGracePeriod,
 
 		client: &unionPayClient{
-			client:         client,
-			verifySignCert: cert,
+			client: client,
+			cred:   cred,
 		},
 	}
 
 	return
 }
 
+// MerID 商户代码
+func (up *UnionPay) MerID() string {
+	return up.mchID
+}
+
+// WithContext 返回使用ctx的UnionPay,证书及http客户端与原对象共享
+// ctx取消或超时后不再发出新的请求,查询及冲正等轮询也随之结束
+func (up *UnionPay) WithContext(ctx context.Context) *UnionPay {
+	c := *up
+	c.ctx = ctx
+	return &c
+}
+
+func (up *UnionPay) context() context.Context {
+	if up.ctx == nil {
+		return context.Background()
+	}
+	return up.ctx
+}
+
+// sleepContext 等待d,ctx结束时提前返回ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func newHTTPSClient() (c *http.Client, err error) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -259,9 +442,29 @@ func newCertificate(certpath string) (cert *x509.Certificate, err error) {
 	return
 }
 
-func verify(certPubKey *rsa.PublicKey, vals url.Values, fields []string) (err error) {
-	var signature string
-	kvs := KVpairs{}
+func verify(v Verifier, vals url.Values, fields []string) (err error) {
+	canonical, signature := canonicalString(vals, fields)
+
+	var inSign []byte
+	inSign, err = base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return &SignatureError{Err: err}
+	}
+
+	if err = v.Verify([]byte(canonical), inSign); err != nil {
+		return &SignatureError{Err: err}
+	}
+	return
+}
+
+// canonicalString 待验签串及签名,fields为空表示全部域
+func canonicalString(vals url.Values, fields []string) (canonical, signature string) {
+	kvs, signature := signedKVpairs(vals, fields)
+	return kvs.Join("&"), signature
+}
+
+// signedKVpairs 参与签名的非空域,按域名排序,fields为空表示全部域
+func signedKVpairs(vals url.Values, fields []string) (kvs KVpairs, signature string) {
 	for k := range vals {
 		if len(fields) > 0 && !Contains(fields, k) {
 			continue
@@ -278,34 +481,5 @@ func verify(certPubKey *rsa.PublicKey, vals url.Values, fields []string) (err er
 
 		kvs = append(kvs, KVpair{K: k, V: vals.Get(k)})
 	}
-
-	sig := SHA1([]byte(kvs.RemoveEmpty().Sort().Join("&")))
-
-	hashed := SHA1([]byte(fmt.Sprintf("%x", sig)))
-
-	var inSign []byte
-	inSign, err = base64.StdEncoding.DecodeString(signature)
-	if err != nil {
-		return
-	}
-
-	err = rsa.VerifyPKCS1v15(certPubKey, crypto.SHA1, hashed, inSign)
-	if err != nil {
-		return
-	}
-	return
-}
-
-func signature(priKey *rsa.PrivateKey, kvs KVpairs) (sig string, err error) {
-	sha1ParamsStr := SHA1([]byte(kvs.RemoveEmpty().Sort().Join("&")))
-
-	hashed := SHA1([]byte(fmt.Sprintf("%x", sha1ParamsStr)))
-
-	rsaSign, err := rsa.SignPKCS1v15(nil, priKey, crypto.SHA1, hashed)
-	if err != nil {
-		return
-	}
-
-	sig = base64.StdEncoding.EncodeToString(rsaSign)
-	return
+	return kvs.RemoveEmpty().Sort(), signature
 }
@@ -0,0 +1,130 @@
+package unionpay
+
+import (
+	"errors"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var errNetwork = errors.New("connection reset by peer")
+
+// newTestPayment 使用仓库中的测试商户证书,验签证书与签名证书相同
+func newTestPayment(t *testing.T) *UnionPay {
+	t.Helper()
+
+	return NewPayment("700000000000001", "key.cert", "key.pem", "key.cert").
+		SetEncryptCert("key.cert").
+		SetTestEnv(true)
+}
+
+// gatewayFunc 模拟网关,返回nil时视为网络异常
+type gatewayFunc func(form url.Values) map[string]string
+
+// gatewayTransport 在HTTP层模拟网关,应答使用商户私钥签名
+type gatewayTransport struct {
+	up *UnionPay
+	fn gatewayFunc
+}
+
+func (g gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := g.fn(form)
+	if fields == nil {
+		return nil, errNetwork
+	}
+	kvs := KVpairs{}
+	for k, v := range fields {
+		kvs = append(kvs, KVpair{K: k, V: v})
+	}
+	sig, err := signature(g.up.creds().signer, kvs)
+	if err != nil {
+		return nil, err
+	}
+	kvs = append(kvs.Sort(), KVpair{K: "signature", V: sig})
+
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(kvs.Join("&"))),
+		Request:    req,
+	}, nil
+}
+
+// fakeGateway 替换HTTP客户端,应答经过验签及解析
+func fakeGateway(up *UnionPay, fn gatewayFunc) {
+	up.client.client = &http.Client{Transport: gatewayTransport{up: up, fn: fn}}
+}
+
+// respFields 应答中原样返回请求的订单信息
+func respFields(form url.Values, respCode string, extra ...string) map[string]string {
+	m := map[string]string{
+		"merId":    form.Get("merId"),
+		"orderId":  form.Get("orderId"),
+		"txnType":  form.Get("txnType"),
+		"txnTime":  form.Get("txnTime"),
+		"respCode": respCode,
+		"respMsg":  "msg " + respCode,
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		m[extra[i]] = extra[i+1]
+	}
+	return m
+}
+
+// signedNotify 使用商户私钥签名的通知请求
+func signedNotify(t *testing.T, up *UnionPay, vals url.Values) *http.Request {
+	t.Helper()
+
+	kvs := KVpairs{}
+	for k := range vals {
+		kvs = append(kvs, KVpair{K: k, V: vals.Get(k)})
+	}
+	sig, err := signature(up.creds().signer, kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals.Set("signature", sig)
+
+	req, err := http.NewRequest("POST", "/notify", strings.NewReader(vals.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+var hiddenInput = regexp.MustCompile(`<input type="hidden" name="([^"]*)" id="[^"]*" value="([^"]*)" />`)
+
+// htmlForm 解析前台交易自动提交表单中的隐藏域
+func htmlForm(t *testing.T, page string) url.Values {
+	t.Helper()
+
+	form := url.Values{}
+	for _, m := range hiddenInput.FindAllStringSubmatch(page, -1) {
+		form.Set(html.UnescapeString(m[1]), html.UnescapeString(m[2]))
+	}
+	if len(form) == 0 {
+		t.Fatalf("no form fields in %q", page)
+	}
+	return form
+}
+
+func TestSplitResponse(t *testing.T) {
+	got := splitResponse("respCode=00&billDetailInfo={usr_num=10001&usr_nm=张三}&respMsg=ok")
+	want := []string{"respCode=00", "billDetailInfo={usr_num=10001&usr_nm=张三}", "respMsg=ok"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}